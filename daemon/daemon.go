@@ -1,51 +1,183 @@
 package daemon
 
 import (
+	"context"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"../db"
 	"../model"
 	"../ui"
+	"../util"
 )
 
+// Config — настройки демона, см. LoadConfig
 type Config struct {
-	ListenSpec string
+	ListenSpec string `toml:"listen"`
+	// Отдельный адрес для /metrics без TLS и входа, пусто — метрики не отдаются
+	MetricsListen string `toml:"metrics_listen"`
+	TrustedCA     string `toml:"trusted_ca"`  // PEM файл или каталог с доверенными корневыми сертификатами
+	AssetsPath    string `toml:"assets_path"` // Каталог с интерфейсом
+	UploadDir     string `toml:"upload_dir"`  // Каталог загруженных файлов приказов
+	LogLevel      string `toml:"log_level"`   // Уровень журнала: debug, info, warn, error
+	// Сколько секунд дорабатывать начатые запросы после SIGTERM
+	ShutdownTimeout int `toml:"shutdown_timeout"`
+	// Сколько секунд /readyz отвечает 503 до остановки приема соединений,
+	// чтобы балансировщик успел исключить экземпляр
+	DrainDelay int `toml:"drain_delay"`
 
-	Db db.Config
-	UI ui.Config
+	Db   db.Config       `toml:"db"`
+	UI   ui.Config       `toml:"ui"`
+	TLS  TLSConfig       `toml:"tls"`
+	Mail util.MailConfig `toml:"smtp"`
+
+	Password model.PasswordPolicy `toml:"password"`
 }
 
 func Run(cfg *Config) error {
 	log.Printf("Starting, HTTP on: %s\n", cfg.ListenSpec)
+	util.UploadDir = cfg.UploadDir
+	model.DefaultPageSize = cfg.UI.PageSize
+	if err := cfg.Password.LoadBlocklist(); err != nil {
+		log.Printf("Error loading password blocklist: %v\n", err)
+		return err
+	}
+	model.DefaultPasswordPolicy = cfg.Password
 	// Инициализация соединение с БД
 	db, err := db.InitDb(cfg.Db)
 	if err != nil {
 		log.Printf("Error initializing database: %v\n", err)
 		return err
 	}
+	// Доверенные сертификаты для проверки подписей оригиналов
+	if cfg.TrustedCA != "" {
+		pool, err := util.LoadCertPool(cfg.TrustedCA)
+		if err != nil {
+			log.Printf("Error loading trusted CA certificates: %v\n", err)
+			db.Close()
+			return err
+		}
+		cfg.UI.TrustedCA = pool
+	}
 	// Создание модели БД
 	m := model.New(db)
 
 	l, err := net.Listen("tcp", cfg.ListenSpec)
 	if err != nil {
 		log.Printf("Error creating listener: %v\n", err)
+		db.Close()
+		return err
+	}
+	tlsConfig, certs, err := buildTLS(cfg.TLS)
+	if err != nil {
+		log.Printf("Error loading TLS certificate: %v\n", err)
+		l.Close()
+		db.Close()
 		return err
 	}
-	// Запуск интерфейса пользователя
-	ui.Start(cfg.UI, m, l)
+	// Интерфейс пользователя и проверки состояния
+	cfg.UI.Mail = cfg.Mail
+	h := ui.Start(cfg.UI, m)
+	// Уведомления о событиях приказов и пользователей
+	startNotifier(m, cfg.Mail)
+	// Доставка событий на внешние вебхуки
+	hooks := startWebhooks(m)
 
-	waitForSignal()
+	registerMetrics(db, m)
+	hc := &health{db: db}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", hc.Healthz)
+	mux.HandleFunc("/readyz", hc.Readyz)
+	mux.Handle("/", h)
+	server := &http.Server{Handler: mux, TLSConfig: tlsConfig, ReadHeaderTimeout: 30 * time.Second}
+	serveErr := make(chan error, 3)
+	go func() {
+		// сертификат берется из TLSConfig.GetCertificate
+		serveErr <- server.ServeTLS(l, "", "")
+	}()
+	// HTTP только для перенаправления на HTTPS
+	var redirect *http.Server
+	if cfg.TLS.RedirectListen != "" {
+		redirect = &http.Server{Addr: cfg.TLS.RedirectListen, Handler: redirectHandler(cfg.ListenSpec), ReadHeaderTimeout: 30 * time.Second}
+		go func() {
+			serveErr <- redirect.ListenAndServe()
+		}()
+	}
+	// Метрики только на внутреннем адресе: наружу не видны ни счетчики, ни сама выгрузка
+	var metrics *http.Server
+	if cfg.MetricsListen != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.HandleFunc("/metrics", metricsHandler)
+		metrics = &http.Server{Addr: cfg.MetricsListen, Handler: metricsMux, ReadHeaderTimeout: 30 * time.Second}
+		go func() {
+			serveErr <- metrics.ListenAndServe()
+		}()
+	}
+	// Запуск рассылки отчетов по расписанию
+	sched := startScheduler(m, cfg.Mail)
+	// Отбор документов с истекшим сроком хранения
+	ret := startRetention(m)
+
+	err = waitForSignal(serveErr, certs)
+	if err == nil {
+		// сначала снимаемся с балансировщика: /readyz отвечает 503, новые запросы
+		// еще принимаются, пока он это не заметит
+		hc.Drain()
+		if cfg.DrainDelay > 0 {
+			log.Printf("Draining for %ds before shutdown\n", cfg.DrainDelay)
+			time.Sleep(time.Duration(cfg.DrainDelay) * time.Second)
+		}
+		// дорабатываем начатые запросы, в том числе загрузки файлов
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
+		if redirect != nil {
+			redirect.Shutdown(ctx)
+		}
+		if metrics != nil {
+			metrics.Shutdown(ctx)
+		}
+		if err = server.Shutdown(ctx); err != nil {
+			log.Printf("Error shutting down HTTP server: %v\n", err)
+		}
+		cancel()
+	} else {
+		log.Printf("Error serving HTTP: %v\n", err)
+	}
+	sched.Stop()
+	ret.Stop()
+	hooks.Stop()
+	if cerr := db.Close(); cerr != nil {
+		log.Printf("Error closing database: %v\n", cerr)
+	}
 
-	return nil
+	return err
 }
 
-func waitForSignal() {
-	ch := make(chan os.Signal)
-	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
-	s := <-ch
-	log.Printf("Got signal: %v, exiting.", s)
+// waitForSignal ждет SIGINT/SIGTERM или ошибку HTTP сервера.
+// По SIGHUP перечитывает сертификат HTTPS
+func waitForSignal(serveErr <-chan error, certs *certReloader) error {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(ch)
+	for {
+		select {
+		case s := <-ch:
+			if s == syscall.SIGHUP {
+				if err := certs.Reload(); err != nil {
+					log.Printf("Error reloading TLS certificate, keeping the old one: %v", err)
+				} else {
+					log.Printf("TLS certificate reloaded")
+				}
+				continue
+			}
+			log.Printf("Got signal: %v, exiting.", s)
+			return nil
+		case err := <-serveErr:
+			return err
+		}
+	}
 }
@@ -0,0 +1,57 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// Время ожидания ответа БД при проверке состояния
+const healthTimeout = 2 * time.Second
+
+// pinger проверяет соединение с БД
+type pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// health — обработчики /healthz и /readyz. Оба проверяют соединение с БД,
+// /readyz дополнительно отвечает 503 с начала остановки, чтобы балансировщик
+// перестал присылать новые запросы, пока сервер дорабатывает текущие
+type health struct {
+	db       pinger
+	draining int32
+}
+
+func (h *health) Drain() {
+	atomic.StoreInt32(&h.draining, 1)
+}
+
+func (h *health) check(w http.ResponseWriter, r *http.Request) bool {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+	if err := h.db.Ping(ctx); err != nil {
+		log.Printf("health: error Ping: %v", err)
+		http.Error(w, fmt.Sprintf("db: %v", err), http.StatusServiceUnavailable)
+		return false
+	}
+	return true
+}
+
+func (h *health) Healthz(w http.ResponseWriter, r *http.Request) {
+	if h.check(w, r) {
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+func (h *health) Readyz(w http.ResponseWriter, r *http.Request) {
+	if atomic.LoadInt32(&h.draining) == 1 {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	if h.check(w, r) {
+		fmt.Fprintln(w, "ready")
+	}
+}
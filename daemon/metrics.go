@@ -0,0 +1,76 @@
+package daemon
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"../model"
+	"../util"
+)
+
+// ordersRefresh — не чаще этого показатели реестра пересчитываются запросом к БД
+const ordersRefresh = time.Minute
+
+// statser — статистика пула соединений с БД
+type statser interface {
+	Stats() sql.DBStats
+}
+
+// registerMetrics регистрирует показатели пула соединений и реестра, которые обновляются при выгрузке /metrics
+func registerMetrics(db statser, m *model.Model) {
+	poolConnections := util.Metrics.NewGauge("dborders_db_pool_connections",
+		"DB pool connections by state.", "state")
+	poolMaxOpen := util.Metrics.NewGauge("dborders_db_pool_max_open_connections",
+		"Maximum number of open DB connections.")
+	poolWaits := util.Metrics.NewCounter("dborders_db_pool_wait_total",
+		"Number of times a query waited for a free DB connection.")
+	poolWaitSeconds := util.Metrics.NewCounter("dborders_db_pool_wait_seconds_total",
+		"Total time spent waiting for a free DB connection.")
+	orders := util.Metrics.NewGauge("dborders_orders",
+		"Orders by registration year and status.", "year", "status")
+
+	ctx := util.WithLogFields(context.Background(), util.Fields{"job": "metrics"})
+	var (
+		mu      sync.Mutex
+		counted time.Time
+	)
+	util.Metrics.OnCollect(func() {
+		stats := db.Stats()
+		poolConnections.Set(float64(stats.InUse), "in_use")
+		poolConnections.Set(float64(stats.Idle), "idle")
+		poolMaxOpen.Set(float64(stats.MaxOpenConnections))
+		poolWaits.Set(float64(stats.WaitCount))
+		poolWaitSeconds.Set(stats.WaitDuration.Seconds())
+
+		// частые выгрузки не должны нагружать БД подсчетом всего реестра
+		mu.Lock()
+		defer mu.Unlock()
+		if time.Since(counted) < ordersRefresh {
+			return
+		}
+		counted = time.Now()
+		counts, err := m.GetOrderCountsByYear(ctx)
+		if err != nil {
+			log.Printf("metrics: error GetOrderCountsByYear: %v", err)
+			return
+		}
+		// годы и состояния без приказов пропадают из выгрузки
+		orders.Reset()
+		for _, c := range counts {
+			orders.Set(float64(c.Count), strconv.Itoa(c.Year), c.Status)
+		}
+	})
+}
+
+// metricsHandler отдает метрики в текстовом формате Prometheus
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", util.MetricsContentType)
+	if err := util.Metrics.Export(w); err != nil {
+		log.Printf("metrics: error Export: %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+
+	"../model"
+	"../util"
+)
+
+// notifier подписан на события модели: складывает уведомления во входящие
+// подписчиков и дублирует их на почту тем, кто этого попросил
+type notifier struct {
+	m    *model.Model
+	mail util.MailConfig
+	ctx  context.Context
+}
+
+func startNotifier(m *model.Model, mail util.MailConfig) *notifier {
+	n := &notifier{m: m, mail: mail, ctx: util.WithLogFields(context.Background(), util.Fields{"job": "notifier"})}
+	m.Subscribe(n.Handle)
+	return n
+}
+
+func (n *notifier) Handle(e model.Event) {
+	switch e.Type {
+	case model.OrderCreated, model.OrderUpdated, model.OrderCancelled:
+		n.orderEvent(e)
+	case model.UserCreated:
+		n.userEvent(e)
+	}
+}
+
+func (n *notifier) orderEvent(e model.Event) {
+	subscribers, err := n.m.GetSubscribers(n.ctx, e.Order.DocType, e.Order.Username)
+	if err != nil {
+		log.Printf("notifier: %s: %v", e.Type, err)
+		return
+	}
+	message := orderMessage(e)
+	for _, s := range subscribers {
+		// автора о его собственном новом приказе не уведомляем
+		if e.Type == model.OrderCreated && s.Username == e.Order.Username {
+			continue
+		}
+		n.notify(model.Notification{UserID: s.UserID, Event: e.Type, OrderID: e.Order.ID, Message: message}, s.Email, s.ByEmail)
+	}
+}
+
+func (n *notifier) userEvent(e model.Event) {
+	users, err := n.m.GetUsers(n.ctx)
+	if err != nil {
+		log.Printf("notifier: %s: %v", e.Type, err)
+		return
+	}
+	message := fmt.Sprintf("Создан пользователь %s (%s)", e.User.Username, e.User.Title)
+	for _, u := range users {
+		if u.IsAdmin {
+			n.notify(model.Notification{UserID: u.ID, Event: e.Type, Message: message}, u.Email, false)
+		}
+	}
+}
+
+func (n *notifier) notify(notification model.Notification, email string, byEmail bool) {
+	if err := n.m.CreateNotification(n.ctx, notification); err != nil {
+		log.Printf("notifier: user %d: %v", notification.UserID, err)
+	}
+	if !byEmail || email == "" || n.mail.Addr == "" {
+		return
+	}
+	go func() {
+		body := "<p>" + template.HTMLEscapeString(notification.Message) + "</p>"
+		if err := util.SendMailRetry(n.ctx, n.mail, mailAttempts, mailDelay, []string{email}, notification.Message, body); err != nil {
+			log.Printf("notifier: error sending to %s: %v", email, err)
+		}
+	}()
+}
+
+func orderMessage(e model.Event) string {
+	o := e.Order
+	title := fmt.Sprintf("%s от %s №%s", o.DocType, util.FormatDate(o.RegDate, "02-01-2006"), o.RegNumber)
+	switch e.Type {
+	case model.OrderCreated:
+		return fmt.Sprintf("Зарегистрирован %s: %s", title, o.Description)
+	case model.OrderCancelled:
+		return fmt.Sprintf("Утратил силу %s: %s", title, o.Description)
+	default:
+		return fmt.Sprintf("Изменен %s: %s", title, o.Description)
+	}
+}
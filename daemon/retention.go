@@ -0,0 +1,57 @@
+package daemon
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"../model"
+	"../util"
+)
+
+// retention раз в сутки отбирает приказы с истекшим сроком хранения
+// и включает их в формируемый акт о выделении к уничтожению
+type retention struct {
+	m    *model.Model
+	stop chan struct{}
+	// отменяется при остановке, чтобы прервать выполняющийся запрос к БД
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func startRetention(m *model.Model) *retention {
+	ctx, cancel := context.WithCancel(util.WithLogFields(context.Background(), util.Fields{"job": "retention"}))
+	r := &retention{m: m, stop: make(chan struct{}), ctx: ctx, cancel: cancel}
+	go r.loop()
+	return r
+}
+
+func (r *retention) Stop() {
+	r.cancel()
+	close(r.stop)
+}
+
+func (r *retention) loop() {
+	r.build(time.Now())
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case now := <-ticker.C:
+			r.build(now)
+		}
+	}
+}
+
+func (r *retention) build(now time.Time) {
+	actID, count, err := r.m.BuildDisposalAct(r.ctx, now)
+	if err != nil {
+		log.Printf("retention: error BuildDisposalAct: %v", err)
+		return
+	}
+	if count > 0 {
+		log.Printf("retention: %d documents added to disposal act %d", count, actID)
+	}
+}
@@ -0,0 +1,308 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"../model"
+	"../util"
+)
+
+// Количество попыток отправки отчета и пауза перед первым повтором
+const (
+	mailAttempts = 3
+	mailDelay    = 30 * time.Second
+)
+
+// Неудачную рассылку повторяем не каждую минуту: пауза растет вдвое от failureDelay
+// до maxFailureDelay, а после maxFailures неудач подряд ждем следующего срока по расписанию
+const (
+	failureDelay    = 5 * time.Minute
+	maxFailureDelay = 2 * time.Hour
+	maxFailures     = 5
+)
+
+// scheduler раз в минуту проверяет расписания рассылок из БД
+// и отправляет отчеты, время которых наступило
+type scheduler struct {
+	m    *model.Model
+	mail util.MailConfig
+	stop chan struct{}
+	// отменяется при остановке, чтобы прервать выполняющийся запрос к БД
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// отчеты отправляются в отдельных горутинах, чтобы повторы отправки
+	// одного расписания не задерживали остальные и остановку
+	mu     sync.Mutex
+	states map[int64]*scheduleState
+	wg     sync.WaitGroup
+}
+
+// scheduleState — состояние отправки по одному расписанию
+type scheduleState struct {
+	running  bool      // отчет отправляется прямо сейчас
+	failures int       // неудач подряд
+	retryAt  time.Time // раньше этого времени не повторяем
+}
+
+func startScheduler(m *model.Model, mail util.MailConfig) *scheduler {
+	s := newScheduler(m, mail)
+	go s.loop()
+	return s
+}
+
+func newScheduler(m *model.Model, mail util.MailConfig) *scheduler {
+	ctx, cancel := context.WithCancel(util.WithLogFields(context.Background(), util.Fields{"job": "scheduler"}))
+	return &scheduler{m: m, mail: mail, stop: make(chan struct{}), ctx: ctx, cancel: cancel, states: map[int64]*scheduleState{}}
+}
+
+func (s *scheduler) Stop() {
+	s.cancel()
+	close(s.stop)
+	s.wg.Wait()
+}
+
+func (s *scheduler) loop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			s.runDue(now)
+		}
+	}
+}
+
+func (s *scheduler) runDue(now time.Time) {
+	schedules, err := s.m.GetSchedules(s.ctx)
+	if err != nil {
+		log.Printf("scheduler: error GetSchedules: %v", err)
+		return
+	}
+	for _, schedule := range schedules {
+		if !schedule.Active {
+			continue
+		}
+		spec, err := util.ParseCron(schedule.Spec)
+		if err != nil {
+			log.Printf("scheduler: schedule %d: %v", schedule.ID, err)
+			continue
+		}
+		// Первый запуск считаем от начала прошлой недели
+		lastRun := schedule.LastRun
+		if lastRun.IsZero() {
+			lastRun = now.AddDate(0, 0, -7)
+		}
+		if next := spec.Next(lastRun); next.IsZero() || next.After(now) {
+			continue
+		}
+		if !s.start(schedule.ID, now) {
+			continue
+		}
+		s.wg.Add(1)
+		go func(schedule model.Schedule) {
+			defer s.wg.Done()
+			err := s.send(schedule, lastRun, now)
+			if err == nil {
+				err = s.m.UpdateScheduleLastRun(s.ctx, schedule.ID, now)
+			}
+			s.finish(schedule.ID, spec, now, err)
+		}(schedule)
+	}
+}
+
+// start отмечает начало отправки; ложь — отчет уже отправляется или время повтора не наступило
+func (s *scheduler) start(id int64, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[id]
+	if !ok {
+		state = &scheduleState{}
+		s.states[id] = state
+	}
+	if state.running || now.Before(state.retryAt) {
+		return false
+	}
+	state.running = true
+	return true
+}
+
+// finish запоминает результат отправки и после неудачи назначает время повтора
+func (s *scheduler) finish(id int64, spec *util.CronSpec, now time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.states[id]
+	state.running = false
+	if err == nil {
+		state.failures = 0
+		state.retryAt = time.Time{}
+		return
+	}
+	state.failures++
+	if state.failures >= maxFailures {
+		state.failures = 0
+		if state.retryAt = spec.Next(now); state.retryAt.IsZero() {
+			state.retryAt = now.Add(maxFailureDelay)
+		}
+		log.Printf("scheduler: schedule %d: error sending report, %d failures, next attempt %s: %v",
+			id, maxFailures, util.FormatDate(state.retryAt, "2006-01-02 15:04"), err)
+		return
+	}
+	state.retryAt = now.Add(failureBackoff(state.failures))
+	log.Printf("scheduler: schedule %d: error sending report, retry at %s: %v",
+		id, util.FormatDate(state.retryAt, "2006-01-02 15:04"), err)
+}
+
+// failureBackoff — пауза перед повтором после failures неудач подряд
+func failureBackoff(failures int) time.Duration {
+	delay := failureDelay
+	for i := 1; i < failures && delay < maxFailureDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxFailureDelay {
+		delay = maxFailureDelay
+	}
+	return delay
+}
+
+// send отправляет отчет за полуинтервал [startDate, endDate)
+func (s *scheduler) send(schedule model.Schedule, startDate, endDate time.Time) error {
+	created, err := s.m.GetDepartamentOrders(s.ctx, schedule.Departament, startDate, endDate)
+	if err != nil {
+		return err
+	}
+	cancelled, err := s.m.GetCancelledOrders(s.ctx, schedule.Departament, startDate, endDate)
+	if err != nil {
+		return err
+	}
+	return s.mailReport(schedule, departamentReport{
+		Title:       schedule.Title,
+		Departament: schedule.Departament,
+		StartDate:   startDate,
+		EndDate:     endDate,
+		Created:     created,
+		Cancelled:   cancelled,
+	})
+}
+
+func (s *scheduler) mailReport(schedule model.Schedule, report departamentReport) error {
+	body, err := report.HTML()
+	if err != nil {
+		return err
+	}
+	attachments := []util.Attachment{}
+	filename := fmt.Sprintf("orders-%s", util.FormatDate(report.EndDate, "2006-01-02"))
+	switch schedule.Format {
+	case model.ReportCSV:
+		data, err := report.CSV()
+		if err != nil {
+			return err
+		}
+		attachments = append(attachments, util.Attachment{
+			Filename:    filename + ".csv",
+			ContentType: "text/csv; charset=utf-8",
+			Data:        data,
+		})
+	case model.ReportODS:
+		data, err := report.ODS()
+		if err != nil {
+			return err
+		}
+		attachments = append(attachments, util.Attachment{
+			Filename:    filename + ".ods",
+			ContentType: "application/vnd.oasis.opendocument.spreadsheet",
+			Data:        data,
+		})
+	}
+
+	to := []string{}
+	for _, addr := range strings.Split(schedule.Recipients, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			to = append(to, addr)
+		}
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("не указаны получатели")
+	}
+	subject := fmt.Sprintf("%s: %s — %s", schedule.Title,
+		util.FormatDate(report.StartDate, "02-01-2006"), util.FormatDate(report.LastDay(), "02-01-2006"))
+	return util.SendMailRetry(s.ctx, s.mail, mailAttempts, mailDelay, to, subject, body, attachments...)
+}
+
+// departamentReport — сводка по новым и утратившим силу приказам отдела
+type departamentReport struct {
+	Title       string
+	Departament string
+	StartDate   time.Time
+	EndDate     time.Time
+	Created     []model.Order
+	Cancelled   []model.Order
+}
+
+var reportTmpl = template.Must(template.New("report").Funcs(template.FuncMap{
+	"fdate": util.FormatDate,
+}).Parse(`<h3>{{.Title}}</h3>
+<p>{{.Departament}}, период с {{fdate .StartDate "02-01-2006"}} по {{fdate .LastDay "02-01-2006"}}</p>
+{{define "orders"}}<table border="1" cellpadding="4" cellspacing="0">
+<tr><th>Тип</th><th>Вид</th><th>Штамп</th><th>Дата рег</th><th>Рег номер</th><th>Описание</th><th>Автор</th></tr>
+{{range .}}<tr><td>{{.DocType}}</td><td>{{.KindOfDoc}}</td><td>{{.DocLabel}}</td><td>{{fdate .RegDate "02-01-2006"}}</td><td>{{.RegNumber}}</td><td>{{.Description}}</td><td>{{.Username}}</td></tr>
+{{end}}</table>{{end}}
+<h4>Новые приказы: {{len .Created}}</h4>
+{{if .Created}}{{template "orders" .Created}}{{end}}
+<h4>Утратили силу: {{len .Cancelled}}</h4>
+{{if .Cancelled}}{{template "orders" .Cancelled}}{{end}}
+`))
+
+func (r departamentReport) HTML() (string, error) {
+	var buf bytes.Buffer
+	if err := reportTmpl.Execute(&buf, r); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// LastDay — последний день отчета: конец периода в отчет не входит
+func (r departamentReport) LastDay() time.Time {
+	if last := r.EndDate.AddDate(0, 0, -1); !last.Before(r.StartDate) {
+		return last
+	}
+	return r.EndDate
+}
+
+// rows — строки таблицы отчета с заголовком, общие для CSV и ODS
+func (r departamentReport) rows() [][]string {
+	rows := [][]string{{"Статус", "Тип", "Вид", "Штамп", "Дата рег", "Рег номер", "Описание", "Автор"}}
+	add := func(status string, orders []model.Order) {
+		for _, o := range orders {
+			rows = append(rows, []string{status, o.DocType, o.KindOfDoc, o.DocLabel, util.FormatDate(o.RegDate, "02-01-2006"),
+				o.RegNumber, o.Description, o.Username})
+		}
+	}
+	add("Новый", r.Created)
+	add("Утратил силу", r.Cancelled)
+	return rows
+}
+
+func (r departamentReport) CSV() ([]byte, error) {
+	var buf bytes.Buffer
+	// BOM, чтобы Excel правильно определил кодировку
+	buf.WriteString("\xEF\xBB\xBF")
+	w := csv.NewWriter(&buf)
+	w.Comma = ';'
+	w.WriteAll(r.rows())
+	return buf.Bytes(), w.Error()
+}
+
+func (r departamentReport) ODS() ([]byte, error) {
+	return util.WriteODS("Приказы", r.rows())
+}
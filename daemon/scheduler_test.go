@@ -0,0 +1,140 @@
+package daemon
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"../model"
+	"../util"
+	"../util/smtptest"
+)
+
+func TestMailReport(t *testing.T) {
+	srv, err := smtptest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	s := newScheduler(nil, util.MailConfig{Addr: srv.Addr, From: "orders@example.org"})
+	defer s.Stop()
+
+	report := departamentReport{
+		Title:       "Еженедельный отчет",
+		Departament: "Бухгалтерия",
+		StartDate:   time.Date(2019, 3, 4, 0, 0, 0, 0, time.UTC),
+		EndDate:     time.Date(2019, 3, 11, 0, 0, 0, 0, time.UTC),
+		Created:     []model.Order{{DocType: "Приказ", RegNumber: "12", Description: "О графике"}},
+	}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{model.ReportHTML, "Content-Type: text/html"},
+		{model.ReportCSV, "filename=orders-2019-03-11.csv"},
+		{model.ReportODS, "filename=orders-2019-03-11.ods"},
+	}
+	for i, tt := range tests {
+		schedule := model.Schedule{Title: report.Title, Format: tt.format, Recipients: "head@example.org, deputy@example.org"}
+		if err := s.mailReport(schedule, report); err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		messages := srv.Messages()
+		if len(messages) != i+1 {
+			t.Fatalf("%s: получено писем %d, ожидалось %d", tt.format, len(messages), i+1)
+		}
+		msg := messages[i]
+		if len(msg.To) != 2 {
+			t.Errorf("%s: получатели %v", tt.format, msg.To)
+		}
+		if !strings.Contains(msg.Data, tt.want) {
+			t.Errorf("%s: в письме нет %q", tt.format, tt.want)
+		}
+	}
+}
+
+func TestMailReportNoRecipients(t *testing.T) {
+	s := newScheduler(nil, util.MailConfig{Addr: "127.0.0.1:1"})
+	defer s.Stop()
+	if err := s.mailReport(model.Schedule{Recipients: " , "}, departamentReport{}); err == nil {
+		t.Error("без получателей ожидалась ошибка")
+	}
+}
+
+func TestReportLastDay(t *testing.T) {
+	r := departamentReport{StartDate: time.Date(2019, 3, 4, 0, 0, 0, 0, time.UTC), EndDate: time.Date(2019, 3, 11, 0, 0, 0, 0, time.UTC)}
+	if got := r.LastDay(); !got.Equal(time.Date(2019, 3, 10, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("LastDay = %s", got)
+	}
+}
+
+func TestFailureBackoff(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{1, 5 * time.Minute},
+		{2, 10 * time.Minute},
+		{3, 20 * time.Minute},
+		{10, maxFailureDelay},
+	}
+	for _, tt := range tests {
+		if got := failureBackoff(tt.failures); got != tt.want {
+			t.Errorf("failureBackoff(%d) = %s, ожидалось %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestSchedulerRetry(t *testing.T) {
+	s := newScheduler(nil, util.MailConfig{})
+	defer s.Stop()
+	spec, err := util.ParseCron("0 8 * * 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2019, 3, 11, 8, 0, 0, 0, time.UTC)
+	fail := errors.New("smtp: 451")
+
+	if !s.start(1, now) {
+		t.Fatal("первый запуск не начался")
+	}
+	if s.start(1, now) {
+		t.Fatal("второй запуск начался, пока первый не закончился")
+	}
+	if !s.start(2, now) {
+		t.Fatal("другое расписание не должно ждать первое")
+	}
+	s.finish(1, spec, now, fail)
+	if s.start(1, now.Add(time.Minute)) {
+		t.Error("повтор через минуту после неудачи")
+	}
+	if !s.start(1, now.Add(failureDelay)) {
+		t.Error("нет повтора после паузы")
+	}
+
+	// после maxFailures неудач подряд ждем следующего срока по расписанию
+	at := now
+	for i := 1; i < maxFailures; i++ {
+		if !s.start(3, at) {
+			t.Fatalf("нет повтора после %d неудач", i-1)
+		}
+		s.finish(3, spec, at, fail)
+		at = at.Add(failureBackoff(i))
+	}
+	if !s.start(3, at) {
+		t.Fatal("нет последней попытки")
+	}
+	s.finish(3, spec, at, fail)
+	next := spec.Next(at)
+	if s.start(3, next.Add(-time.Minute)) {
+		t.Error("повтор до следующего срока после исчерпания попыток")
+	}
+	if !s.start(3, next) {
+		t.Error("нет запуска в следующий срок")
+	}
+	s.finish(3, spec, next, nil)
+	if !s.start(3, next.Add(time.Minute)) {
+		t.Error("успешная отправка не сбросила паузу")
+	}
+}
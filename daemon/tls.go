@@ -0,0 +1,195 @@
+package daemon
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/kabukky/httpscerts"
+)
+
+// TLSConfig — настройки HTTPS
+type TLSConfig struct {
+	Cert       string `toml:"cert"`        // Сертификат сервера (PEM, можно с цепочкой)
+	Key        string `toml:"key"`         // Закрытый ключ сервера
+	MinVersion string `toml:"min_version"` // Минимальная версия: 1.0, 1.1, 1.2, 1.3
+	// Наборы шифров для TLS 1.0-1.2 через запятую, имена как в crypto/tls
+	// (TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256), пусто — наборы Go по умолчанию
+	Ciphers    string `toml:"ciphers"`
+	ClientCA   string `toml:"client_ca"`   // PEM с корневыми сертификатами клиентов
+	ClientAuth string `toml:"client_auth"` // Проверка клиентов: none, optional, require
+	// Хост самоподписанного сертификата, который создается, если Cert нет.
+	// Пусто — сертификат обязателен
+	SelfSigned string `toml:"self_signed"`
+	// Адрес HTTP сервера, который только перенаправляет на HTTPS, пусто — не запускать
+	RedirectListen string `toml:"redirect_listen"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"none":     tls.NoClientCert,
+	"optional": tls.VerifyClientCertIfGiven,
+	"require":  tls.RequireAndVerifyClientCert,
+}
+
+// cipherSuites возвращает идентификаторы наборов шифров по именам из настроек
+func cipherSuites(names string) ([]uint16, error) {
+	if strings.TrimSpace(names) == "" {
+		return nil, nil
+	}
+	known := map[string]uint16{}
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	ids := []uint16{}
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// Validate проверяет настройки HTTPS
+func (cfg TLSConfig) Validate() []string {
+	var errs []string
+	if cfg.Cert == "" || cfg.Key == "" {
+		errs = append(errs, "tls.cert and tls.key are required")
+	} else if cfg.SelfSigned == "" && (!fileExists(cfg.Cert) || !fileExists(cfg.Key)) {
+		errs = append(errs, fmt.Sprintf("tls: %s or %s not found, set tls.self_signed to generate a self-signed certificate", cfg.Cert, cfg.Key))
+	}
+	if _, ok := tlsVersions[cfg.MinVersion]; !ok {
+		errs = append(errs, fmt.Sprintf("tls.min_version: unknown version %q", cfg.MinVersion))
+	}
+	if _, err := cipherSuites(cfg.Ciphers); err != nil {
+		errs = append(errs, fmt.Sprintf("tls.ciphers: %v", err))
+	}
+	if _, ok := clientAuthTypes[cfg.ClientAuth]; !ok {
+		errs = append(errs, fmt.Sprintf("tls.client_auth must be none, optional or require, not %q", cfg.ClientAuth))
+	} else if cfg.ClientAuth != "none" && cfg.ClientCA == "" {
+		errs = append(errs, "tls.client_ca is required when tls.client_auth is "+cfg.ClientAuth)
+	}
+	if cfg.ClientCA != "" && !fileExists(cfg.ClientCA) {
+		errs = append(errs, fmt.Sprintf("tls.client_ca: %s not found", cfg.ClientCA))
+	}
+	if cfg.RedirectListen != "" {
+		if _, _, err := net.SplitHostPort(cfg.RedirectListen); err != nil {
+			errs = append(errs, fmt.Sprintf("tls.redirect_listen: %v", err))
+		}
+	}
+	return errs
+}
+
+// certReloader — сертификат сервера, который можно перечитать с диска по SIGHUP.
+// Новые соединения получают новый сертификат, открытые соединения не разрываются
+type certReloader struct {
+	certFile, keyFile string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload перечитывает сертификат; при ошибке остается прежний
+func (c *certReloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.cert = &cert
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// buildTLS готовит сертификат и tls.Config сервера по настройкам
+func buildTLS(cfg TLSConfig) (*tls.Config, *certReloader, error) {
+	if cfg.SelfSigned != "" {
+		if err := httpscerts.Check(cfg.Cert, cfg.Key); err != nil {
+			log.Printf("tls: %s not found, generating a self-signed certificate for %s", cfg.Cert, cfg.SelfSigned)
+			if err := httpscerts.Generate(cfg.Cert, cfg.Key, cfg.SelfSigned); err != nil {
+				return nil, nil, fmt.Errorf("не можем сгенерировать https сертификат: %v", err)
+			}
+		}
+	}
+	certs, err := newCertReloader(cfg.Cert, cfg.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	ciphers, err := cipherSuites(cfg.Ciphers)
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tlsVersions[cfg.MinVersion],
+		CipherSuites:   ciphers,
+		GetCertificate: certs.GetCertificate,
+		ClientAuth:     clientAuthTypes[cfg.ClientAuth],
+	}
+	if cfg.ClientCA != "" {
+		data, err := ioutil.ReadFile(cfg.ClientCA)
+		if err != nil {
+			return nil, nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, nil, fmt.Errorf("в %s нет сертификатов", cfg.ClientCA)
+		}
+		tlsConfig.ClientCAs = pool
+	}
+	return tlsConfig, certs, nil
+}
+
+// redirectHandler перенаправляет HTTP запросы на тот же путь по HTTPS
+func redirectHandler(httpsListen string) http.HandlerFunc {
+	_, port, _ := net.SplitHostPort(httpsListen)
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	}
+}
+
+// fileExists проверяет, есть ли файл, для путей в настройках
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
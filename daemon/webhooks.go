@@ -0,0 +1,130 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"../model"
+	"../util"
+)
+
+// Параметры доставки вебхуков: после webhookMaxAttempts неудач доставка
+// попадает в очередь недоставленных, пауза между попытками удваивается
+const (
+	webhookMaxAttempts = 8
+	webhookBaseDelay   = 30 * time.Second
+	webhookBatch       = 50
+)
+
+// webhooks в фоне отправляет доставки из очереди (таблица webhook_deliveries),
+// повторяя неудачные попытки. В очередь их ставит единица работы модели
+// в одной транзакции с изменением приказа
+type webhooks struct {
+	m      *model.Model
+	client *http.Client
+	stop   chan struct{}
+	// отменяется при остановке, чтобы прервать запросы к БД и доставки
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func startWebhooks(m *model.Model) *webhooks {
+	ctx, cancel := context.WithCancel(util.WithLogFields(context.Background(), util.Fields{"job": "webhooks"}))
+	wh := &webhooks{
+		m:      m,
+		client: &http.Client{Timeout: 15 * time.Second},
+		stop:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	go wh.loop()
+	return wh
+}
+
+func (wh *webhooks) Stop() {
+	wh.cancel()
+	close(wh.stop)
+}
+
+func (wh *webhooks) loop() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-wh.stop:
+			return
+		case now := <-ticker.C:
+			deliveries, err := wh.m.GetDueDeliveries(wh.ctx, now, webhookBatch)
+			if err != nil {
+				log.Printf("webhooks: %v", err)
+				continue
+			}
+			for _, d := range deliveries {
+				wh.deliver(d)
+			}
+		}
+	}
+}
+
+func (wh *webhooks) deliver(d model.Delivery) {
+	d.Attempts++
+	d.ResponseCode, d.LastError = 0, ""
+
+	code, err := wh.post(d)
+	d.ResponseCode = code
+	switch {
+	case err == nil:
+		d.Status = model.DeliveryDelivered
+	case d.Attempts >= webhookMaxAttempts:
+		d.Status = model.DeliveryDead
+		d.LastError = err.Error()
+	default:
+		d.LastError = err.Error()
+		d.NextAttempt = time.Now().Add(webhookBaseDelay << uint(d.Attempts-1))
+	}
+	if err := wh.m.UpdateDelivery(wh.ctx, d); err != nil {
+		log.Printf("webhooks: delivery %d: %v", d.ID, err)
+	}
+}
+
+func (wh *webhooks) post(d model.Delivery) (int, error) {
+	req, err := http.NewRequestWithContext(wh.ctx, "POST", d.URL, bytes.NewBufferString(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-DBOrders-Event", string(d.Event))
+	req.Header.Set("X-DBOrders-Delivery", strconv.FormatInt(d.ID, 10))
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("X-DBOrders-Timestamp", timestamp)
+	req.Header.Set("X-DBOrders-Signature", "sha256="+signPayload(d.Secret, timestamp, d.Payload))
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// signPayload возвращает HMAC-SHA256 строки "timestamp.payload" в шестнадцатеричном виде.
+// Время отправки входит в подпись, чтобы получатель мог отвергнуть повтор старого запроса
+func signPayload(secret, timestamp, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
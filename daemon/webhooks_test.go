@@ -0,0 +1,46 @@
+package daemon
+
+import (
+	"context"
+	"crypto/hmac"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"../model"
+)
+
+func TestWebhookSignature(t *testing.T) {
+	const secret = "s3cret"
+	var got *http.Request
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		got, body = r, string(data)
+	}))
+	defer srv.Close()
+
+	wh := &webhooks{client: srv.Client(), ctx: context.Background()}
+	d := model.Delivery{ID: 7, URL: srv.URL, Secret: secret, Event: model.OrderCreated, Payload: `{"event":"OrderCreated"}`}
+	if _, err := wh.post(d); err != nil {
+		t.Fatal(err)
+	}
+
+	timestamp := got.Header.Get("X-DBOrders-Timestamp")
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || time.Since(time.Unix(sent, 0)) > time.Minute {
+		t.Fatalf("X-DBOrders-Timestamp: %q", timestamp)
+	}
+	want := "sha256=" + signPayload(secret, timestamp, body)
+	if sig := got.Header.Get("X-DBOrders-Signature"); !hmac.Equal([]byte(sig), []byte(want)) {
+		t.Errorf("подпись %q, ожидалась %q", sig, want)
+	}
+	// подпись старого запроса не подходит к новому времени
+	if strings.TrimPrefix(want, "sha256=") == signPayload(secret, strconv.FormatInt(sent-600, 10), body) {
+		t.Error("подпись не зависит от времени отправки")
+	}
+}
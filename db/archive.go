@@ -0,0 +1,171 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"../model"
+	"../util"
+	_ "github.com/lib/pq"
+)
+
+// возвращаем все приказы во всех состояниях для выгрузки реестра
+func (p *pgDb) GetAllOrders(ctx context.Context) ([]model.Order, error) {
+	defer observeQuery("GetAllOrders", time.Now())
+	rows, err := p.dbConn.QueryContext(ctx, `SELECT id, 
+	COALESCE((SELECT name FROM hbtype WHERE hbtype.id = orders.doc_type_id), '') AS name, 
+	COALESCE((SELECT name FROM hbkind WHERE hbkind.id = orders.kind_of_doc_id), '') AS name, 
+	COALESCE((SELECT name FROM hblabel WHERE hblabel.id = orders.doc_label_id), '') AS name,
+	reg_date, reg_number, description, 
+	COALESCE((SELECT username FROM users WHERE users.id = orders.user_id), '') AS username,
+	file_original, file_copy, current, status, cancelled FROM orders ORDER BY id`)
+	if err != nil {
+		util.Errorf(ctx, "error GetAllOrders: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+	orders := []model.Order{}
+
+	for rows.Next() {
+		order := model.Order{}
+		var cancelled sql.NullTime
+		err := rows.Scan(&order.ID, &order.DocType, &order.KindOfDoc, &order.DocLabel, &order.RegDate, &order.RegNumber,
+			&order.Description, &order.Username, &order.FileOriginal, &order.FileCopy, &order.Current, &order.Status, &cancelled)
+		if err != nil {
+			util.Errorf(ctx, "error GetAllOrders: %v", err)
+			return nil, err
+		}
+		order.Cancelled = cancelled.Time
+		orders = append(orders, order)
+	}
+	return orders, rows.Err()
+}
+
+// восстанавливаем реестр из архивного пакета одной транзакцией. Приказы получают новые
+// идентификаторы, справочники, отделы и пользователи связываются по наименованиям.
+// Уже существующие справочники, отделы и пользователи (например, администратор,
+// выполняющий загрузку) сохраняются, а приказов в БД быть не должно
+func (p *pgDb) RestoreArchive(ctx context.Context, archive model.Archive) error {
+	defer observeQuery("RestoreArchive", time.Now())
+	tx, err := p.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		util.Errorf(ctx, "error RestoreArchive: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM orders").Scan(&count); err != nil {
+		util.Errorf(ctx, "error RestoreArchive: %v", err)
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("в БД уже есть приказы (%d), загрузка возможна только в пустую БД", count)
+	}
+
+	exec := func(query string, args ...interface{}) error {
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			util.Errorf(ctx, "error RestoreArchive: %v", err)
+			return err
+		}
+		return nil
+	}
+	// признак активности задается только новым записям, существующие справочники не меняются
+	for _, hb := range archive.DocTypes {
+		if err := exec("INSERT INTO hbtype (name, active) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING", hb.Name, hb.Active); err != nil {
+			return err
+		}
+	}
+	for _, hb := range archive.KindOfDocs {
+		if err := exec(`INSERT INTO hbkind (name, retention_years, active) VALUES ($1, $2, $3) 
+		ON CONFLICT (name) DO UPDATE SET retention_years = $2`, hb.Name, hb.RetentionYears, hb.Active); err != nil {
+			return err
+		}
+	}
+	for _, hb := range archive.DocLabels {
+		if err := exec("INSERT INTO hblabel (name, active) VALUES ($1, $2) ON CONFLICT (name) DO NOTHING", hb.Name, hb.Active); err != nil {
+			return err
+		}
+	}
+	// отделы вставляются без связей: вышестоящий может идти в пакете позже, а руководитель
+	// еще не восстановлен. Уже существующие отделы не меняются
+	departaments := map[int64]int64{}
+	inserted := map[int64]bool{}
+	for _, d := range archive.Departaments {
+		var id int64
+		err := tx.QueryRowContext(ctx, `INSERT INTO departaments (title, code, active) VALUES ($1, $2, $3)
+		ON CONFLICT (title) DO NOTHING RETURNING id`, d.Title, d.Code, d.Active).Scan(&id)
+		if err == sql.ErrNoRows {
+			err = tx.QueryRowContext(ctx, "SELECT id FROM departaments WHERE title = $1", d.Title).Scan(&id)
+		} else if err == nil {
+			inserted[d.ID] = true
+		}
+		if err != nil {
+			util.Errorf(ctx, "error RestoreArchive: %v", err)
+			return err
+		}
+		departaments[d.ID] = id
+	}
+	// пароли не выгружаются: восстановленные пользователи входят после смены пароля администратором
+	for _, u := range archive.Users {
+		if err := exec(`INSERT INTO users (username, password, created, email, is_admin, departament_id, role) 
+		VALUES ($1, '', $2, $3, $4, (SELECT id FROM departaments WHERE departaments.title = $5), $6) 
+		ON CONFLICT (username) DO NOTHING`, u.Username, u.Created, u.Email, u.IsAdmin, u.Title, u.Role); err != nil {
+			return err
+		}
+	}
+
+	// дерево и руководители восстановленных отделов, когда все отделы и пользователи уже есть
+	for _, d := range archive.Departaments {
+		if !inserted[d.ID] {
+			continue
+		}
+		var parent sql.NullInt64
+		if d.ParentID != 0 {
+			id, ok := departaments[d.ParentID]
+			if !ok {
+				return fmt.Errorf("отдел %q ссылается на отсутствующий вышестоящий отдел %d", d.Title, d.ParentID)
+			}
+			parent = sql.NullInt64{Int64: id, Valid: true}
+		}
+		head, err := lookupHead(ctx, tx, d.Head)
+		if err != nil {
+			util.Errorf(ctx, "error RestoreArchive: %v", err)
+			return err
+		}
+		if err := exec("UPDATE departaments SET parent_id = $2, head_id = $3 WHERE id = $1", departaments[d.ID], parent, head); err != nil {
+			return err
+		}
+	}
+
+	// справочники восстанавливаются без признака активности, поэтому он не проверяется
+	t := &pgTx{tx: tx}
+	ids := map[int64]int64{}
+	for _, order := range archive.Orders {
+		id, err := insertOrder(ctx, t, order, false)
+		if err != nil {
+			util.Errorf(ctx, "error RestoreArchive: %v", err)
+			return err
+		}
+		// в пакетах до третьей версии даты утраты силы нет, она остается пустой
+		if !order.Cancelled.IsZero() {
+			if err := exec("UPDATE orders SET cancelled = $2 WHERE id = $1", id, order.Cancelled); err != nil {
+				return err
+			}
+		}
+		ids[order.ID] = id
+	}
+	for _, s := range archive.Signatures {
+		id, ok := ids[s.OrderID]
+		if !ok {
+			return fmt.Errorf("подпись ссылается на отсутствующий приказ %d", s.OrderID)
+		}
+		if err := exec(`INSERT INTO order_signatures (order_id, file, subject, serial, signing_time, verified, error, checked) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`, id, s.File, s.Subject, s.Serial, s.SigningTime, s.Verified, s.Error, s.Checked); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
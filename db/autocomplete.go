@@ -1,29 +1,75 @@
 package db
 
 import (
+	"context"
+	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"../model"
+	"../util"
 	_ "github.com/lib/pq"
 )
 
-func (p *pgDb) Get2HBDocType(codeFragment string) ([]model.HBDocType, error) {
-	hbtypes := []model.HBDocType{}
-	rows, err := p.dbConn.Query(`SELECT id, name FROM hbtype WHERE LOWER(name) LIKE '%' || LOWER($1) || '%'`, codeFragment)
+// autocompleteColumns — таблица, столбец и условие отбора для каждого источника автозаполнения
+var autocompleteColumns = map[string]struct{ table, column, where string }{
+	model.HandbookDocType:          {"hbtype", "name", "active"},
+	model.HandbookKindOfDoc:        {"hbkind", "name", "active"},
+	model.HandbookDocLabel:         {"hblabel", "name", "active"},
+	model.AutocompleteDepartaments: {"departaments", "title", "active"},
+	model.AutocompleteUsers:        {"users", "username", "true"},
+	model.AutocompleteRegNumbers:   {"orders", "reg_number", "reg_number <> ''"},
+}
+
+// триграммные индексы для поиска по подстроке (ILIKE '%...%')
+const sqlTrigramIndexes = `
+	CREATE EXTENSION IF NOT EXISTS pg_trgm;
+	CREATE INDEX IF NOT EXISTS hbtype_name_trgm_idx ON hbtype USING gin (name gin_trgm_ops);
+	CREATE INDEX IF NOT EXISTS hbkind_name_trgm_idx ON hbkind USING gin (name gin_trgm_ops);
+	CREATE INDEX IF NOT EXISTS hblabel_name_trgm_idx ON hblabel USING gin (name gin_trgm_ops);
+	CREATE INDEX IF NOT EXISTS departaments_title_trgm_idx ON departaments USING gin (title gin_trgm_ops);
+	CREATE INDEX IF NOT EXISTS users_username_trgm_idx ON users USING gin (username gin_trgm_ops);
+	CREATE INDEX IF NOT EXISTS orders_reg_number_trgm_idx ON orders USING gin (reg_number gin_trgm_ops);
+`
+
+// createTrigramIndexes создает индексы автозаполнения. Расширение pg_trgm может быть
+// недоступно пользователю БД: тогда автозаполнение работает без индексов, медленнее
+func (p *pgDb) createTrigramIndexes() {
+	if _, err := p.dbConn.Exec(sqlTrigramIndexes); err != nil {
+		log.Printf("warning: триграммные индексы не созданы, автозаполнение без индексов: %v", err)
+	}
+}
+
+// escapeLike экранирует спецсимволы шаблона LIKE, чтобы искать введенный текст как есть
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// варианты автозаполнения: совпадения с начала строки выше совпадений в середине
+func (p *pgDb) Autocomplete(ctx context.Context, source, term string, offset, limit int) ([]string, error) {
+	defer observeQuery("Autocomplete", time.Now())
+	src, ok := autocompleteColumns[source]
+	if !ok {
+		return nil, fmt.Errorf("неизвестный источник автозаполнения %q", source)
+	}
+	items := []string{}
+	query := fmt.Sprintf(`SELECT %[2]s FROM (SELECT DISTINCT %[2]s FROM %[1]s WHERE %[3]s AND %[2]s ILIKE '%%' || $1 || '%%') AS t
+	ORDER BY %[2]s ILIKE $1 || '%%' DESC, %[2]s LIMIT $2 OFFSET $3`, src.table, src.column, src.where)
+	rows, err := p.dbConn.QueryContext(ctx, query, escapeLike(term), limit, offset)
 	if err != nil {
-		log.Printf("error GetHBDocType: %v", err)
+		util.Errorf(ctx, "error Autocomplete: %v", err)
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		hbtype := model.HBDocType{}
-		err := rows.Scan(&hbtype.ID, &hbtype.Name)
-		if err != nil {
-			log.Printf("error Get2HBDocType: %v", err)
+		var item string
+		if err := rows.Scan(&item); err != nil {
+			util.Errorf(ctx, "error Autocomplete: %v", err)
 			continue
 		}
-		hbtypes = append(hbtypes, hbtype)
+		items = append(items, item)
 	}
-	return hbtypes, nil
+	return items, nil
 }
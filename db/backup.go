@@ -0,0 +1,52 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+
+	"../util"
+	_ "github.com/lib/pq"
+)
+
+// Snapshot — согласованный снимок БД для резервного копирования. Открывает транзакцию
+// REPEATABLE READ, экспортирует ее снимок (pg_export_snapshot) для pg_dump --snapshot
+// и передает в fn список файлов, на которые в этом снимке ссылаются приказы и подписи.
+// Снимок действует, пока выполняется fn
+func (p *pgDb) Snapshot(ctx context.Context, fn func(snapshot string, files []string) error) error {
+	tx, err := p.dbConn.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		util.Errorf(ctx, "error Snapshot: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var snapshot string
+	if err := tx.QueryRowContext(ctx, "SELECT pg_export_snapshot()").Scan(&snapshot); err != nil {
+		util.Errorf(ctx, "error Snapshot: %v", err)
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT file_original FROM orders WHERE file_original <> '' 
+	UNION SELECT file_copy FROM orders WHERE file_copy <> '' 
+	UNION SELECT file FROM order_signatures WHERE file <> '' ORDER BY 1`)
+	if err != nil {
+		util.Errorf(ctx, "error Snapshot: %v", err)
+		return err
+	}
+	files := []string{}
+	for rows.Next() {
+		var file string
+		if err := rows.Scan(&file); err != nil {
+			rows.Close()
+			util.Errorf(ctx, "error Snapshot: %v", err)
+			return err
+		}
+		files = append(files, file)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		util.Errorf(ctx, "error Snapshot: %v", err)
+		return err
+	}
+	return fn(snapshot, files)
+}
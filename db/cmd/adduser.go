@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -73,7 +74,7 @@ func main() {
 
 	u := model.User{}
 
-	u, err = m.GetUserByUsername(*username)
+	u, err = m.GetUserByUsername(context.Background(), *username)
 	if err == nil {
 		fmt.Println("Updating user and promoting to admin")
 	} else {
@@ -93,7 +94,7 @@ func main() {
 			fmt.Printf("err: %s\n", err)
 			return
 		}
-		err = m.CreateUser(u)
+		err = m.CreateUser(context.Background(), u)
 		if err != nil {
 			fmt.Printf("err: %s\n", err)
 			return
@@ -110,7 +111,7 @@ func main() {
 		fmt.Printf("err: %s\n", err)
 		return
 	}
-	err = m.UpdateUser(u)
+	err = m.UpdateUser(context.Background(), u)
 	if err != nil {
 		fmt.Printf("err: %s\n", err)
 		return
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"../../db"
+	"../../model"
+)
+
+// Выгрузка и загрузка реестра архивным пакетом ZIP:
+//
+//	go run archive.go -export registry.zip
+//	go run archive.go -import registry.zip
+//
+// Загрузка возможна только в БД без приказов
+
+type Config struct {
+	ListenSpec string
+
+	Db db.Config
+}
+
+func processFlags() *Config {
+	cfg := &Config{}
+
+	flag.StringVar(&cfg.ListenSpec, "listen", "localhost:3000", "HTTP listen spec")
+	flag.StringVar(&cfg.Db.ConnectString, "db-connect", "host=localhost port=5432 user=postgres password=31yu*#km dbname=gowebapp sslmode=disable", "DB Connect String")
+
+	return cfg
+}
+
+func Run(cfg *Config) (*model.Model, error) {
+	// Инициализация соединение с БД
+	db, err := db.InitDb(cfg.Db)
+	if err != nil {
+		log.Printf("Error initializing database: %v\n", err)
+		return nil, err
+	}
+	// Создание модели БД
+	m := model.New(db)
+
+	return m, err
+}
+
+func main() {
+	cfg := processFlags()
+	export := flag.String("export", "", "write registry package to this ZIP file")
+	restore := flag.String("import", "", "restore registry package from this ZIP file into an empty DB")
+	flag.Parse()
+
+	if (*export == "") == (*restore == "") {
+		fmt.Println("Need either -export or -import")
+		os.Exit(2)
+	}
+	m, err := Run(cfg)
+	if err != nil {
+		os.Exit(1)
+	}
+
+	if *export != "" {
+		f, err := os.Create(*export)
+		if err != nil {
+			fmt.Printf("err: %s\n", err)
+			os.Exit(1)
+		}
+		archive, err := m.ExportArchive(context.Background(), f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(*export)
+			fmt.Printf("err: %s\n", err)
+			os.Exit(1)
+		}
+		for _, file := range archive.Missing {
+			fmt.Printf("нет файла: %s\n", file)
+		}
+		fmt.Printf("выгружено приказов: %d, пользователей: %d, отделов: %d\n", len(archive.Orders), len(archive.Users), len(archive.Departaments))
+		return
+	}
+
+	f, err := os.Open(*restore)
+	if err != nil {
+		fmt.Printf("err: %s\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		fmt.Printf("err: %s\n", err)
+		os.Exit(1)
+	}
+	archive, err := m.ImportArchive(context.Background(), f, info.Size())
+	if err != nil {
+		fmt.Printf("err: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("загружено приказов: %d, пользователей: %d, отделов: %d\n", len(archive.Orders), len(archive.Users), len(archive.Departaments))
+	fmt.Println("пароли пользователей не переносятся, задайте их через adduser или страницу пользователей")
+}
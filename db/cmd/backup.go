@@ -0,0 +1,436 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"../../db"
+)
+
+// Резервное копирование БД вместе с загруженными файлами:
+//
+//	go run backup.go -dir /var/backups/dborders -keep 14
+//	go run backup.go -restore /var/backups/dborders/backup-20200101-030000.tar.gz
+//
+// Архив tar.gz содержит дамп pg_dump (формат custom), снятый со снимка
+// транзакции REPEATABLE READ, файлы, на которые в этом снимке ссылаются приказы,
+// описание backup.json и контрольные суммы SHA256SUMS. Восстановление сначала
+// проверяет все контрольные суммы и только затем выполняет pg_restore
+
+const (
+	backupDump      = "dump.pgc"
+	backupMeta      = "backup.json"
+	backupChecksums = "SHA256SUMS"
+	backupFiles     = "files/"
+	backupPrefix    = "backup-"
+	backupExt       = ".tar.gz"
+)
+
+type Config struct {
+	Db db.Config
+}
+
+// Backup — описание резервной копии
+type Backup struct {
+	Created  time.Time // Время снимка
+	Snapshot string    // Идентификатор снимка PostgreSQL
+	Files    []string  // Файлы в том виде, в котором они записаны в БД
+	Missing  []string  // Файлы, отсутствовавшие на диске
+}
+
+func processFlags() *Config {
+	cfg := &Config{}
+
+	flag.StringVar(&cfg.Db.ConnectString, "db-connect", "host=localhost port=5432 user=postgres password=31yu*#km dbname=gowebapp sslmode=disable", "DB Connect String")
+
+	return cfg
+}
+
+func main() {
+	cfg := processFlags()
+	dir := flag.String("dir", "./backup", "directory for backup archives")
+	keep := flag.Int("keep", 7, "number of backup archives to keep, 0 keeps all")
+	restore := flag.String("restore", "", "restore database and files from this archive")
+	flag.Parse()
+
+	if *restore != "" {
+		if err := restoreBackup(cfg, *restore); err != nil {
+			log.Fatalf("restore: %v", err)
+		}
+		log.Printf("restored from %s", *restore)
+		return
+	}
+
+	name, err := backup(cfg, *dir)
+	if err != nil {
+		log.Fatalf("backup: %v", err)
+	}
+	log.Printf("backup written to %s", name)
+	if err := rotate(*dir, *keep); err != nil {
+		log.Fatalf("rotate: %v", err)
+	}
+}
+
+// backup снимает резервную копию в каталог dir и возвращает имя архива
+func backup(cfg *Config, dir string) (string, error) {
+	pg, err := db.InitDb(cfg.Db)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	name := filepath.Join(dir, backupPrefix+now.Format("20060102-150405")+backupExt)
+	// пишем во временный файл, чтобы незавершенная копия не попала в ротацию
+	tmp := name + ".tmp"
+
+	err = pg.Snapshot(context.Background(), func(snapshot string, files []string) error {
+		dump, err := ioutil.TempFile("", "dborders-dump")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(dump.Name())
+		dump.Close()
+
+		cmd := pgCommand(cfg.Db.ConnectString, "pg_dump", "--format=custom", "--snapshot="+snapshot, "--file="+dump.Name())
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("pg_dump: %v", err)
+		}
+
+		out, err := os.Create(tmp)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		gz := gzip.NewWriter(out)
+		tw := tar.NewWriter(gz)
+		sums := map[string]string{}
+
+		if err := addFile(tw, sums, backupDump, dump.Name()); err != nil {
+			return err
+		}
+		meta := Backup{Created: now, Snapshot: snapshot, Files: files}
+		for _, file := range files {
+			if err := addFile(tw, sums, backupName(file), file); err != nil {
+				if !os.IsNotExist(err) {
+					return err
+				}
+				log.Printf("backup: missing file %s", file)
+				meta.Missing = append(meta.Missing, file)
+			}
+		}
+		data, err := json.MarshalIndent(meta, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := addData(tw, sums, backupMeta, data); err != nil {
+			return err
+		}
+
+		// контрольные суммы последними, в формате sha256sum
+		names := make([]string, 0, len(sums))
+		for name := range sums {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var buf bytes.Buffer
+		for _, name := range names {
+			fmt.Fprintf(&buf, "%s  %s\n", sums[name], name)
+		}
+		if err := addData(tw, nil, backupChecksums, buf.Bytes()); err != nil {
+			return err
+		}
+		if err := tw.Close(); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		return out.Close()
+	})
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	return name, os.Rename(tmp, name)
+}
+
+// пароль в строке подключения вида key=value, значение может быть в кавычках
+var connPasswordRe = regexp.MustCompile(`(^|\s)password\s*=\s*('(?:[^'\\]|\\.)*'|\S+)`)
+
+// splitPassword убирает пароль из строки подключения key=value или URL postgres://
+// и возвращает его отдельно
+func splitPassword(connect string) (string, string) {
+	if strings.HasPrefix(connect, "postgres://") || strings.HasPrefix(connect, "postgresql://") {
+		u, err := url.Parse(connect)
+		if err != nil || u.User == nil {
+			return connect, ""
+		}
+		password, _ := u.User.Password()
+		u.User = url.User(u.User.Username())
+		return u.String(), password
+	}
+	var password string
+	connect = connPasswordRe.ReplaceAllStringFunc(connect, func(m string) string {
+		value := connPasswordRe.FindStringSubmatch(m)[2]
+		if strings.HasPrefix(value, "'") {
+			value = strings.NewReplacer(`\'`, `'`, `\\`, `\`).Replace(value[1 : len(value)-1])
+		}
+		password = value
+		return ""
+	})
+	return strings.TrimSpace(connect), password
+}
+
+// pgCommand готовит запуск pg_dump или pg_restore. Пароль передается через PGPASSWORD:
+// аргументы процесса видны всем пользователям в ps
+func pgCommand(connect, name string, args ...string) *exec.Cmd {
+	dsn, password := splitPassword(connect)
+	cmd := exec.Command(name, append(args, "--dbname="+dsn)...)
+	cmd.Env = os.Environ()
+	if password != "" {
+		cmd.Env = append(cmd.Env, "PGPASSWORD="+password)
+	}
+	return cmd
+}
+
+// backupName возвращает путь файла внутри архива
+func backupName(file string) string {
+	return backupFiles + strings.TrimLeft(filepath.ToSlash(filepath.Clean(file)), "/")
+}
+
+func addFile(tw *tar.Writer, sums map[string]string, name, file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: info.Size(), ModTime: info.ModTime()}); err != nil {
+		return err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tw, h), f); err != nil {
+		return err
+	}
+	sums[name] = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+func addData(tw *tar.Writer, sums map[string]string, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: time.Now()}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+	if sums != nil {
+		sum := sha256.Sum256(data)
+		sums[name] = hex.EncodeToString(sum[:])
+	}
+	return nil
+}
+
+// rotate оставляет в каталоге keep последних архивов
+func rotate(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	names, err := filepath.Glob(filepath.Join(dir, backupPrefix+"*"+backupExt))
+	if err != nil {
+		return err
+	}
+	// имена содержат время снимка, поэтому сортировка по имени — это сортировка по времени
+	sort.Strings(names)
+	for len(names) > keep {
+		log.Printf("rotate: removing %s", names[0])
+		if err := os.Remove(names[0]); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// walkBackup читает архив и вызывает fn для каждого файла
+func walkBackup(name string, fn func(h *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(h, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// verifyBackup сверяет все файлы архива с SHA256SUMS и возвращает описание копии
+func verifyBackup(name string) (Backup, error) {
+	meta := Backup{}
+	actual := map[string]string{}
+	expected := map[string]string{}
+	err := walkBackup(name, func(h *tar.Header, r io.Reader) error {
+		if h.Name == backupChecksums {
+			data, err := ioutil.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			for _, line := range strings.Split(string(data), "\n") {
+				fields := strings.SplitN(strings.TrimSpace(line), "  ", 2)
+				if len(fields) == 2 {
+					expected[fields[1]] = fields[0]
+				}
+			}
+			return nil
+		}
+		hash := sha256.New()
+		if h.Name == backupMeta {
+			data, err := ioutil.ReadAll(io.TeeReader(r, hash))
+			if err != nil {
+				return err
+			}
+			if err := json.Unmarshal(data, &meta); err != nil {
+				return err
+			}
+		} else if _, err := io.Copy(hash, r); err != nil {
+			return err
+		}
+		actual[h.Name] = hex.EncodeToString(hash.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return meta, err
+	}
+	if len(expected) == 0 {
+		return meta, fmt.Errorf("в архиве нет %s", backupChecksums)
+	}
+	for name, sum := range expected {
+		if actual[name] != sum {
+			return meta, fmt.Errorf("контрольная сумма %s не совпадает", name)
+		}
+	}
+	for name := range actual {
+		if _, ok := expected[name]; !ok {
+			return meta, fmt.Errorf("нет контрольной суммы для %s", name)
+		}
+	}
+	for _, required := range []string{backupDump, backupMeta} {
+		if _, ok := actual[required]; !ok {
+			return meta, fmt.Errorf("в архиве нет %s", required)
+		}
+	}
+	return meta, nil
+}
+
+// restoreBackup проверяет архив, восстанавливает БД через pg_restore и файлы по прежним путям.
+// Файлы распаковываются во временные рядом с местом назначения и заменяют прежние только
+// после успешного pg_restore: неудачное восстановление не портит действующие файлы
+func restoreBackup(cfg *Config, name string) error {
+	meta, err := verifyBackup(name)
+	if err != nil {
+		return err
+	}
+	// файлы возвращаются по путям, записанным в БД
+	files := map[string]string{}
+	for _, file := range meta.Files {
+		files[backupName(file)] = file
+	}
+	dump, err := ioutil.TempFile("", "dborders-dump")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dump.Name())
+	defer dump.Close()
+
+	staged := map[string]string{}
+	defer func() {
+		for _, tmp := range staged {
+			os.Remove(tmp)
+		}
+	}()
+	err = walkBackup(name, func(h *tar.Header, r io.Reader) error {
+		switch {
+		case h.Name == backupDump:
+			_, err := io.Copy(dump, r)
+			return err
+		case strings.HasPrefix(h.Name, backupFiles):
+			file, ok := files[h.Name]
+			if !ok {
+				return fmt.Errorf("файл %s не описан в %s", h.Name, backupMeta)
+			}
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				return err
+			}
+			out, err := ioutil.TempFile(filepath.Dir(file), ".restore-")
+			if err != nil {
+				return err
+			}
+			staged[file] = out.Name()
+			if _, err := io.Copy(out, r); err != nil {
+				out.Close()
+				return err
+			}
+			return out.Close()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := dump.Close(); err != nil {
+		return err
+	}
+
+	cmd := pgCommand(cfg.Db.ConnectString, "pg_restore", "--clean", "--if-exists", "--no-owner", "--single-transaction", dump.Name())
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pg_restore: %v", err)
+	}
+	for file, tmp := range staged {
+		if err := os.Rename(tmp, file); err != nil {
+			return err
+		}
+		delete(staged, file)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -55,7 +56,7 @@ func adduser(m *model.Model, username, password, email, title string, is_admin b
 	}
 
 	u := model.User{}
-	u, err := m.GetUserByUsername(username)
+	u, err := m.GetUserByUsername(context.Background(), username)
 	if err == nil {
 		u.IsAdmin = is_admin
 		u.Email = email
@@ -67,7 +68,7 @@ func adduser(m *model.Model, username, password, email, title string, is_admin b
 		}
 		u.Password = string(hash)
 		fmt.Printf("%+v\n", u)
-		err = m.UpdateUser(u)
+		err = m.UpdateUser(context.Background(), u)
 		if err != nil {
 			fmt.Printf("err: %s\n", err)
 			return
@@ -85,7 +86,7 @@ func adduser(m *model.Model, username, password, email, title string, is_admin b
 		}
 		u.Password = string(hash)
 		fmt.Printf("%+v\n", u)
-		err = m.CreateUser(u)
+		err = m.CreateUser(context.Background(), u)
 		if err != nil {
 			fmt.Printf("err: %s\n", err)
 			return
@@ -112,7 +113,7 @@ func generateOrders(m *model.Model, username string) {
 		o.Current = true                                // Флаг действия документа
 		o.Username = username                           // Автор
 
-		err := m.CreateOrder(o)
+		_, err := m.CreateOrder(context.Background(), o)
 		if err != nil {
 			fmt.Printf("err: %s\n", err)
 			return
@@ -140,10 +141,10 @@ func generateDepartaments(m *model.Model) {
 		11: "Сектор социального обслуживания семьи и детей, находящихся в трудной жизненной ситуации"}
 
 	for _, title := range titles {
-		d := model.Departament{}
+		d := model.Departament{Active: true}
 		d.Title = title
 		fmt.Printf("title: %s\n", title)
-		err := m.CreateDepartament(d)
+		err := m.CreateDepartament(context.Background(), d)
 		if err != nil {
 			fmt.Printf("err: %s\n", err)
 			return
@@ -159,7 +160,7 @@ func generateHBDocType(m *model.Model) {
 		hb := model.HBDocType{}
 		hb.Name = name
 		fmt.Printf("title: %s\n", name)
-		err := m.CreateHBDocType(hb)
+		err := m.CreateHBDocType(context.Background(), hb)
 		if err != nil {
 			fmt.Printf("err: %s\n", err)
 			return
@@ -175,7 +176,7 @@ func generateHBKindOfDoc(m *model.Model) {
 		hb := model.HBKindOfDoc{}
 		hb.Name = name
 		fmt.Printf("title: %s\n", name)
-		err := m.CreateHBKindOfDoc(hb)
+		err := m.CreateHBKindOfDoc(context.Background(), hb)
 		if err != nil {
 			fmt.Printf("err: %s\n", err)
 			return
@@ -191,7 +192,7 @@ func generateHBDocLabel(m *model.Model) {
 		hb := model.HBDocLabel{}
 		hb.Name = name
 		fmt.Printf("title: %s\n", name)
-		err := m.CreateHBDocLabel(hb)
+		err := m.CreateHBDocLabel(context.Background(), hb)
 		if err != nil {
 			fmt.Printf("err: %s\n", err)
 			return
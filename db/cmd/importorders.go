@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"../../db"
+	"../../model"
+	"../../util"
+)
+
+// Загрузка исторических приказов из таблицы CSV или ODS:
+//
+//	go run importorders.go -file orders.ods -username admin -dry-run
+//
+// Первая строка таблицы — заголовки столбцов (см. model.ImportColumns)
+
+type Config struct {
+	Db db.Config
+}
+
+func processFlags() *Config {
+	cfg := &Config{}
+
+	flag.StringVar(&cfg.Db.ConnectString, "db-connect", "host=localhost port=5432 user=postgres password=31yu*#km dbname=gowebapp sslmode=disable", "DB Connect String")
+
+	return cfg
+}
+
+func Run(cfg *Config) (*model.Model, error) {
+	// Инициализация соединение с БД
+	db, err := db.InitDb(cfg.Db)
+	if err != nil {
+		log.Printf("Error initializing database: %v\n", err)
+		return nil, err
+	}
+	// Создание модели БД
+	m := model.New(db)
+
+	return m, err
+}
+
+func main() {
+	cfg := processFlags()
+	file := flag.String("file", "", "CSV or ODS file with orders")
+	username := flag.String("username", "admin", "author of imported orders")
+	dryRun := flag.Bool("dry-run", false, "only check the file, do not write to DB")
+	createHandbooks := flag.Bool("create-handbooks", false, "add unknown doc types, kinds and labels to handbooks")
+	flag.Parse()
+
+	if *file == "" {
+		fmt.Println("Need -file")
+		os.Exit(2)
+	}
+	f, err := os.Open(*file)
+	if err != nil {
+		fmt.Printf("err: %s\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+	rows, err := util.ReadSheet(*file, f)
+	if err != nil {
+		fmt.Printf("err: %s\n", err)
+		os.Exit(1)
+	}
+
+	m, err := Run(cfg)
+	if err != nil {
+		os.Exit(1)
+	}
+	result, err := m.ImportOrders(context.Background(), rows, model.ImportOptions{DryRun: *dryRun, CreateHandbooks: *createHandbooks, Username: *username})
+	if err != nil {
+		fmt.Printf("err: %s\n", err)
+		os.Exit(1)
+	}
+
+	for _, e := range result.Errors {
+		fmt.Printf("строка %d: %s\n", e.Row, e.Message)
+	}
+	for _, name := range result.Handbooks.DocTypes {
+		fmt.Printf("новый тип документа: %s\n", name)
+	}
+	for _, name := range result.Handbooks.KindOfDocs {
+		fmt.Printf("новый вид документа: %s\n", name)
+	}
+	for _, name := range result.Handbooks.DocLabels {
+		fmt.Printf("новый штамп: %s\n", name)
+	}
+	fmt.Printf("строк: %d, ошибок: %d, загружено: %d\n", result.Total, len(result.Errors), result.Imported)
+	if len(result.Errors) > 0 {
+		os.Exit(1)
+	}
+}
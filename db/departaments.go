@@ -0,0 +1,185 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"../model"
+	"../util"
+	_ "github.com/lib/pq"
+)
+
+// выборка отделов с руководителем по имени пользователя
+const sqlSelectDepartaments = `SELECT id, COALESCE(parent_id, 0), code, title,
+	COALESCE((SELECT username FROM users WHERE users.id = departaments.head_id), ''), active FROM departaments`
+
+// sqlDepartamentSubtree возвращает запрос: отделы, выбранные условием where, и все вложенные в них.
+// UNION, а не UNION ALL, останавливает обход, если в данных все же окажется цикл
+func sqlDepartamentSubtree(where string) string {
+	return `WITH RECURSIVE sub AS (SELECT id FROM departaments WHERE ` + where + `
+		UNION SELECT d.id FROM departaments d JOIN sub ON d.parent_id = sub.id) SELECT id FROM sub`
+}
+
+// sqlDepartamentPath возвращает запрос: отдел, выбранный условием where, и все вышестоящие до корня
+func sqlDepartamentPath(where string) string {
+	return `WITH RECURSIVE up AS (SELECT id, parent_id FROM departaments WHERE ` + where + `
+		UNION SELECT d.id, d.parent_id FROM departaments d JOIN up ON d.id = up.parent_id) SELECT id FROM up`
+}
+
+// sqlVisibleAuthors возвращает условие на orders.user_id: приказы пользователя $n и сотрудников
+// отделов, которыми он руководит, включая вложенные отделы
+func sqlVisibleAuthors(n int) string {
+	return fmt.Sprintf(`user_id IN (SELECT id FROM users WHERE username = $%[1]d OR departament_id IN (%[2]s))`,
+		n, sqlDepartamentSubtree(fmt.Sprintf("head_id = (SELECT id FROM users WHERE username = $%d)", n)))
+}
+
+// руководитель отдела по имени пользователя; пустое имя — не назначен, неизвестное — ошибка
+func lookupHead(ctx context.Context, q queryer, username string) (sql.NullInt64, error) {
+	return lookupRef(ctx, q, "SELECT id, true FROM users WHERE username = $1", "Руководитель", username, false)
+}
+
+func (p *pgDb) CreateDepartament(ctx context.Context, departament model.Departament) error {
+	defer observeQuery("CreateDepartament", time.Now())
+	head, err := lookupHead(ctx, p.dbConn, departament.Head)
+	if err != nil {
+		util.Errorf(ctx, "error CreateDepartament: %v", err)
+		return err
+	}
+	_, err = p.dbConn.ExecContext(ctx, `INSERT INTO departaments (title, code, parent_id, head_id, active)
+	VALUES ($1, $2, NULLIF($3, 0), $4, $5)`,
+		departament.Title, departament.Code, departament.ParentID, head, departament.Active)
+	if err != nil {
+		util.Errorf(ctx, "error CreateDepartament: %v", err)
+		return err
+	}
+	return err
+}
+
+func (p *pgDb) GetDepartaments(ctx context.Context) ([]model.Departament, error) {
+	defer observeQuery("GetDepartaments", time.Now())
+	departaments := []model.Departament{}
+	rows, err := p.dbConn.QueryContext(ctx, sqlSelectDepartaments+` ORDER BY title`)
+	if err != nil {
+		util.Errorf(ctx, "error GetDepartament: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		departament := model.Departament{}
+		err := rows.Scan(&departament.ID, &departament.ParentID, &departament.Code, &departament.Title, &departament.Head, &departament.Active)
+		if err != nil {
+			util.Errorf(ctx, "error GetDepartament: %v", err)
+			continue
+		}
+		departaments = append(departaments, departament)
+	}
+	return departaments, nil
+}
+
+func (p *pgDb) GetDepartament(ctx context.Context, departamentID int64) (model.Departament, error) {
+	defer observeQuery("GetDepartament", time.Now())
+	row := p.dbConn.QueryRowContext(ctx, sqlSelectDepartaments+` WHERE id = $1`, departamentID)
+
+	departament := model.Departament{}
+	err := row.Scan(&departament.ID, &departament.ParentID, &departament.Code, &departament.Title, &departament.Head, &departament.Active)
+	if err != nil {
+		util.Errorf(ctx, "error GetDepartament: %v", err)
+		return departament, err
+	}
+	return departament, err
+}
+
+func (p *pgDb) UpdateDepartament(ctx context.Context, departament model.Departament) error {
+	defer observeQuery("UpdateDepartament", time.Now())
+	head, err := lookupHead(ctx, p.dbConn, departament.Head)
+	if err != nil {
+		util.Errorf(ctx, "error UpdateDepartament: %v", err)
+		return err
+	}
+	_, err = p.dbConn.ExecContext(ctx, `UPDATE departaments SET title = $1, code = $2, parent_id = NULLIF($3, 0),
+	head_id = $4, active = $5 WHERE id = $6`,
+		departament.Title, departament.Code, departament.ParentID, head, departament.Active, departament.ID)
+	if err != nil {
+		util.Errorf(ctx, "error UpdateDepartament: %v", err)
+		return err
+	}
+	return err
+}
+
+// удаляем отдел одной транзакцией: сотрудники, рассылки и подписки переходят в reassignTo,
+// вложенные отделы — в вышестоящий удаляемого
+func (p *pgDb) DeleteDepartament(ctx context.Context, id, reassignTo int64) error {
+	defer observeQuery("DeleteDepartament", time.Now())
+	tx, err := p.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		util.Errorf(ctx, "error DeleteDepartament: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	exec := func(query string, args ...interface{}) error {
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			util.Errorf(ctx, "error DeleteDepartament: %v", err)
+			return err
+		}
+		return nil
+	}
+	for _, query := range []string{
+		`UPDATE users SET departament_id = $2 WHERE departament_id = $1`,
+		`UPDATE schedules SET departament_id = $2 WHERE departament_id = $1`,
+		`UPDATE subscriptions SET departament_id = $2 WHERE departament_id = $1`,
+	} {
+		if err := exec(query, id, reassignTo); err != nil {
+			return err
+		}
+	}
+	if err := exec(`UPDATE departaments SET parent_id = (SELECT parent_id FROM departaments WHERE id = $1) WHERE parent_id = $1`, id); err != nil {
+		return err
+	}
+	if err := exec(`DELETE FROM departaments WHERE id = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// загружаем оргструктуру одной транзакцией: сначала отделы по коду (отдел без кода
+// с тем же наименованием получает код), затем связи с вышестоящими, когда все коды уже есть
+func (p *pgDb) ImportOrgChart(ctx context.Context, departaments []model.OrgImportRow) error {
+	defer observeQuery("ImportOrgChart", time.Now())
+	tx, err := p.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		util.Errorf(ctx, "error ImportOrgChart: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	exec := func(query string, args ...interface{}) error {
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			util.Errorf(ctx, "error ImportOrgChart: %v", err)
+			return err
+		}
+		return nil
+	}
+	for _, d := range departaments {
+		if err := exec(`UPDATE departaments SET code = $1 WHERE title = $2 AND code = ''
+		AND NOT EXISTS (SELECT 1 FROM departaments WHERE code = $1)`, d.Code, d.Title); err != nil {
+			return err
+		}
+		if err := exec(`INSERT INTO departaments (code, title, head_id, active)
+		VALUES ($1, $2, (SELECT id FROM users WHERE users.username = $3), $4)
+		ON CONFLICT (code) WHERE code <> '' DO UPDATE SET title = $2, head_id = EXCLUDED.head_id, active = $4`,
+			d.Code, d.Title, d.Head, d.Active); err != nil {
+			return err
+		}
+	}
+	for _, d := range departaments {
+		if err := exec(`UPDATE departaments SET parent_id = (SELECT id FROM departaments WHERE code = NULLIF($2, ''))
+		WHERE code = $1`, d.Code, d.ParentCode); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
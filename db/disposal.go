@@ -0,0 +1,245 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"../model"
+	"../util"
+	_ "github.com/lib/pq"
+)
+
+// дата истечения срока хранения приказа, см. model.DisposalDueDate
+const sqlDisposalDueDate = `make_date(date_part('year', orders.reg_date)::int + 1 + hbkind.retention_years, 1, 1)`
+
+// включаем в формируемый акт приказы, срок хранения которых истек к дате now
+// и которые еще не попали ни в один акт. Возвращаем акт и количество добавленных документов
+func (p *pgDb) BuildDisposalAct(ctx context.Context, now time.Time) (int64, int, error) {
+	defer observeQuery("BuildDisposalAct", time.Now())
+	tx, err := p.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		util.Errorf(ctx, "error BuildDisposalAct: %v", err)
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	from := `FROM orders 
+	JOIN hbkind ON hbkind.id = orders.kind_of_doc_id 
+	LEFT JOIN hbtype ON hbtype.id = orders.doc_type_id 
+	WHERE orders.status = 'registered' AND hbkind.retention_years > 0 AND ` + sqlDisposalDueDate + ` <= $1 
+	AND NOT EXISTS (SELECT 1 FROM disposal_act_items JOIN disposal_acts ON disposal_acts.id = disposal_act_items.act_id 
+		WHERE disposal_act_items.order_id = orders.id AND disposal_acts.status <> 'purged')`
+
+	var count int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) `+from, util.FormatDate(now, "2006-01-02")).Scan(&count); err != nil {
+		util.Errorf(ctx, "error BuildDisposalAct: %v", err)
+		return 0, 0, err
+	}
+	if count == 0 {
+		return 0, 0, nil
+	}
+
+	var actID int64
+	err = tx.QueryRowContext(ctx, `SELECT id FROM disposal_acts WHERE status = 'draft' ORDER BY id LIMIT 1 FOR UPDATE`).Scan(&actID)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRowContext(ctx, `INSERT INTO disposal_acts (created, status) VALUES (now(), 'draft') RETURNING id`).Scan(&actID)
+	}
+	if err != nil {
+		util.Errorf(ctx, "error BuildDisposalAct: %v", err)
+		return 0, 0, err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO disposal_act_items (act_id, order_id, doc_type, kind_of_doc, reg_date, reg_number, description, due_date) 
+	SELECT $2, orders.id, COALESCE(hbtype.name, ''), hbkind.name, orders.reg_date, orders.reg_number, orders.description, `+sqlDisposalDueDate+` `+from,
+		util.FormatDate(now, "2006-01-02"), actID)
+	if err != nil {
+		util.Errorf(ctx, "error BuildDisposalAct: %v", err)
+		return 0, 0, err
+	}
+	// новая версия: утверждение ранее просмотренной версии акта не пройдет
+	if _, err := tx.ExecContext(ctx, `UPDATE disposal_acts SET version = version + 1 WHERE id = $1`, actID); err != nil {
+		util.Errorf(ctx, "error BuildDisposalAct: %v", err)
+		return 0, 0, err
+	}
+	return actID, count, tx.Commit()
+}
+
+func (p *pgDb) GetDisposalActs(ctx context.Context) ([]model.DisposalAct, error) {
+	defer observeQuery("GetDisposalActs", time.Now())
+	acts := []model.DisposalAct{}
+	rows, err := p.dbConn.QueryContext(ctx, `SELECT id, created, status, version, 
+	COALESCE((SELECT username FROM users WHERE users.id = disposal_acts.approver_id), ''), approved, comment, 
+	(SELECT COUNT(*) FROM disposal_act_items WHERE disposal_act_items.act_id = disposal_acts.id AND NOT excluded) 
+	FROM disposal_acts ORDER BY id DESC`)
+	if err != nil {
+		util.Errorf(ctx, "error GetDisposalActs: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		act := model.DisposalAct{}
+		var approved sql.NullTime
+		err := rows.Scan(&act.ID, &act.Created, &act.Status, &act.Version, &act.Approver, &approved, &act.Comment, &act.Count)
+		if err != nil {
+			util.Errorf(ctx, "error GetDisposalActs: %v", err)
+			continue
+		}
+		act.Approved = approved.Time
+		acts = append(acts, act)
+	}
+	return acts, nil
+}
+
+func (p *pgDb) GetDisposalAct(ctx context.Context, id int64) (model.DisposalAct, error) {
+	defer observeQuery("GetDisposalAct", time.Now())
+	act := model.DisposalAct{}
+	var approved sql.NullTime
+	err := p.dbConn.QueryRowContext(ctx, `SELECT id, created, status, version, 
+	COALESCE((SELECT username FROM users WHERE users.id = disposal_acts.approver_id), ''), approved, comment 
+	FROM disposal_acts WHERE id = $1`, id).Scan(&act.ID, &act.Created, &act.Status, &act.Version, &act.Approver, &approved, &act.Comment)
+	if err != nil {
+		util.Errorf(ctx, "error GetDisposalAct: %v", err)
+		return act, err
+	}
+	act.Approved = approved.Time
+
+	rows, err := p.dbConn.QueryContext(ctx, `SELECT id, act_id, COALESCE(order_id, 0), doc_type, kind_of_doc, reg_date, reg_number, description, due_date 
+	FROM disposal_act_items WHERE act_id = $1 AND NOT excluded ORDER BY due_date, reg_date`, id)
+	if err != nil {
+		util.Errorf(ctx, "error GetDisposalAct: %v", err)
+		return act, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := model.DisposalItem{}
+		err := rows.Scan(&item.ID, &item.ActID, &item.OrderID, &item.DocType, &item.KindOfDoc, &item.RegDate,
+			&item.RegNumber, &item.Description, &item.DueDate)
+		if err != nil {
+			util.Errorf(ctx, "error GetDisposalAct: %v", err)
+			continue
+		}
+		act.Items = append(act.Items, item)
+	}
+	act.Count = len(act.Items)
+	return act, nil
+}
+
+// утверждаем просмотренную версию акта и в той же транзакции удаляем его приказы.
+// Если акт успел измениться (добавлены или исключены документы), ничего не делаем.
+// Возвращаем файлы удаленных приказов, на которые не ссылаются оставшиеся приказы:
+// удалить их с диска можно только после фиксации
+func (p *pgDb) ApproveDisposalAct(ctx context.Context, id int64, version int, username, comment string) ([]string, error) {
+	defer observeQuery("ApproveDisposalAct", time.Now())
+	tx, err := p.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		util.Errorf(ctx, "error ApproveDisposalAct: %v", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE disposal_acts SET status = 'approved', approved = now(), comment = $1, 
+	approver_id = (SELECT id FROM users WHERE users.username = $2) WHERE id = $3 AND status = 'draft' AND version = $4`,
+		comment, username, id, version)
+	if err != nil {
+		util.Errorf(ctx, "error ApproveDisposalAct: %v", err)
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("акт %d не найден, уже утвержден или изменился после просмотра", id)
+	}
+	files, err := purgeDisposalAct(ctx, tx, id)
+	if err != nil {
+		util.Errorf(ctx, "error ApproveDisposalAct: %v", err)
+		return nil, err
+	}
+	return files, tx.Commit()
+}
+
+// удаляем приказы акта (подписи и журнал удаляются каскадно) и отмечаем акт исполненным
+func purgeDisposalAct(ctx context.Context, tx *sql.Tx, id int64) ([]string, error) {
+	const orderIDs = `SELECT order_id FROM disposal_act_items WHERE act_id = $1 AND NOT excluded AND order_id IS NOT NULL`
+	rows, err := tx.QueryContext(ctx, `SELECT file_original FROM orders WHERE id IN (`+orderIDs+`) 
+	UNION SELECT file_copy FROM orders WHERE id IN (`+orderIDs+`) 
+	UNION SELECT file FROM order_signatures WHERE order_id IN (`+orderIDs+`)`, id)
+	if err != nil {
+		return nil, err
+	}
+	candidates := []string{}
+	for rows.Next() {
+		var file string
+		if err := rows.Scan(&file); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if file != "" {
+			candidates = append(candidates, file)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM orders WHERE id IN (`+orderIDs+`)`, id); err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE disposal_acts SET status = 'purged' WHERE id = $1`, id); err != nil {
+		return nil, err
+	}
+
+	// один файл могли прикрепить к нескольким приказам: файлы оставшихся приказов не трогаем
+	files := []string{}
+	for _, file := range candidates {
+		var used bool
+		err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE file_original = $1 OR file_copy = $1) 
+		OR EXISTS (SELECT 1 FROM order_signatures WHERE file = $1)`, file).Scan(&used)
+		if err != nil {
+			return nil, err
+		}
+		if !used {
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// исключаем документ из формируемого акта и увеличиваем версию акта; повторно
+// в акты документ не попадет, пока акт не будет исполнен
+func (p *pgDb) ExcludeDisposalItem(ctx context.Context, actID, itemID int64) error {
+	defer observeQuery("ExcludeDisposalItem", time.Now())
+	tx, err := p.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		util.Errorf(ctx, "error ExcludeDisposalItem: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `UPDATE disposal_acts SET version = version + 1 WHERE id = $1 AND status = 'draft'`, actID)
+	if err != nil {
+		util.Errorf(ctx, "error ExcludeDisposalItem: %v", err)
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("акт %d не найден или уже утвержден", actID)
+	}
+	_, err = tx.ExecContext(ctx, `UPDATE disposal_act_items SET excluded = true WHERE id = $1 AND act_id = $2`, itemID, actID)
+	if err != nil {
+		util.Errorf(ctx, "error ExcludeDisposalItem: %v", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *pgDb) UpdateHBKindOfDocRetention(ctx context.Context, id int64, retentionYears int) error {
+	defer observeQuery("UpdateHBKindOfDocRetention", time.Now())
+	_, err := p.dbConn.ExecContext(ctx, "UPDATE hbkind SET retention_years = $1 WHERE id = $2", retentionYears, id)
+	if err != nil {
+		util.Errorf(ctx, "error UpdateHBKindOfDocRetention: %v", err)
+		return err
+	}
+	return err
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"../model"
+	"../util"
+	_ "github.com/lib/pq"
+)
+
+// столбцы orders со ссылками на справочники; имена таблиц подставляются
+// в запросы только после проверки по этому списку
+var handbookColumns = map[string]string{
+	model.HandbookDocType:   "doc_type_id",
+	model.HandbookKindOfDoc: "kind_of_doc_id",
+	model.HandbookDocLabel:  "doc_label_id",
+}
+
+func handbookColumn(handbook string) (string, error) {
+	column, ok := handbookColumns[handbook]
+	if !ok {
+		return "", fmt.Errorf("неизвестный справочник %q", handbook)
+	}
+	return column, nil
+}
+
+func (p *pgDb) GetHandbookEntries(ctx context.Context, handbook string) ([]model.HandbookEntry, error) {
+	defer observeQuery("GetHandbookEntries", time.Now())
+	column, err := handbookColumn(handbook)
+	if err != nil {
+		return nil, err
+	}
+	entries := []model.HandbookEntry{}
+	rows, err := p.dbConn.QueryContext(ctx, fmt.Sprintf(`SELECT id, name, active,
+	(SELECT COUNT(*) FROM orders WHERE orders.%s = %s.id) FROM %s ORDER BY name`, column, handbook, handbook))
+	if err != nil {
+		util.Errorf(ctx, "error GetHandbookEntries: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry := model.HandbookEntry{}
+		err := rows.Scan(&entry.ID, &entry.Name, &entry.Active, &entry.Orders)
+		if err != nil {
+			util.Errorf(ctx, "error GetHandbookEntries: %v", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// переименовываем запись; вебхуки фильтруют по наименованию вида документа,
+// поэтому их фильтр переименовываем в той же транзакции
+func (p *pgDb) RenameHandbookEntry(ctx context.Context, handbook string, id int64, name string) error {
+	defer observeQuery("RenameHandbookEntry", time.Now())
+	if _, err := handbookColumn(handbook); err != nil {
+		return err
+	}
+	tx, err := p.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		util.Errorf(ctx, "error RenameHandbookEntry: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var old string
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT name FROM %s WHERE id = $1 FOR UPDATE`, handbook), id).Scan(&old)
+	if err != nil {
+		util.Errorf(ctx, "error RenameHandbookEntry: %v", err)
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET name = $1 WHERE id = $2`, handbook), name, id); err != nil {
+		util.Errorf(ctx, "error RenameHandbookEntry: %v", err)
+		return err
+	}
+	if handbook == model.HandbookKindOfDoc {
+		if _, err := tx.ExecContext(ctx, `UPDATE webhooks SET kind_of_doc = $1 WHERE kind_of_doc = $2`, name, old); err != nil {
+			util.Errorf(ctx, "error RenameHandbookEntry: %v", err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (p *pgDb) SetHandbookEntryActive(ctx context.Context, handbook string, id int64, active bool) error {
+	defer observeQuery("SetHandbookEntryActive", time.Now())
+	if _, err := handbookColumn(handbook); err != nil {
+		return err
+	}
+	_, err := p.dbConn.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET active = $1 WHERE id = $2`, handbook), active, id)
+	if err != nil {
+		util.Errorf(ctx, "error SetHandbookEntryActive: %v", err)
+		return err
+	}
+	return err
+}
+
+// объединяем записи в одной транзакции: приказы, подписки и фильтры вебхуков
+// переходят на intoID, после чего запись fromID удаляется. Если на нее осталась
+// ссылка, которую мы не перенесли, удаление остановит ON DELETE RESTRICT
+func (p *pgDb) MergeHandbookEntries(ctx context.Context, handbook string, fromID, intoID int64) error {
+	defer observeQuery("MergeHandbookEntries", time.Now())
+	column, err := handbookColumn(handbook)
+	if err != nil {
+		return err
+	}
+	tx, err := p.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		util.Errorf(ctx, "error MergeHandbookEntries: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var from, into string
+	err = tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT name FROM %s WHERE id = $1 FOR UPDATE`, handbook), fromID).Scan(&from)
+	if err == nil {
+		err = tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT name FROM %s WHERE id = $1 FOR UPDATE`, handbook), intoID).Scan(&into)
+	}
+	if err != nil {
+		util.Errorf(ctx, "error MergeHandbookEntries: %v", err)
+		return err
+	}
+
+	exec := func(query string, args ...interface{}) error {
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			util.Errorf(ctx, "error MergeHandbookEntries: %v", err)
+			return err
+		}
+		return nil
+	}
+	if err := exec(fmt.Sprintf(`UPDATE orders SET %s = $1 WHERE %s = $2`, column, column), intoID, fromID); err != nil {
+		return err
+	}
+	switch handbook {
+	case model.HandbookDocType:
+		err = exec(`UPDATE subscriptions SET doc_type_id = $1 WHERE doc_type_id = $2`, intoID, fromID)
+	case model.HandbookKindOfDoc:
+		err = exec(`UPDATE webhooks SET kind_of_doc = $1 WHERE kind_of_doc = $2`, into, from)
+	}
+	if err != nil {
+		return err
+	}
+	if err := exec(fmt.Sprintf(`DELETE FROM %s WHERE id = $1`, handbook), fromID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"../model"
+	"../util"
+	_ "github.com/lib/pq"
+)
+
+// загружаем приказы одной транзакцией вместе с новыми наименованиями справочников.
+// Неизвестное или отключенное наименование и уже занятый номер отменяют всю загрузку
+func (p *pgDb) ImportOrders(ctx context.Context, orders []model.Order, handbooks model.ImportHandbooks) error {
+	defer observeQuery("ImportOrders", time.Now())
+	tx, err := p.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		util.Errorf(ctx, "error ImportOrders: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	for table, names := range map[string][]string{
+		"hbtype":  handbooks.DocTypes,
+		"hbkind":  handbooks.KindOfDocs,
+		"hblabel": handbooks.DocLabels,
+	} {
+		for _, name := range names {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO "+table+" (name) VALUES ($1)", name); err != nil {
+				util.Errorf(ctx, "error ImportOrders: %v", err)
+				return err
+			}
+		}
+	}
+
+	t := &pgTx{tx: tx}
+	for _, order := range orders {
+		if _, err := insertOrder(ctx, t, order, true); err != nil {
+			util.Errorf(ctx, "error ImportOrders: %v", err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
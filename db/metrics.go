@@ -0,0 +1,21 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"../util"
+)
+
+var dbQueryDuration = util.Metrics.NewHistogram("dborders_db_query_duration_seconds",
+	"Duration of pgDb methods.", util.DefBuckets, "method")
+
+// observeQuery учитывает длительность метода pgDb: defer observeQuery("GetOrder", time.Now())
+func observeQuery(method string, start time.Time) {
+	dbQueryDuration.Observe(time.Since(start).Seconds(), method)
+}
+
+// Stats возвращает статистику пула соединений для метрик
+func (p *pgDb) Stats() sql.DBStats {
+	return p.dbConn.Stats()
+}
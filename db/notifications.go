@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"../model"
+	"../util"
+	_ "github.com/lib/pq"
+)
+
+func (p *pgDb) CreateNotification(ctx context.Context, notification model.Notification) error {
+	defer observeQuery("CreateNotification", time.Now())
+	_, err := p.dbConn.ExecContext(ctx, `INSERT INTO notifications (user_id, event, order_id, message, created) VALUES ($1, $2, NULLIF($3, 0), $4, now())`,
+		&notification.UserID, &notification.Event, &notification.OrderID, &notification.Message)
+	if err != nil {
+		util.Errorf(ctx, "error CreateNotification: %v", err)
+		return err
+	}
+	return err
+}
+
+func (p *pgDb) GetNotifications(ctx context.Context, userID int64, limit int) ([]model.Notification, error) {
+	defer observeQuery("GetNotifications", time.Now())
+	notifications := []model.Notification{}
+	rows, err := p.dbConn.QueryContext(ctx, `SELECT id, user_id, event, COALESCE(order_id, 0), message, created, read 
+	FROM notifications WHERE user_id = $1 ORDER BY created DESC LIMIT $2`, userID, limit)
+	if err != nil {
+		util.Errorf(ctx, "error GetNotifications: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		notification := model.Notification{}
+		err := rows.Scan(&notification.ID, &notification.UserID, &notification.Event, &notification.OrderID,
+			&notification.Message, &notification.Created, &notification.Read)
+		if err != nil {
+			util.Errorf(ctx, "error GetNotifications: %v", err)
+			continue
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, nil
+}
+
+func (p *pgDb) GetCountUnreadNotifications(ctx context.Context, userID int64) (int, error) {
+	defer observeQuery("GetCountUnreadNotifications", time.Now())
+	rows, err := p.dbConn.QueryContext(ctx, "SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND NOT read", userID)
+	if err != nil {
+		util.Errorf(ctx, "error GetCountUnreadNotifications: %v", err)
+		return 0, err
+	}
+	defer rows.Close()
+	return checkCount(rows), err
+}
+
+func (p *pgDb) MarkNotificationsRead(ctx context.Context, userID int64) error {
+	defer observeQuery("MarkNotificationsRead", time.Now())
+	_, err := p.dbConn.ExecContext(ctx, "UPDATE notifications SET read = true WHERE user_id = $1 AND NOT read", userID)
+	if err != nil {
+		util.Errorf(ctx, "error MarkNotificationsRead: %v", err)
+		return err
+	}
+	return err
+}
+
+func (p *pgDb) GetSubscriptions(ctx context.Context, userID int64) ([]model.Subscription, error) {
+	defer observeQuery("GetSubscriptions", time.Now())
+	subscriptions := []model.Subscription{}
+	rows, err := p.dbConn.QueryContext(ctx, `SELECT subscriptions.id, users.id, users.username, users.email, 
+	COALESCE(hbtype.name, ''), COALESCE(departaments.title, ''), subscriptions.by_email 
+	FROM subscriptions 
+	JOIN users ON users.id = subscriptions.user_id 
+	LEFT JOIN hbtype ON hbtype.id = subscriptions.doc_type_id 
+	LEFT JOIN departaments ON departaments.id = subscriptions.departament_id 
+	WHERE subscriptions.user_id = $1 ORDER BY subscriptions.id`, userID)
+	if err != nil {
+		util.Errorf(ctx, "error GetSubscriptions: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		subscription := model.Subscription{}
+		err := rows.Scan(&subscription.ID, &subscription.UserID, &subscription.Username, &subscription.Email,
+			&subscription.DocType, &subscription.Departament, &subscription.ByEmail)
+		if err != nil {
+			util.Errorf(ctx, "error GetSubscriptions: %v", err)
+			continue
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, nil
+}
+
+// возвращаем подписчиков на приказ данного типа, автор которого работает в данном отделе.
+// Подписка на отдел охватывает вложенные отделы, поэтому годится любой отдел на пути автора к корню.
+// Для каждого пользователя одна строка, ByEmail — если хотя бы одна подписка требует почту
+func (p *pgDb) GetSubscribers(ctx context.Context, docType, username string) ([]model.Subscription, error) {
+	defer observeQuery("GetSubscribers", time.Now())
+	subscriptions := []model.Subscription{}
+	rows, err := p.dbConn.QueryContext(ctx, `SELECT users.id, users.username, users.email, bool_or(subscriptions.by_email) 
+	FROM subscriptions 
+	JOIN users ON users.id = subscriptions.user_id 
+	WHERE (subscriptions.doc_type_id IS NULL OR subscriptions.doc_type_id = (SELECT id FROM hbtype WHERE hbtype.name = $1)) 
+	AND (subscriptions.departament_id IS NULL OR subscriptions.departament_id IN (`+sqlDepartamentPath("id = (SELECT departament_id FROM users WHERE users.username = $2)")+`)) 
+	GROUP BY users.id, users.username, users.email`, docType, username)
+	if err != nil {
+		util.Errorf(ctx, "error GetSubscribers: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		subscription := model.Subscription{}
+		err := rows.Scan(&subscription.UserID, &subscription.Username, &subscription.Email, &subscription.ByEmail)
+		if err != nil {
+			util.Errorf(ctx, "error GetSubscribers: %v", err)
+			continue
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	return subscriptions, nil
+}
+
+// пустой тип документа или отдел — подписка на все; не найденное наименование — ошибка,
+// иначе опечатка молча превратилась бы в подписку на все приказы
+func (p *pgDb) CreateSubscription(ctx context.Context, subscription model.Subscription) error {
+	defer observeQuery("CreateSubscription", time.Now())
+	docType, err := lookupRef(ctx, p.dbConn, "SELECT id, active FROM hbtype WHERE name = $1", "Тип документа", subscription.DocType, false)
+	if err != nil {
+		util.Errorf(ctx, "error CreateSubscription: %v", err)
+		return err
+	}
+	departament, err := lookupRef(ctx, p.dbConn, "SELECT id, active FROM departaments WHERE title = $1", "Отдел", subscription.Departament, true)
+	if err != nil {
+		util.Errorf(ctx, "error CreateSubscription: %v", err)
+		return err
+	}
+	_, err = p.dbConn.ExecContext(ctx, `INSERT INTO subscriptions (user_id, doc_type_id, departament_id, by_email) VALUES ($1, $2, $3, $4)`,
+		subscription.UserID, docType, departament, subscription.ByEmail)
+	if err != nil {
+		util.Errorf(ctx, "error CreateSubscription: %v", err)
+		return err
+	}
+	return err
+}
+
+// удаляем подписку, только если она принадлежит пользователю
+func (p *pgDb) DeleteSubscription(ctx context.Context, id, userID int64) error {
+	defer observeQuery("DeleteSubscription", time.Now())
+	_, err := p.dbConn.ExecContext(ctx, "DELETE from subscriptions where id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		util.Errorf(ctx, "error DeleteSubscription: %v", err)
+		return err
+	}
+	return err
+}
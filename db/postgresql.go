@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
@@ -15,7 +16,7 @@ import (
 
 // Config is ...
 type Config struct {
-	ConnectString string
+	ConnectString string `toml:"connect_string"`
 }
 
 // InitDb is ...
@@ -31,10 +32,21 @@ func InitDb(cfg Config) (*pgDb, error) {
 		if err := p.createTablesIfNotExist(); err != nil {
 			return nil, err
 		}
+		p.createTrigramIndexes()
 		return p, nil
 	}
 }
 
+// Ping проверяет соединение с БД для /healthz и /readyz
+func (p *pgDb) Ping(ctx context.Context) error {
+	return p.dbConn.PingContext(ctx)
+}
+
+// Close закрывает пул соединений после остановки HTTP сервера
+func (p *pgDb) Close() error {
+	return p.dbConn.Close()
+}
+
 type pgDb struct {
 	dbConn         *sqlx.DB
 	prefix         string
@@ -61,7 +73,7 @@ func (p *pgDb) createTablesIfNotExist() error {
 		email TEXT NOT NULL,
 		is_admin BOOLEAN NOT NULL DEFAULT false,
 		departament_id SERIAL NOT NULL,
-		FOREIGN KEY (departament_id) REFERENCES departaments (id) ON DELETE CASCADE);
+		FOREIGN KEY (departament_id) REFERENCES departaments (id) ON DELETE RESTRICT);
 	
 	-- hbkind
 
@@ -95,9 +107,192 @@ func (p *pgDb) createTablesIfNotExist() error {
 		file_original TEXT NOT NULL,
 		file_copy TEXT NOT NULL,
 		current BOOLEAN NOT NULL DEFAULT false,
+		FOREIGN KEY (doc_type_id) REFERENCES hbtype (id) ON DELETE RESTRICT,
+		FOREIGN KEY (kind_of_doc_id) REFERENCES hbkind (id) ON DELETE RESTRICT,
+		FOREIGN KEY (doc_label_id) REFERENCES hblabel (id) ON DELETE RESTRICT);
+
+		ALTER TABLE orders ADD COLUMN IF NOT EXISTS cancelled DATE;
+		ALTER TABLE orders ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'registered';
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT '';
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS password_changed TIMESTAMP NOT NULL DEFAULT now();
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS must_change_password BOOLEAN NOT NULL DEFAULT false;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret TEXT NOT NULL DEFAULT '';
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT false;
+		ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+		ALTER TABLE hbkind ADD COLUMN IF NOT EXISTS retention_years INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE hbtype ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT true;
+		ALTER TABLE hbkind ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT true;
+		ALTER TABLE hblabel ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT true;
+
+		ALTER TABLE departaments ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES departaments (id) ON DELETE RESTRICT;
+		ALTER TABLE departaments ADD COLUMN IF NOT EXISTS code TEXT NOT NULL DEFAULT '';
+		ALTER TABLE departaments ADD COLUMN IF NOT EXISTS head_id INTEGER REFERENCES users (id) ON DELETE SET NULL;
+		ALTER TABLE departaments ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT true;
+		CREATE UNIQUE INDEX IF NOT EXISTS departaments_code_idx ON departaments (code) WHERE code <> '';
+
+		-- записи справочников не удаляются вместе с приказами: их отключают или объединяют;
+		-- сотрудники удаляемого отдела переводятся в другой, а не удаляются вместе с ним
+		DO $$
+		DECLARE fk RECORD;
+		BEGIN
+			FOR fk IN SELECT * FROM (VALUES
+				('orders_doc_type_id_fkey', 'orders', 'doc_type_id', 'hbtype'),
+				('orders_kind_of_doc_id_fkey', 'orders', 'kind_of_doc_id', 'hbkind'),
+				('orders_doc_label_id_fkey', 'orders', 'doc_label_id', 'hblabel'),
+				('users_departament_id_fkey', 'users', 'departament_id', 'departaments')) AS t(name, tbl, col, ref)
+			LOOP
+				IF EXISTS (SELECT 1 FROM pg_constraint WHERE conname = fk.name AND confdeltype = 'c') THEN
+					EXECUTE format('ALTER TABLE %I DROP CONSTRAINT %I, ADD CONSTRAINT %I FOREIGN KEY (%I) REFERENCES %I (id) ON DELETE RESTRICT',
+						fk.tbl, fk.name, fk.name, fk.col, fk.ref);
+				END IF;
+			END LOOP;
+		END $$;
+
+		CREATE INDEX IF NOT EXISTS orders_reg_date_id_idx ON orders (reg_date DESC, id DESC);
+
+	-- user_preferences
+
+	   CREATE TABLE IF NOT EXISTS user_preferences (
+		user_id INTEGER NOT NULL PRIMARY KEY,
+		page_size INTEGER NOT NULL,
+		sort_by TEXT NOT NULL,
+		sort_desc BOOLEAN NOT NULL DEFAULT true,
+		hidden_columns TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE);
+
+	-- order_transitions
+
+	   CREATE TABLE IF NOT EXISTS order_transitions (
+		id SERIAL NOT NULL PRIMARY KEY,
+		order_id INTEGER NOT NULL,
+		from_status TEXT NOT NULL,
+		to_status TEXT NOT NULL,
+		user_id INTEGER NOT NULL,
+		comment TEXT NOT NULL DEFAULT '',
+		created TIMESTAMP NOT NULL DEFAULT now(),
+		FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE CASCADE,
+		FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE);
+
+	-- reg_numbers: последний выданный регистрационный номер в году
+
+	   CREATE TABLE IF NOT EXISTS reg_numbers (
+		year INTEGER NOT NULL PRIMARY KEY,
+		last BIGINT NOT NULL);
+
+	-- order_signatures
+
+	   CREATE TABLE IF NOT EXISTS order_signatures (
+		order_id INTEGER NOT NULL PRIMARY KEY,
+		file TEXT NOT NULL,
+		subject TEXT NOT NULL DEFAULT '',
+		serial TEXT NOT NULL DEFAULT '',
+		signing_time TIMESTAMP NOT NULL,
+		verified BOOLEAN NOT NULL DEFAULT false,
+		error TEXT NOT NULL DEFAULT '',
+		checked TIMESTAMP NOT NULL DEFAULT now(),
+		FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE CASCADE);
+
+	-- schedules
+
+	   CREATE TABLE IF NOT EXISTS schedules (
+		id SERIAL NOT NULL PRIMARY KEY,
+		title TEXT NOT NULL,
+		spec TEXT NOT NULL,
+		format TEXT NOT NULL DEFAULT 'html',
+		departament_id INTEGER NOT NULL,
+		recipients TEXT NOT NULL,
+		last_run TIMESTAMP,
+		active BOOLEAN NOT NULL DEFAULT true,
+		FOREIGN KEY (departament_id) REFERENCES departaments (id) ON DELETE CASCADE);
+
+	-- disposal_acts
+
+	   CREATE TABLE IF NOT EXISTS disposal_acts (
+		id SERIAL NOT NULL PRIMARY KEY,
+		created TIMESTAMP NOT NULL DEFAULT now(),
+		status TEXT NOT NULL DEFAULT 'draft',
+		approver_id INTEGER,
+		approved TIMESTAMP,
+		comment TEXT NOT NULL DEFAULT '',
+		FOREIGN KEY (approver_id) REFERENCES users (id) ON DELETE SET NULL);
+
+	   ALTER TABLE disposal_acts ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 0;
+
+	   CREATE TABLE IF NOT EXISTS disposal_act_items (
+		id SERIAL NOT NULL PRIMARY KEY,
+		act_id INTEGER NOT NULL,
+		order_id INTEGER,
+		doc_type TEXT NOT NULL,
+		kind_of_doc TEXT NOT NULL,
+		reg_date DATE NOT NULL,
+		reg_number TEXT NOT NULL,
+		description TEXT NOT NULL,
+		due_date DATE NOT NULL,
+		excluded BOOLEAN NOT NULL DEFAULT false,
+		FOREIGN KEY (act_id) REFERENCES disposal_acts (id) ON DELETE CASCADE,
+		FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE SET NULL);
+
+	-- notifications
+
+	   CREATE TABLE IF NOT EXISTS notifications (
+		id SERIAL NOT NULL PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		event TEXT NOT NULL,
+		order_id INTEGER,
+		message TEXT NOT NULL,
+		created TIMESTAMP NOT NULL DEFAULT now(),
+		read BOOLEAN NOT NULL DEFAULT false,
+		FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+		FOREIGN KEY (order_id) REFERENCES orders (id) ON DELETE CASCADE);
+
+		CREATE INDEX IF NOT EXISTS notifications_user_read_idx ON notifications (user_id, read);
+
+	-- subscriptions
+
+	   CREATE TABLE IF NOT EXISTS subscriptions (
+		id SERIAL NOT NULL PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		doc_type_id INTEGER,
+		departament_id INTEGER,
+		by_email BOOLEAN NOT NULL DEFAULT false,
+		FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
 		FOREIGN KEY (doc_type_id) REFERENCES hbtype (id) ON DELETE CASCADE,
-		FOREIGN KEY (kind_of_doc_id) REFERENCES hbkind (id) ON DELETE CASCADE,
-		FOREIGN KEY (doc_label_id) REFERENCES hblabel (id) ON DELETE CASCADE);
+		FOREIGN KEY (departament_id) REFERENCES departaments (id) ON DELETE CASCADE);
+
+	-- recovery_codes
+
+	   CREATE TABLE IF NOT EXISTS recovery_codes (
+		id SERIAL NOT NULL PRIMARY KEY,
+		user_id INTEGER NOT NULL,
+		code_hash TEXT NOT NULL,
+		used TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE);
+
+	-- webhooks
+
+	   CREATE TABLE IF NOT EXISTS webhooks (
+		id SERIAL NOT NULL PRIMARY KEY,
+		title TEXT NOT NULL,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT NOT NULL DEFAULT '',
+		kind_of_doc TEXT NOT NULL DEFAULT '',
+		active BOOLEAN NOT NULL DEFAULT true);
+
+	   CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id SERIAL NOT NULL PRIMARY KEY,
+		webhook_id INTEGER NOT NULL,
+		event TEXT NOT NULL,
+		payload TEXT NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt TIMESTAMP NOT NULL DEFAULT now(),
+		response_code INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		created TIMESTAMP NOT NULL DEFAULT now(),
+		FOREIGN KEY (webhook_id) REFERENCES webhooks (id) ON DELETE CASCADE);
+
+		CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (status, next_attempt);
     `
 	if rows, err := p.dbConn.Query(create_sql); err != nil {
 		log.Printf("error: %v", err)
@@ -118,21 +313,24 @@ func checkCount(rows *sql.Rows) (count int) {
 	return count
 }
 
-func (p *pgDb) GetUsers() ([]model.User, error) {
+func (p *pgDb) GetUsers(ctx context.Context) ([]model.User, error) {
+	defer observeQuery("GetUsers", time.Now())
 	users := []model.User{}
-	rows, err := p.dbConn.Query(`SELECT id, username, password, created, email, is_admin, 
-	(SELECT title FROM departaments WHERE departaments.id = users.departament_id) AS title FROM users`)
+	rows, err := p.dbConn.QueryContext(ctx, `SELECT id, username, password, created, email, is_admin, 
+	(SELECT title FROM departaments WHERE departaments.id = users.departament_id) AS title, role,
+	password_changed, must_change_password, totp_enabled FROM users`)
 	if err != nil {
-		log.Printf("error GetUsers: %v", err)
+		util.Errorf(ctx, "error GetUsers: %v", err)
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		user := model.User{}
-		err := rows.Scan(&user.ID, &user.Username, &user.Password, &user.Created, &user.Email, &user.IsAdmin, &user.Title)
+		err := rows.Scan(&user.ID, &user.Username, &user.Password, &user.Created, &user.Email, &user.IsAdmin, &user.Title, &user.Role,
+			&user.PasswordChanged, &user.MustChangePassword, &user.TOTPEnabled)
 		if err != nil {
-			log.Printf("error GetUsers: %v", err)
+			util.Errorf(ctx, "error GetUsers: %v", err)
 			continue
 		}
 		users = append(users, user)
@@ -140,73 +338,102 @@ func (p *pgDb) GetUsers() ([]model.User, error) {
 	return users, nil
 }
 
-func (p *pgDb) GetUser(userID int64) (model.User, error) {
-	row := p.dbConn.QueryRow(`SELECT id, username, created, email, is_admin, 
-	(SELECT title FROM departaments WHERE departaments.id = users.departament_id) AS title FROM users WHERE id = $1`, userID)
+func (p *pgDb) GetUser(ctx context.Context, userID int64) (model.User, error) {
+	defer observeQuery("GetUser", time.Now())
+	row := p.dbConn.QueryRowContext(ctx, `SELECT id, username, created, email, is_admin, 
+	(SELECT title FROM departaments WHERE departaments.id = users.departament_id) AS title, role,
+	password_changed, must_change_password, totp_enabled FROM users WHERE id = $1`, userID)
 
 	user := model.User{}
-	err := row.Scan(&user.ID, &user.Username, &user.Created, &user.Email, &user.IsAdmin, &user.Title)
+	err := row.Scan(&user.ID, &user.Username, &user.Created, &user.Email, &user.IsAdmin, &user.Title, &user.Role,
+		&user.PasswordChanged, &user.MustChangePassword, &user.TOTPEnabled)
 	if err != nil {
-		log.Printf("error GetUser: %v", err)
+		util.Errorf(ctx, "error GetUser: %v", err)
 		return user, err
 	}
 	return user, err
 }
 
-func (p *pgDb) CreateUser(user model.User) error {
-	_, err := p.dbConn.Exec(`INSERT INTO users (username, password, created, email, is_admin, departament_id) VALUES ($1, $2, $3, $4, $5, (SELECT id FROM departaments WHERE departaments.title = $6))`,
-		&user.Username, &user.Password, &user.Created, &user.Email, &user.IsAdmin, &user.Title)
+func (p *pgDb) CreateUser(ctx context.Context, user model.User) error {
+	defer observeQuery("CreateUser", time.Now())
+	return createUser(ctx, p.dbConn, "CreateUser", user)
+}
+
+func createUser(ctx context.Context, q queryer, name string, user model.User) error {
+	_, err := q.ExecContext(ctx, `INSERT INTO users (username, password, created, email, is_admin, departament_id, role) VALUES ($1, $2, $3, $4, $5, (SELECT id FROM departaments WHERE departaments.title = $6), $7)`,
+		&user.Username, &user.Password, &user.Created, &user.Email, &user.IsAdmin, &user.Title, &user.Role)
 
 	if err != nil {
-		log.Printf("error CreateUser: %v", err)
+		util.Errorf(ctx, "error %s: %v", name, err)
 		return err
 	}
 	return err
 }
 
-func (p *pgDb) UpdateUser(user model.User) error {
-	_, err := p.dbConn.Exec(`UPDATE users set username = $1, password = $2, created = $3, email = $4, is_admin = $5, 
-	departament_id = (SELECT id FROM departaments WHERE departaments.title = $6) WHERE id = $7`,
-		&user.Username, &user.Password, &user.Created, &user.Email, &user.IsAdmin, &user.Title, &user.ID)
+func (p *pgDb) UpdateUser(ctx context.Context, user model.User) error {
+	defer observeQuery("UpdateUser", time.Now())
+	// пустой пароль означает «не менять»: GetUser пароль не возвращает
+	_, err := p.dbConn.ExecContext(ctx, `UPDATE users set username = $1, password = COALESCE(NULLIF($2, ''), password),
+	password_changed = CASE WHEN $2 = '' THEN password_changed ELSE now() END, created = $3, email = $4, is_admin = $5, 
+	departament_id = (SELECT id FROM departaments WHERE departaments.title = $6), role = $7 WHERE id = $8`,
+		&user.Username, &user.Password, &user.Created, &user.Email, &user.IsAdmin, &user.Title, &user.Role, &user.ID)
 
 	if err != nil {
-		log.Printf("error UpdateUser: %v", err)
+		util.Errorf(ctx, "error UpdateUser: %v", err)
 		return err
 	}
 	return err
 }
 
-func (p *pgDb) DeleteUser(id int64) error {
-	_, err := p.dbConn.Exec("DELETE from users where id = $1", id)
+// новый хеш пароля и требование сменить его при следующем входе; пустой хеш оставляет пароль прежним
+func (p *pgDb) SetPassword(ctx context.Context, id int64, hash string, mustChange bool) error {
+	defer observeQuery("SetPassword", time.Now())
+	_, err := p.dbConn.ExecContext(ctx, `UPDATE users SET password = COALESCE(NULLIF($2, ''), password),
+	password_changed = CASE WHEN $2 = '' THEN password_changed ELSE now() END, must_change_password = $3 WHERE id = $1`,
+		id, hash, mustChange)
 	if err != nil {
-		log.Printf("error DeleteUser: %v", err)
+		util.Errorf(ctx, "error SetPassword: %v", err)
 		return err
 	}
 	return err
 }
 
-func (p *pgDb) GetUserByUsername(username string) (model.User, error) {
-	row := p.dbConn.QueryRow(`SELECT id, username, password, created, email, is_admin, 
-	(SELECT title FROM departaments WHERE departaments.id = users.departament_id) AS title FROM users WHERE username = $1`, username)
+func (p *pgDb) DeleteUser(ctx context.Context, id int64) error {
+	defer observeQuery("DeleteUser", time.Now())
+	_, err := p.dbConn.ExecContext(ctx, "DELETE from users where id = $1", id)
+	if err != nil {
+		util.Errorf(ctx, "error DeleteUser: %v", err)
+		return err
+	}
+	return err
+}
+
+func (p *pgDb) GetUserByUsername(ctx context.Context, username string) (model.User, error) {
+	defer observeQuery("GetUserByUsername", time.Now())
+	row := p.dbConn.QueryRowContext(ctx, `SELECT id, username, password, created, email, is_admin, 
+	(SELECT title FROM departaments WHERE departaments.id = users.departament_id) AS title, role,
+	password_changed, must_change_password, totp_enabled FROM users WHERE username = $1`, username)
 	user := model.User{}
-	err := row.Scan(&user.ID, &user.Username, &user.Password, &user.Created, &user.Email, &user.IsAdmin, &user.Title)
+	err := row.Scan(&user.ID, &user.Username, &user.Password, &user.Created, &user.Email, &user.IsAdmin, &user.Title, &user.Role,
+		&user.PasswordChanged, &user.MustChangePassword, &user.TOTPEnabled)
 	if err != nil {
-		log.Printf("error GetUserByUsername: %v", err)
+		util.Errorf(ctx, "error GetUserByUsername: %v", err)
 		return user, err
 	}
 	return user, err
 }
 
-func (p *pgDb) GetOrders(limit, offset int) ([]model.Order, error) {
-	rows, err := p.dbConn.Query(`SELECT id, 
+func (p *pgDb) GetOrders(ctx context.Context, limit, offset int) ([]model.Order, error) {
+	defer observeQuery("GetOrders", time.Now())
+	rows, err := p.dbConn.QueryContext(ctx, `SELECT id, 
 	(SELECT name FROM hbtype WHERE hbtype.id = orders.doc_type_id) AS name, 
 	(SELECT name FROM hbkind WHERE hbkind.id = orders.kind_of_doc_id) AS name, 
 	(SELECT name FROM hblabel WHERE hblabel.id = orders.doc_label_id) AS name,
 	reg_date, reg_number, description, 
 	(SELECT username FROM users WHERE users.id = orders.user_id) AS username,
-	file_original, file_copy, current FROM orders ORDER BY reg_date DESC LIMIT $1 OFFSET $2`, limit, offset)
+	file_original, file_copy, current, status FROM orders WHERE status = 'registered' ORDER BY reg_date DESC LIMIT $1 OFFSET $2`, limit, offset)
 	if err != nil {
-		log.Printf("error GetOrders: %v", err)
+		util.Errorf(ctx, "error GetOrders: %v", err)
 	}
 	defer rows.Close()
 	orders := []model.Order{}
@@ -214,9 +441,9 @@ func (p *pgDb) GetOrders(limit, offset int) ([]model.Order, error) {
 	for rows.Next() {
 		order := model.Order{}
 		err := rows.Scan(&order.ID, &order.DocType, &order.KindOfDoc, &order.DocLabel, &order.RegDate, &order.RegNumber,
-			&order.Description, &order.Username, &order.FileOriginal, &order.FileCopy, &order.Current)
+			&order.Description, &order.Username, &order.FileOriginal, &order.FileCopy, &order.Current, &order.Status)
 		if err != nil {
-			log.Printf("error GetOrders: %v", err)
+			util.Errorf(ctx, "error GetOrders: %v", err)
 			continue
 		}
 		orders = append(orders, order)
@@ -224,64 +451,39 @@ func (p *pgDb) GetOrders(limit, offset int) ([]model.Order, error) {
 	return orders, err
 }
 
-// возвращаем пользователю страницу для редактирования объекта
-func (p *pgDb) GetOrder(id int64) (model.Order, error) {
-
-	row := p.dbConn.QueryRow(`SELECT id, 
+// выборка приказа по id с наименованиями справочников и автора
+const sqlSelectOrder = `SELECT id, 
 	(SELECT name FROM hbtype WHERE hbtype.id = orders.doc_type_id) AS name, 
 	(SELECT name FROM hbkind WHERE hbkind.id = orders.kind_of_doc_id) AS name, 
 	(SELECT name FROM hblabel WHERE hblabel.id = orders.doc_label_id) AS name,
 	reg_date, reg_number, description, 
 	(SELECT username FROM users WHERE users.id = orders.user_id) AS username,
-	file_original, file_copy, current FROM orders where id = $1`, id)
+	file_original, file_copy, current, status FROM orders where id = $1`
+
+// возвращаем пользователю страницу для редактирования объекта
+func (p *pgDb) GetOrder(ctx context.Context, id int64) (model.Order, error) {
+	defer observeQuery("GetOrder", time.Now())
+	return getOrder(ctx, p.dbConn, "GetOrder", sqlSelectOrder, id)
+}
+
+func getOrder(ctx context.Context, q queryer, method, query string, id int64) (model.Order, error) {
+	row := q.QueryRowContext(ctx, query, id)
 	order := model.Order{}
 	err := row.Scan(&order.ID, &order.DocType, &order.KindOfDoc, &order.DocLabel, &order.RegDate, &order.RegNumber,
-		&order.Description, &order.Username, &order.FileOriginal, &order.FileCopy, &order.Current)
+		&order.Description, &order.Username, &order.FileOriginal, &order.FileCopy, &order.Current, &order.Status)
 
 	if err != nil {
-		log.Printf("error GetOrder: %v", err)
+		util.Errorf(ctx, "error %s: %v", method, err)
 		return order, err
 	}
 	return order, err
 }
 
-func (p *pgDb) DeleteOrder(id int64) error {
-	_, err := p.dbConn.Exec("DELETE from orders where id = $1", id)
-	if err != nil {
-		log.Printf("error DeleteOrder: %v", err)
-		return err
-	}
-	return err
-}
-
-// получаем измененные данные и сохраняем их в БД
-func (p *pgDb) UpdateOrder(order model.Order) error {
-	_, err := p.dbConn.Exec(`UPDATE orders SET 
-	(SELECT id FROM hbtype WHERE hbtype.name = $1), 
-	(SELECT id FROM hbkind WHERE hbkind.name = $2), 
-	(SELECT id FROM hblabel WHERE hblabel.name = $3)
-	reg_date = $4, reg_number = $5, description = $6, user_id = (SELECT id FROM users WHERE users.username = $7), 
-	file_original = $8, file_copy = $9, current = $10 WHERE id = $11`,
-		&order.DocType, &order.KindOfDoc, &order.DocLabel, &order.RegDate, &order.RegNumber, &order.Description,
-		&order.Username, &order.FileOriginal, &order.FileCopy, &order.Current, &order.ID)
-
+func (p *pgDb) DeleteOrder(ctx context.Context, id int64) error {
+	defer observeQuery("DeleteOrder", time.Now())
+	_, err := p.dbConn.ExecContext(ctx, "DELETE from orders where id = $1", id)
 	if err != nil {
-		log.Printf("error UpdateOrder: %v", err)
-		return err
-	}
-	return err
-}
-
-func (p *pgDb) CreateOrder(order model.Order) error {
-	_, err := p.dbConn.Exec(`INSERT INTO orders (doc_type_id, kind_of_doc_id, doc_label_id, reg_date, reg_number, description, user_id, 
-			file_original, file_copy, current) VALUES (
-			(SELECT id FROM hbtype WHERE hbtype.name = $1), 
-			(SELECT id FROM hbkind WHERE hbkind.name = $2), 
-			(SELECT id FROM hblabel WHERE hblabel.name = $3), 
-			$4, $5, $6, (SELECT id FROM users WHERE users.username = $7), $8, $9, $10)`,
-		&order.DocType, &order.KindOfDoc, &order.DocLabel, &order.RegDate, &order.RegNumber, &order.Description, &order.Username, &order.FileOriginal, &order.FileCopy, &order.Current)
-	if err != nil {
-		log.Printf("error CreateOrder: %v", err)
+		util.Errorf(ctx, "error DeleteOrder: %v", err)
 		return err
 	}
 	return err
@@ -289,57 +491,71 @@ func (p *pgDb) CreateOrder(order model.Order) error {
 
 //WHERE DateField BETWEEN to_date('2010-01-01','YYYY-MM-DD') AND to_date('2010-01-02','YYYY-MM-DD')
 
-// возвращаем количество приказов в промежутки дат
-func (p *pgDb) GetDateOrders(startDate, endDate time.Time, limit, offset int) ([]model.Order, error) {
-	rows, err := p.dbConn.Query(`SELECT id, 
-	(SELECT name FROM hbtype WHERE hbtype.id = orders.doc_type_id) AS name, 
-	(SELECT name FROM hbkind WHERE hbkind.id = orders.kind_of_doc_id) AS name, 
-	(SELECT name FROM hblabel WHERE hblabel.id = orders.doc_label_id) AS name, 
-	reg_date, reg_number, description, 
-	(SELECT username FROM users WHERE orders.user_id = users.id) AS username,
-	file_original, file_copy, current FROM orders WHERE reg_date BETWEEN $1 AND $2 ORDER BY reg_date DESC LIMIT $3 OFFSET $4`, util.FormatDate(startDate, "2006-01-02"), util.FormatDate(endDate, "2006-01-02"), limit, offset)
-
-	orders := []model.Order{}
-	if err != nil {
-		log.Printf("error GetDateOrders: %v", err)
-		return orders, err
-	}
-	for rows.Next() {
-		order := model.Order{}
-		err := rows.Scan(&order.ID, &order.DocType, &order.KindOfDoc, &order.DocLabel, &order.RegDate, &order.RegNumber,
-			&order.Description, &order.Username, &order.FileOriginal, &order.FileCopy, &order.Current)
-		if err != nil {
-			log.Printf("error GetDateOrders: %v", err)
-			continue
-		}
-		orders = append(orders, order)
-	}
-	return orders, err
-}
-
-// возвращаем количество приказов в промежутки дат
-func (p *pgDb) GetDateUserByUsername(startDate, endDate time.Time, username string, limit, offset int) ([]model.Order, error) {
-	rows, err := p.dbConn.Query(`SELECT id, 
+// выражения столбцов сортировки списков приказов
+var orderSortColumns = map[string]string{
+	model.ColumnRegDate:   "reg_date",
+	model.ColumnRegNumber: "reg_number",
+	model.ColumnDocType:   "COALESCE((SELECT name FROM hbtype WHERE hbtype.id = orders.doc_type_id), '')",
+	model.ColumnKindOfDoc: "COALESCE((SELECT name FROM hbkind WHERE hbkind.id = orders.kind_of_doc_id), '')",
+	model.ColumnDocLabel:  "COALESCE((SELECT name FROM hblabel WHERE hblabel.id = orders.doc_label_id), '')",
+	model.ColumnUsername:  "COALESCE((SELECT username FROM users WHERE users.id = orders.user_id), '')",
+}
+
+// возвращаем страницу приказов за период, упорядоченных по (sortBy, id).
+// С курсором выбираем строки после (или перед) граничной строкой по ключу, иначе со смещением.
+// Без username — все зарегистрированные приказы, иначе все приказы автора
+func (p *pgDb) GetOrdersPage(ctx context.Context, startDate, endDate time.Time, username, sortBy string, sortDesc bool, cursor util.Cursor, offset, limit int) ([]model.Order, error) {
+	defer observeQuery("GetOrdersPage", time.Now())
+	where := []string{"reg_date BETWEEN $1 AND $2"}
+	args := []interface{}{util.FormatDate(startDate, "2006-01-02"), util.FormatDate(endDate, "2006-01-02")}
+	if username != "" {
+		args = append(args, username)
+		where = append(where, sqlVisibleAuthors(len(args)))
+	} else {
+		where = append(where, "status = 'registered'")
+	}
+	column, ok := orderSortColumns[sortBy]
+	if !ok {
+		column, sortDesc = "reg_date", true
+	}
+	keyType := "text"
+	if column == "reg_date" {
+		keyType = "date"
+	}
+	// при выборке назад направление сортировки меняется, строки переворачивает модель
+	desc := sortDesc != cursor.Before
+	dir, cmp := "ASC", ">"
+	if desc {
+		dir, cmp = "DESC", "<"
+	}
+	order := fmt.Sprintf("%s %s, id %s", column, dir, dir)
+	if !cursor.IsZero() {
+		args = append(args, cursor.Key, cursor.ID)
+		where = append(where, fmt.Sprintf("(%s, id) %s ($%d::%s, $%d)", column, cmp, len(args)-1, keyType, len(args)))
+		offset = 0
+	}
+	args = append(args, limit, offset)
+	rows, err := p.dbConn.QueryContext(ctx, fmt.Sprintf(`SELECT id, 
 	(SELECT name FROM hbtype WHERE hbtype.id = orders.doc_type_id) AS name, 
 	(SELECT name FROM hbkind WHERE hbkind.id = orders.kind_of_doc_id) AS name, 
 	(SELECT name FROM hblabel WHERE hblabel.id = orders.doc_label_id) AS name, 
 	reg_date, reg_number, description, 
 	(SELECT username FROM users WHERE orders.user_id = users.id) AS username,
-	file_original, file_copy, current FROM orders WHERE reg_date BETWEEN $1 AND $2 
-	AND user_id = (SELECT id FROM users WHERE users.username = $3) ORDER BY reg_date DESC LIMIT $4 OFFSET $5`,
-		util.FormatDate(startDate, "2006-01-02"), util.FormatDate(endDate, "2006-01-02"), username, limit, offset)
+	file_original, file_copy, current, status FROM orders WHERE %s ORDER BY %s LIMIT $%d OFFSET $%d`,
+		strings.Join(where, " AND "), order, len(args)-1, len(args)), args...)
 
 	orders := []model.Order{}
 	if err != nil {
-		log.Printf("error GetDateOrders: %v", err)
+		util.Errorf(ctx, "error GetOrdersPage: %v", err)
 		return orders, err
 	}
+	defer rows.Close()
 	for rows.Next() {
 		order := model.Order{}
 		err := rows.Scan(&order.ID, &order.DocType, &order.KindOfDoc, &order.DocLabel, &order.RegDate, &order.RegNumber,
-			&order.Description, &order.Username, &order.FileOriginal, &order.FileCopy, &order.Current)
+			&order.Description, &order.Username, &order.FileOriginal, &order.FileCopy, &order.Current, &order.Status)
 		if err != nil {
-			log.Printf("error GetDateOrders: %v", err)
+			util.Errorf(ctx, "error GetOrdersPage: %v", err)
 			continue
 		}
 		orders = append(orders, order)
@@ -348,24 +564,27 @@ func (p *pgDb) GetDateUserByUsername(startDate, endDate time.Time, username stri
 }
 
 // возвращаем количество приказов в промежутки дат
-func (p *pgDb) GetCountDateOrdersByUsername(startDate, endDate time.Time, username string) (int, error) {
-	rows, err := p.dbConn.Query("SELECT COUNT(*) FROM orders WHERE reg_date BETWEEN $1 AND $2 AND user_id = (SELECT id FROM users WHERE users.username = $3)", util.FormatDate(startDate, "2006-01-02"), util.FormatDate(endDate, "2006-01-02"), username)
+func (p *pgDb) GetCountDateOrdersByUsername(ctx context.Context, startDate, endDate time.Time, username string) (int, error) {
+	defer observeQuery("GetCountDateOrdersByUsername", time.Now())
+	rows, err := p.dbConn.QueryContext(ctx, "SELECT COUNT(*) FROM orders WHERE reg_date BETWEEN $1 AND $2 AND "+sqlVisibleAuthors(3), util.FormatDate(startDate, "2006-01-02"), util.FormatDate(endDate, "2006-01-02"), username)
 	if err != nil {
-		log.Printf("error GetCountDateOrders: %v", err)
-		return checkCount(rows), err
+		util.Errorf(ctx, "error GetCountDateOrders: %v", err)
+		return 0, err
 	}
-	return checkCount(rows), err
+	defer rows.Close()
+	return checkCount(rows), rows.Err()
 }
 
 // возвращаем количество приказов в промежутки дат
 // Идея: Формирование запроса из кусков в зависимости от того что приходит в функицю
-func (p *pgDb) GetSearchOrders(order model.Order, startDate, endDate time.Time) ([]model.Order, error) {
+func (p *pgDb) GetSearchOrders(ctx context.Context, order model.Order, startDate, endDate time.Time) ([]model.Order, error) {
+	defer observeQuery("GetSearchOrders", time.Now())
 	var sqlQiery string
 
 	sqlQierySelect := `SELECT id, (SELECT name FROM hbtype WHERE hbtype.id = orders.doc_type_id), (SELECT name FROM hbkind WHERE hbkind.id = orders.kind_of_doc_id), (SELECT name FROM hblabel WHERE hblabel.id = orders.doc_label_id), 
-	reg_date, reg_number, description, (SELECT username FROM users WHERE orders.user_id = users.id), file_original, file_copy, current FROM orders`
+	reg_date, reg_number, description, (SELECT username FROM users WHERE orders.user_id = users.id), file_original, file_copy, current, status FROM orders`
 
-	sqlQieryRegDate := fmt.Sprintf("%s %s", sqlQierySelect, "WHERE reg_date >= $1 AND reg_date <= $2")
+	sqlQieryRegDate := fmt.Sprintf("%s %s", sqlQierySelect, "WHERE reg_date >= $1 AND reg_date <= $2 AND status = 'registered'")
 
 	elements := make(map[string]string)
 	elements[fmt.Sprintf("%s %s %s", " INTERSECT", sqlQierySelect, "WHERE doc_type_id = (SELECT id FROM hbtype WHERE hbtype.name =")] = order.DocType
@@ -390,17 +609,17 @@ func (p *pgDb) GetSearchOrders(order model.Order, startDate, endDate time.Time)
 	}
 	orders := []model.Order{}
 	sqlQiery = fmt.Sprintf("%s %s %s", sqlQieryRegDate, strings.Join(orderParams[:], " "), "ORDER BY reg_date DESC")
-	rows, err := p.dbConn.Query(fmt.Sprintf("%s", sqlQiery), orderValues...)
+	rows, err := p.dbConn.QueryContext(ctx, fmt.Sprintf("%s", sqlQiery), orderValues...)
 	if err != nil {
-		log.Printf("error GetSearchOrders: %v", err)
+		util.Errorf(ctx, "error GetSearchOrders: %v", err)
 		return orders, err
 	}
 	for rows.Next() {
 		order := model.Order{}
 		err := rows.Scan(&order.ID, &order.DocType, &order.KindOfDoc, &order.DocLabel, &order.RegDate, &order.RegNumber,
-			&order.Description, &order.Username, &order.FileOriginal, &order.FileCopy, &order.Current)
+			&order.Description, &order.Username, &order.FileOriginal, &order.FileCopy, &order.Current, &order.Status)
 		if err != nil {
-			log.Printf("error GetSearchOrders: %v", err)
+			util.Errorf(ctx, "error GetSearchOrders: %v", err)
 			continue
 		}
 		orders = append(orders, order)
@@ -409,98 +628,42 @@ func (p *pgDb) GetSearchOrders(order model.Order, startDate, endDate time.Time)
 }
 
 // возвращаем количество приказов в промежутки дат
-func (p *pgDb) GetCountDateOrders(startDate, endDate time.Time) (int, error) {
-	rows, err := p.dbConn.Query("SELECT COUNT(*) FROM orders WHERE reg_date BETWEEN $1 AND $2", util.FormatDate(startDate, "2006-01-02"), util.FormatDate(endDate, "2006-01-02"))
+func (p *pgDb) GetCountDateOrders(ctx context.Context, startDate, endDate time.Time) (int, error) {
+	defer observeQuery("GetCountDateOrders", time.Now())
+	rows, err := p.dbConn.QueryContext(ctx, "SELECT COUNT(*) FROM orders WHERE reg_date BETWEEN $1 AND $2 AND status = 'registered'", util.FormatDate(startDate, "2006-01-02"), util.FormatDate(endDate, "2006-01-02"))
 	if err != nil {
-		log.Printf("error GetCountDateOrders: %v", err)
-		return checkCount(rows), err
-	}
-	return checkCount(rows), err
-}
-
-func (p *pgDb) CreateDepartament(departament model.Departament) error {
-	_, err := p.dbConn.Exec("INSERT INTO departaments (title) VALUES ($1)", &departament.Title)
-	if err != nil {
-		log.Printf("error CreateDepartament: %v", err)
-		return err
-	}
-	return err
-}
-
-func (p *pgDb) GetDepartaments() ([]model.Departament, error) {
-	departaments := []model.Departament{}
-	rows, err := p.dbConn.Query(`SELECT title FROM departaments`)
-	if err != nil {
-		log.Printf("error GetDepartament: %v", err)
-		return nil, err
+		util.Errorf(ctx, "error GetCountDateOrders: %v", err)
+		return 0, err
 	}
 	defer rows.Close()
-
-	for rows.Next() {
-		departament := model.Departament{}
-		err := rows.Scan(&departament.Title)
-		if err != nil {
-			log.Printf("error GetDepartament: %v", err)
-			continue
-		}
-		departaments = append(departaments, departament)
-	}
-	return departaments, nil
-}
-
-func (p *pgDb) GetDepartament(departamentID int64) (model.Departament, error) {
-	row := p.dbConn.QueryRow(`SELECT title FROM departaments WHERE id = $1`, departamentID)
-
-	departament := model.Departament{}
-	err := row.Scan(&departament.Title)
-	if err != nil {
-		log.Printf("error GetDepartament: %v", err)
-		return departament, err
-	}
-	return departament, err
-}
-
-func (p *pgDb) UpdateDepartament(departament model.Departament) error {
-	_, err := p.dbConn.Exec(`UPDATE departaments set title = $1 WHERE id = $2`, &departament.Title, &departament.ID)
-	if err != nil {
-		log.Printf("error UpdateDepartament: %v", err)
-		return err
-	}
-	return err
-}
-
-func (p *pgDb) DeleteDepartament(id int64) error {
-	_, err := p.dbConn.Exec("DELETE from departaments where id = $1", id)
-	if err != nil {
-		log.Printf("error DeleteDepartament: %v", err)
-		return err
-	}
-	return err
+	return checkCount(rows), rows.Err()
 }
 
-func (p *pgDb) CreateHBKindOfDoc(hbkind model.HBKindOfDoc) error {
-	_, err := p.dbConn.Exec("INSERT INTO hbkind (name) VALUES ($1)", &hbkind.Name)
+func (p *pgDb) CreateHBKindOfDoc(ctx context.Context, hbkind model.HBKindOfDoc) error {
+	defer observeQuery("CreateHBKindOfDoc", time.Now())
+	_, err := p.dbConn.ExecContext(ctx, "INSERT INTO hbkind (name, retention_years) VALUES ($1, $2)", &hbkind.Name, &hbkind.RetentionYears)
 	if err != nil {
-		log.Printf("error CreateBKindOfDoc: %v", err)
+		util.Errorf(ctx, "error CreateBKindOfDoc: %v", err)
 		return err
 	}
 	return err
 }
 
-func (p *pgDb) GetHBKindOfDoc() ([]model.HBKindOfDoc, error) {
+func (p *pgDb) GetHBKindOfDoc(ctx context.Context) ([]model.HBKindOfDoc, error) {
+	defer observeQuery("GetHBKindOfDoc", time.Now())
 	hbkinds := []model.HBKindOfDoc{}
-	rows, err := p.dbConn.Query(`SELECT id, name FROM hbkind`)
+	rows, err := p.dbConn.QueryContext(ctx, `SELECT id, name, active, retention_years FROM hbkind ORDER BY name`)
 	if err != nil {
-		log.Printf("error GetBKindOfDoc: %v", err)
+		util.Errorf(ctx, "error GetBKindOfDoc: %v", err)
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		hbkind := model.HBKindOfDoc{}
-		err := rows.Scan(&hbkind.ID, &hbkind.Name)
+		err := rows.Scan(&hbkind.ID, &hbkind.Name, &hbkind.Active, &hbkind.RetentionYears)
 		if err != nil {
-			log.Printf("error GetBKindOfDoc: %v", err)
+			util.Errorf(ctx, "error GetBKindOfDoc: %v", err)
 			continue
 		}
 		hbkinds = append(hbkinds, hbkind)
@@ -508,29 +671,31 @@ func (p *pgDb) GetHBKindOfDoc() ([]model.HBKindOfDoc, error) {
 	return hbkinds, nil
 }
 
-func (p *pgDb) CreateHBDocLabel(hblabel model.HBDocLabel) error {
-	_, err := p.dbConn.Exec("INSERT INTO hblabel (name) VALUES ($1)", &hblabel.Name)
+func (p *pgDb) CreateHBDocLabel(ctx context.Context, hblabel model.HBDocLabel) error {
+	defer observeQuery("CreateHBDocLabel", time.Now())
+	_, err := p.dbConn.ExecContext(ctx, "INSERT INTO hblabel (name) VALUES ($1)", &hblabel.Name)
 	if err != nil {
-		log.Printf("error CreateHBDocLabel: %v", err)
+		util.Errorf(ctx, "error CreateHBDocLabel: %v", err)
 		return err
 	}
 	return err
 }
 
-func (p *pgDb) GetHBDocLabel() ([]model.HBDocLabel, error) {
+func (p *pgDb) GetHBDocLabel(ctx context.Context) ([]model.HBDocLabel, error) {
+	defer observeQuery("GetHBDocLabel", time.Now())
 	hblabels := []model.HBDocLabel{}
-	rows, err := p.dbConn.Query(`SELECT id, name FROM hblabel`)
+	rows, err := p.dbConn.QueryContext(ctx, `SELECT id, name, active FROM hblabel ORDER BY name`)
 	if err != nil {
-		log.Printf("error GetHBDocLabel: %v", err)
+		util.Errorf(ctx, "error GetHBDocLabel: %v", err)
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		hblabel := model.HBDocLabel{}
-		err := rows.Scan(&hblabel.ID, &hblabel.Name)
+		err := rows.Scan(&hblabel.ID, &hblabel.Name, &hblabel.Active)
 		if err != nil {
-			log.Printf("error GetHBDocLabel: %v", err)
+			util.Errorf(ctx, "error GetHBDocLabel: %v", err)
 			continue
 		}
 		hblabels = append(hblabels, hblabel)
@@ -538,29 +703,31 @@ func (p *pgDb) GetHBDocLabel() ([]model.HBDocLabel, error) {
 	return hblabels, nil
 }
 
-func (p *pgDb) CreateHBDocType(hbtype model.HBDocType) error {
-	_, err := p.dbConn.Exec("INSERT INTO hbtype (name) VALUES ($1)", &hbtype.Name)
+func (p *pgDb) CreateHBDocType(ctx context.Context, hbtype model.HBDocType) error {
+	defer observeQuery("CreateHBDocType", time.Now())
+	_, err := p.dbConn.ExecContext(ctx, "INSERT INTO hbtype (name) VALUES ($1)", &hbtype.Name)
 	if err != nil {
-		log.Printf("error CreateHBDocType: %v", err)
+		util.Errorf(ctx, "error CreateHBDocType: %v", err)
 		return err
 	}
 	return err
 }
 
-func (p *pgDb) GetHBDocType() ([]model.HBDocType, error) {
+func (p *pgDb) GetHBDocType(ctx context.Context) ([]model.HBDocType, error) {
+	defer observeQuery("GetHBDocType", time.Now())
 	hbtypes := []model.HBDocType{}
-	rows, err := p.dbConn.Query(`SELECT id, name FROM hbtype`)
+	rows, err := p.dbConn.QueryContext(ctx, `SELECT id, name, active FROM hbtype ORDER BY name`)
 	if err != nil {
-		log.Printf("error GetHBDocType: %v", err)
+		util.Errorf(ctx, "error GetHBDocType: %v", err)
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
 		hbtype := model.HBDocType{}
-		err := rows.Scan(&hbtype.ID, &hbtype.Name)
+		err := rows.Scan(&hbtype.ID, &hbtype.Name, &hbtype.Active)
 		if err != nil {
-			log.Printf("error GetHBDocType: %v", err)
+			util.Errorf(ctx, "error GetHBDocType: %v", err)
 			continue
 		}
 		hbtypes = append(hbtypes, hbtype)
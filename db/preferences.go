@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"../model"
+	"../util"
+	_ "github.com/lib/pq"
+)
+
+// возвращаем настройки списков пользователя, если он их не менял — настройки по умолчанию
+func (p *pgDb) GetPreferences(ctx context.Context, userID int64) (model.Preferences, error) {
+	defer observeQuery("GetPreferences", time.Now())
+	prefs := model.DefaultPreferences(userID)
+	var hidden string
+	err := p.dbConn.QueryRowContext(ctx, `SELECT page_size, sort_by, sort_desc, hidden_columns FROM user_preferences WHERE user_id = $1`, userID).
+		Scan(&prefs.PageSize, &prefs.SortBy, &prefs.SortDesc, &hidden)
+	if err == sql.ErrNoRows {
+		return prefs, nil
+	}
+	if err != nil {
+		util.Errorf(ctx, "error GetPreferences: %v", err)
+		return prefs, err
+	}
+	if hidden != "" {
+		prefs.Hidden = strings.Split(hidden, ",")
+	}
+	prefs.Normalize()
+	return prefs, nil
+}
+
+func (p *pgDb) SavePreferences(ctx context.Context, prefs model.Preferences) error {
+	defer observeQuery("SavePreferences", time.Now())
+	_, err := p.dbConn.ExecContext(ctx, `INSERT INTO user_preferences (user_id, page_size, sort_by, sort_desc, hidden_columns) VALUES ($1, $2, $3, $4, $5) 
+	ON CONFLICT (user_id) DO UPDATE SET page_size = $2, sort_by = $3, sort_desc = $4, hidden_columns = $5`,
+		prefs.UserID, prefs.PageSize, prefs.SortBy, prefs.SortDesc, strings.Join(prefs.Hidden, ","))
+	if err != nil {
+		util.Errorf(ctx, "error SavePreferences: %v", err)
+		return err
+	}
+	return err
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"../model"
+	"../util"
+	_ "github.com/lib/pq"
+)
+
+func (p *pgDb) GetSchedules(ctx context.Context) ([]model.Schedule, error) {
+	defer observeQuery("GetSchedules", time.Now())
+	schedules := []model.Schedule{}
+	rows, err := p.dbConn.QueryContext(ctx, `SELECT id, title, spec, format, 
+	(SELECT title FROM departaments WHERE departaments.id = schedules.departament_id) AS departament, 
+	recipients, last_run, active FROM schedules ORDER BY id`)
+	if err != nil {
+		util.Errorf(ctx, "error GetSchedules: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		schedule := model.Schedule{}
+		var lastRun sql.NullTime
+		err := rows.Scan(&schedule.ID, &schedule.Title, &schedule.Spec, &schedule.Format, &schedule.Departament,
+			&schedule.Recipients, &lastRun, &schedule.Active)
+		if err != nil {
+			util.Errorf(ctx, "error GetSchedules: %v", err)
+			continue
+		}
+		schedule.LastRun = lastRun.Time
+		schedules = append(schedules, schedule)
+	}
+	return schedules, nil
+}
+
+func (p *pgDb) CreateSchedule(ctx context.Context, schedule model.Schedule) error {
+	defer observeQuery("CreateSchedule", time.Now())
+	_, err := p.dbConn.ExecContext(ctx, `INSERT INTO schedules (title, spec, format, departament_id, recipients, active) VALUES 
+	($1, $2, $3, (SELECT id FROM departaments WHERE departaments.title = $4), $5, $6)`,
+		&schedule.Title, &schedule.Spec, &schedule.Format, &schedule.Departament, &schedule.Recipients, &schedule.Active)
+	if err != nil {
+		util.Errorf(ctx, "error CreateSchedule: %v", err)
+		return err
+	}
+	return err
+}
+
+func (p *pgDb) DeleteSchedule(ctx context.Context, id int64) error {
+	defer observeQuery("DeleteSchedule", time.Now())
+	_, err := p.dbConn.ExecContext(ctx, "DELETE from schedules where id = $1", id)
+	if err != nil {
+		util.Errorf(ctx, "error DeleteSchedule: %v", err)
+		return err
+	}
+	return err
+}
+
+func (p *pgDb) UpdateScheduleLastRun(ctx context.Context, id int64, lastRun time.Time) error {
+	defer observeQuery("UpdateScheduleLastRun", time.Now())
+	_, err := p.dbConn.ExecContext(ctx, "UPDATE schedules SET last_run = $1 WHERE id = $2", lastRun, id)
+	if err != nil {
+		util.Errorf(ctx, "error UpdateScheduleLastRun: %v", err)
+		return err
+	}
+	return err
+}
+
+// возвращаем приказы сотрудников отдела и вложенных в него, зарегистрированные в полуинтервал дат [startDate, endDate):
+// следующий отчет начинается с конца предыдущего, и приказ не попадает в оба
+func (p *pgDb) GetDepartamentOrders(ctx context.Context, departament string, startDate, endDate time.Time) ([]model.Order, error) {
+	defer observeQuery("GetDepartamentOrders", time.Now())
+	return p.getDepartamentOrders(ctx, `reg_date >= $2 AND reg_date < $3 AND status = 'registered'`, "GetDepartamentOrders", departament, startDate, endDate)
+}
+
+// возвращаем приказы сотрудников отдела и вложенных в него, утратившие силу в полуинтервал дат [startDate, endDate)
+func (p *pgDb) GetCancelledOrders(ctx context.Context, departament string, startDate, endDate time.Time) ([]model.Order, error) {
+	defer observeQuery("GetCancelledOrders", time.Now())
+	return p.getDepartamentOrders(ctx, `cancelled >= $2 AND cancelled < $3`, "GetCancelledOrders", departament, startDate, endDate)
+}
+
+func (p *pgDb) getDepartamentOrders(ctx context.Context, where, name, departament string, startDate, endDate time.Time) ([]model.Order, error) {
+	rows, err := p.dbConn.QueryContext(ctx, `SELECT id, 
+	(SELECT name FROM hbtype WHERE hbtype.id = orders.doc_type_id) AS name, 
+	(SELECT name FROM hbkind WHERE hbkind.id = orders.kind_of_doc_id) AS name, 
+	(SELECT name FROM hblabel WHERE hblabel.id = orders.doc_label_id) AS name, 
+	reg_date, reg_number, description, 
+	(SELECT username FROM users WHERE orders.user_id = users.id) AS username,
+	file_original, file_copy, current, status FROM orders WHERE `+where+` 
+	AND user_id IN (SELECT users.id FROM users WHERE departament_id IN (`+sqlDepartamentSubtree("title = $1")+`)) 
+	ORDER BY reg_date DESC`,
+		departament, util.FormatDate(startDate, "2006-01-02"), util.FormatDate(endDate, "2006-01-02"))
+
+	orders := []model.Order{}
+	if err != nil {
+		util.Errorf(ctx, "error %s: %v", name, err)
+		return orders, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		order := model.Order{}
+		err := rows.Scan(&order.ID, &order.DocType, &order.KindOfDoc, &order.DocLabel, &order.RegDate, &order.RegNumber,
+			&order.Description, &order.Username, &order.FileOriginal, &order.FileCopy, &order.Current, &order.Status)
+		if err != nil {
+			util.Errorf(ctx, "error %s: %v", name, err)
+			continue
+		}
+		orders = append(orders, order)
+	}
+	return orders, err
+}
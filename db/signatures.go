@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"../model"
+	"../util"
+	_ "github.com/lib/pq"
+)
+
+func (p *pgDb) SaveSignature(ctx context.Context, signature model.Signature) error {
+	defer observeQuery("SaveSignature", time.Now())
+	return saveSignature(ctx, p.dbConn, "SaveSignature", signature)
+}
+
+func saveSignature(ctx context.Context, q queryer, method string, signature model.Signature) error {
+	_, err := q.ExecContext(ctx, `INSERT INTO order_signatures (order_id, file, subject, serial, signing_time, verified, error, checked) 
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8) 
+	ON CONFLICT (order_id) DO UPDATE SET file = $2, subject = $3, serial = $4, signing_time = $5, verified = $6, error = $7, checked = $8`,
+		&signature.OrderID, &signature.File, &signature.Subject, &signature.Serial, &signature.SigningTime,
+		&signature.Verified, &signature.Error, &signature.Checked)
+	if err != nil {
+		util.Errorf(ctx, "error %s: %v", method, err)
+		return err
+	}
+	return err
+}
+
+// возвращаем результат проверки подписи приказа, если подписи нет — пустую структуру
+func (p *pgDb) GetSignature(ctx context.Context, orderID int64) (model.Signature, error) {
+	defer observeQuery("GetSignature", time.Now())
+	row := p.dbConn.QueryRowContext(ctx, `SELECT order_id, file, subject, serial, signing_time, verified, error, checked 
+	FROM order_signatures WHERE order_id = $1`, orderID)
+
+	signature := model.Signature{}
+	err := row.Scan(&signature.OrderID, &signature.File, &signature.Subject, &signature.Serial, &signature.SigningTime,
+		&signature.Verified, &signature.Error, &signature.Checked)
+	if err == sql.ErrNoRows {
+		return signature, nil
+	}
+	if err != nil {
+		util.Errorf(ctx, "error GetSignature: %v", err)
+		return signature, err
+	}
+	return signature, err
+}
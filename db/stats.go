@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"../model"
+	"../util"
+	_ "github.com/lib/pq"
+)
+
+// GetStatOrders возвращает количество приказов за период, сгруппированное
+// по месяцу, типу, виду, пометке, автору и отделу автора
+func (p *pgDb) GetStatOrders(ctx context.Context, startDate, endDate time.Time) ([]model.StatRow, error) {
+	defer observeQuery("GetStatOrders", time.Now())
+	stats := []model.StatRow{}
+	rows, err := p.dbConn.QueryContext(ctx, `SELECT date_trunc('month', orders.reg_date)::date AS month,
+	COALESCE(hbtype.name, ''), COALESCE(hbkind.name, ''), COALESCE(hblabel.name, ''),
+	COALESCE(users.username, ''), COALESCE(departaments.title, ''), COUNT(*)
+	FROM orders
+	LEFT JOIN hbtype ON hbtype.id = orders.doc_type_id
+	LEFT JOIN hbkind ON hbkind.id = orders.kind_of_doc_id
+	LEFT JOIN hblabel ON hblabel.id = orders.doc_label_id
+	LEFT JOIN users ON users.id = orders.user_id
+	LEFT JOIN departaments ON departaments.id = users.departament_id
+	WHERE orders.reg_date BETWEEN $1 AND $2 AND orders.status = 'registered'
+	GROUP BY 1, 2, 3, 4, 5, 6 ORDER BY 1`, util.FormatDate(startDate, "2006-01-02"), util.FormatDate(endDate, "2006-01-02"))
+	if err != nil {
+		util.Errorf(ctx, "error GetStatOrders: %v", err)
+		return stats, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		stat := model.StatRow{}
+		err := rows.Scan(&stat.Month, &stat.DocType, &stat.KindOfDoc, &stat.DocLabel, &stat.Username, &stat.Departament, &stat.Count)
+		if err != nil {
+			util.Errorf(ctx, "error GetStatOrders: %v", err)
+			continue
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+// GetOrderCountsByYear возвращает количество приказов по годам регистрации и состояниям
+func (p *pgDb) GetOrderCountsByYear(ctx context.Context) ([]model.YearCount, error) {
+	defer observeQuery("GetOrderCountsByYear", time.Now())
+	counts := []model.YearCount{}
+	rows, err := p.dbConn.QueryContext(ctx, `SELECT date_part('year', reg_date)::int, status, COUNT(*)
+	FROM orders GROUP BY 1, 2 ORDER BY 1, 2`)
+	if err != nil {
+		util.Errorf(ctx, "error GetOrderCountsByYear: %v", err)
+		return counts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		count := model.YearCount{}
+		if err := rows.Scan(&count.Year, &count.Status, &count.Count); err != nil {
+			util.Errorf(ctx, "error GetOrderCountsByYear: %v", err)
+			continue
+		}
+		counts = append(counts, count)
+	}
+	return counts, nil
+}
@@ -0,0 +1,91 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"../model"
+	"../util"
+	_ "github.com/lib/pq"
+)
+
+func (p *pgDb) GetTOTP(ctx context.Context, userID int64) (model.TOTP, error) {
+	defer observeQuery("GetTOTP", time.Now())
+	totp := model.TOTP{}
+	err := p.dbConn.QueryRowContext(ctx, `SELECT totp_secret, totp_enabled, totp_last_step FROM users WHERE id = $1`, userID).
+		Scan(&totp.Secret, &totp.Enabled, &totp.LastStep)
+	if err != nil {
+		util.Errorf(ctx, "error GetTOTP: %v", err)
+		return totp, err
+	}
+	return totp, err
+}
+
+func (p *pgDb) SaveTOTP(ctx context.Context, userID int64, secret string, enabled bool) error {
+	defer observeQuery("SaveTOTP", time.Now())
+	_, err := p.dbConn.ExecContext(ctx, `UPDATE users SET totp_secret = $2, totp_enabled = $3 WHERE id = $1`, userID, secret, enabled)
+	if err != nil {
+		util.Errorf(ctx, "error SaveTOTP: %v", err)
+		return err
+	}
+	return err
+}
+
+// запоминаем интервал принятого кода; ложь — код этого или более позднего интервала уже принят
+func (p *pgDb) UseTOTPStep(ctx context.Context, userID, step int64) (bool, error) {
+	defer observeQuery("UseTOTPStep", time.Now())
+	res, err := p.dbConn.ExecContext(ctx, `UPDATE users SET totp_last_step = $2 WHERE id = $1 AND totp_last_step < $2`, userID, step)
+	if err != nil {
+		util.Errorf(ctx, "error UseTOTPStep: %v", err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+// заменяем коды восстановления одной транзакцией; пустой список удаляет все коды
+func (p *pgDb) ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes []string) error {
+	defer observeQuery("ReplaceRecoveryCodes", time.Now())
+	tx, err := p.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		util.Errorf(ctx, "error ReplaceRecoveryCodes: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		util.Errorf(ctx, "error ReplaceRecoveryCodes: %v", err)
+		return err
+	}
+	for _, hash := range hashes {
+		if _, err := tx.ExecContext(ctx, `INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash); err != nil {
+			util.Errorf(ctx, "error ReplaceRecoveryCodes: %v", err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// гасим код восстановления; ложь — такого неиспользованного кода нет
+func (p *pgDb) UseRecoveryCode(ctx context.Context, userID int64, hash string) (bool, error) {
+	defer observeQuery("UseRecoveryCode", time.Now())
+	res, err := p.dbConn.ExecContext(ctx, `UPDATE recovery_codes SET used = now()
+	WHERE id = (SELECT id FROM recovery_codes WHERE user_id = $1 AND code_hash = $2 AND used IS NULL LIMIT 1) AND used IS NULL`, userID, hash)
+	if err != nil {
+		util.Errorf(ctx, "error UseRecoveryCode: %v", err)
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
+}
+
+func (p *pgDb) CountRecoveryCodes(ctx context.Context, userID int64) (int, error) {
+	defer observeQuery("CountRecoveryCodes", time.Now())
+	var count int
+	err := p.dbConn.QueryRowContext(ctx, `SELECT COUNT(*) FROM recovery_codes WHERE user_id = $1 AND used IS NULL`, userID).Scan(&count)
+	if err != nil {
+		util.Errorf(ctx, "error CountRecoveryCodes: %v", err)
+		return count, err
+	}
+	return count, err
+}
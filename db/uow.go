@@ -0,0 +1,218 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"../model"
+	"../util"
+	_ "github.com/lib/pq"
+)
+
+// queryer — методы, общие для пула соединений и транзакции
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// pgTx — транзакция единицы работы модели
+type pgTx struct {
+	tx *sql.Tx
+}
+
+func (p *pgDb) Begin(ctx context.Context) (model.Tx, error) {
+	tx, err := p.dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		util.Errorf(ctx, "error Begin: %v", err)
+		return nil, err
+	}
+	return &pgTx{tx: tx}, nil
+}
+
+func (t *pgTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *pgTx) Rollback() error {
+	err := t.tx.Rollback()
+	if err == sql.ErrTxDone {
+		return nil
+	}
+	return err
+}
+
+func (t *pgTx) GetOrder(ctx context.Context, id int64) (model.Order, error) {
+	defer observeQuery("TxGetOrder", time.Now())
+	return getOrder(ctx, t.tx, "TxGetOrder", sqlSelectOrder+" FOR UPDATE", id)
+}
+
+// orderRefs — идентификаторы справочников и автора приказа
+type orderRefs struct {
+	docType, kindOfDoc, docLabel, user sql.NullInt64
+}
+
+// lookupRef возвращает id записи по наименованию: пустое наименование — NULL,
+// а не найденное — ошибка, чтобы опечатка не превращалась молча в пустое поле.
+// query выбирает id и признак active; отключенная запись допустима, только если activeOnly ложно
+func lookupRef(ctx context.Context, q queryer, query, title, name string, activeOnly bool) (sql.NullInt64, error) {
+	var id sql.NullInt64
+	var active bool
+	if name == "" {
+		return id, nil
+	}
+	err := q.QueryRowContext(ctx, query, name).Scan(&id, &active)
+	if err == sql.ErrNoRows {
+		return id, fmt.Errorf("%s %q не найден", title, name)
+	}
+	if err == nil && activeOnly && !active {
+		return id, fmt.Errorf("%s %q отключен и недоступен для новых приказов", title, name)
+	}
+	return id, err
+}
+
+// resolveOrderRefs находит идентификаторы справочников и автора. Новому приказу нельзя
+// назначить отключенную запись справочника, существующий сохраняет прежнюю
+func resolveOrderRefs(ctx context.Context, q queryer, order model.Order, activeOnly bool) (orderRefs, error) {
+	var refs orderRefs
+	targets := map[string]*sql.NullInt64{
+		model.HandbookDocType:   &refs.docType,
+		model.HandbookKindOfDoc: &refs.kindOfDoc,
+		model.HandbookDocLabel:  &refs.docLabel,
+	}
+	names := map[string]string{
+		model.HandbookDocType:   order.DocType,
+		model.HandbookKindOfDoc: order.KindOfDoc,
+		model.HandbookDocLabel:  order.DocLabel,
+	}
+	var err error
+	for _, hb := range model.Handbooks {
+		query := fmt.Sprintf("SELECT id, active FROM %s WHERE name = $1", hb.Name)
+		if *targets[hb.Name], err = lookupRef(ctx, q, query, hb.Title, names[hb.Name], activeOnly); err != nil {
+			return refs, err
+		}
+	}
+	refs.user, err = lookupRef(ctx, q, "SELECT id, true FROM users WHERE username = $1", "Пользователь", order.Username, false)
+	return refs, err
+}
+
+// regNumberTaken сообщает, есть ли уже приказ с номером number, зарегистрированный в году year
+func regNumberTaken(ctx context.Context, q queryer, year int, number string) (bool, error) {
+	var taken bool
+	err := q.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE reg_number = $1 AND date_part('year', reg_date) = $2)`,
+		number, year).Scan(&taken)
+	return taken, err
+}
+
+func (p *pgDb) RegNumberTaken(ctx context.Context, year int, number string) (bool, error) {
+	defer observeQuery("RegNumberTaken", time.Now())
+	taken, err := regNumberTaken(ctx, p.dbConn, year, number)
+	if err != nil {
+		util.Errorf(ctx, "error RegNumberTaken: %v", err)
+	}
+	return taken, err
+}
+
+// insertOrder добавляет приказ перенесенным из таблицы или архивного пакета: справочники
+// и автор сверяются через resolveOrderRefs, а номер, уже занятый в году регистрации, — ошибка
+func insertOrder(ctx context.Context, t *pgTx, order model.Order, activeOnly bool) (int64, error) {
+	if order.RegNumber != "" {
+		taken, err := regNumberTaken(ctx, t.tx, order.RegDate.Year(), order.RegNumber)
+		if err != nil {
+			return 0, err
+		}
+		if taken {
+			return 0, fmt.Errorf("приказ № %s за %d год уже есть в БД", order.RegNumber, order.RegDate.Year())
+		}
+	}
+	return t.createOrder(ctx, order, activeOnly)
+}
+
+func (t *pgTx) CreateOrder(ctx context.Context, order model.Order) (int64, error) {
+	defer observeQuery("TxCreateOrder", time.Now())
+	return t.createOrder(ctx, order, true)
+}
+
+func (t *pgTx) createOrder(ctx context.Context, order model.Order, activeOnly bool) (int64, error) {
+	var id int64
+	refs, err := resolveOrderRefs(ctx, t.tx, order, activeOnly)
+	if err != nil {
+		util.Errorf(ctx, "error TxCreateOrder: %v", err)
+		return id, err
+	}
+	err = t.tx.QueryRowContext(ctx, `INSERT INTO orders (doc_type_id, kind_of_doc_id, doc_label_id, reg_date, reg_number, description, user_id,
+	file_original, file_copy, current, status) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, COALESCE(NULLIF($11, ''), 'registered')) RETURNING id`,
+		refs.docType, refs.kindOfDoc, refs.docLabel, order.RegDate, order.RegNumber, order.Description, refs.user,
+		order.FileOriginal, order.FileCopy, order.Current, order.Status).Scan(&id)
+	if err != nil {
+		util.Errorf(ctx, "error TxCreateOrder: %v", err)
+		return id, err
+	}
+	return id, err
+}
+
+// получаем измененные данные и сохраняем их в БД
+func (t *pgTx) UpdateOrder(ctx context.Context, order model.Order) error {
+	defer observeQuery("TxUpdateOrder", time.Now())
+	refs, err := resolveOrderRefs(ctx, t.tx, order, false)
+	if err != nil {
+		util.Errorf(ctx, "error TxUpdateOrder: %v", err)
+		return err
+	}
+	res, err := t.tx.ExecContext(ctx, `UPDATE orders SET
+	doc_type_id = $1, kind_of_doc_id = $2, doc_label_id = $3,
+	reg_date = $4, reg_number = $5, description = $6, user_id = $7,
+	file_original = $8, file_copy = $9, current = $10,
+	cancelled = CASE WHEN $10 THEN NULL ELSE COALESCE(cancelled, CURRENT_DATE) END WHERE id = $11`,
+		refs.docType, refs.kindOfDoc, refs.docLabel, order.RegDate, order.RegNumber, order.Description,
+		refs.user, order.FileOriginal, order.FileCopy, order.Current, order.ID)
+	if err != nil {
+		util.Errorf(ctx, "error TxUpdateOrder: %v", err)
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("приказ %d не найден", order.ID)
+	}
+	return nil
+}
+
+func (t *pgTx) SaveSignature(ctx context.Context, signature model.Signature) error {
+	defer observeQuery("TxSaveSignature", time.Now())
+	return saveSignature(ctx, t.tx, "TxSaveSignature", signature)
+}
+
+// удаляем результат проверки подписи: он относился к прежнему оригиналу
+func (t *pgTx) DeleteSignature(ctx context.Context, orderID int64) error {
+	defer observeQuery("TxDeleteSignature", time.Now())
+	_, err := t.tx.ExecContext(ctx, `DELETE FROM order_signatures WHERE order_id = $1`, orderID)
+	if err != nil {
+		util.Errorf(ctx, "error TxDeleteSignature: %v", err)
+		return err
+	}
+	return err
+}
+
+// запись в журнал согласования без смены состояния: создание и правка приказа
+func (t *pgTx) AddTransition(ctx context.Context, transition model.OrderTransition) error {
+	defer observeQuery("TxAddTransition", time.Now())
+	_, err := t.tx.ExecContext(ctx, `INSERT INTO order_transitions (order_id, from_status, to_status, user_id, comment, created)
+	VALUES ($1, $2, $3, (SELECT id FROM users WHERE users.username = $4), $5, now())`,
+		transition.OrderID, transition.From, transition.To, transition.Username, transition.Comment)
+	if err != nil {
+		util.Errorf(ctx, "error TxAddTransition: %v", err)
+		return err
+	}
+	return err
+}
+
+func (t *pgTx) CreateUser(ctx context.Context, user model.User) error {
+	defer observeQuery("TxCreateUser", time.Now())
+	return createUser(ctx, t.tx, "TxCreateUser", user)
+}
+
+func (t *pgTx) TransitOrder(ctx context.Context, transition model.OrderTransition) error {
+	defer observeQuery("TxTransitOrder", time.Now())
+	return transitOrder(ctx, t.tx, "TxTransitOrder", transition)
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"../model"
+	"../util"
+	_ "github.com/lib/pq"
+)
+
+func (p *pgDb) GetWebhooks(ctx context.Context) ([]model.Webhook, error) {
+	defer observeQuery("GetWebhooks", time.Now())
+	return getWebhooks(ctx, p.dbConn, "GetWebhooks")
+}
+
+func (t *pgTx) GetWebhooks(ctx context.Context) ([]model.Webhook, error) {
+	defer observeQuery("TxGetWebhooks", time.Now())
+	return getWebhooks(ctx, t.tx, "TxGetWebhooks")
+}
+
+func getWebhooks(ctx context.Context, q queryer, name string) ([]model.Webhook, error) {
+	webhooks := []model.Webhook{}
+	rows, err := q.QueryContext(ctx, `SELECT id, title, url, secret, events, kind_of_doc, active FROM webhooks ORDER BY id`)
+	if err != nil {
+		util.Errorf(ctx, "error %s: %v", name, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		webhook := model.Webhook{}
+		err := rows.Scan(&webhook.ID, &webhook.Title, &webhook.URL, &webhook.Secret, &webhook.Events, &webhook.KindOfDoc, &webhook.Active)
+		if err != nil {
+			util.Errorf(ctx, "error %s: %v", name, err)
+			continue
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, nil
+}
+
+func (p *pgDb) CreateWebhook(ctx context.Context, webhook model.Webhook) error {
+	defer observeQuery("CreateWebhook", time.Now())
+	_, err := p.dbConn.ExecContext(ctx, `INSERT INTO webhooks (title, url, secret, events, kind_of_doc, active) VALUES ($1, $2, $3, $4, $5, $6)`,
+		&webhook.Title, &webhook.URL, &webhook.Secret, &webhook.Events, &webhook.KindOfDoc, &webhook.Active)
+	if err != nil {
+		util.Errorf(ctx, "error CreateWebhook: %v", err)
+		return err
+	}
+	return err
+}
+
+func (p *pgDb) DeleteWebhook(ctx context.Context, id int64) error {
+	defer observeQuery("DeleteWebhook", time.Now())
+	_, err := p.dbConn.ExecContext(ctx, "DELETE from webhooks where id = $1", id)
+	if err != nil {
+		util.Errorf(ctx, "error DeleteWebhook: %v", err)
+		return err
+	}
+	return err
+}
+
+// ставим доставку в очередь в транзакции единицы работы, вместе с изменением приказа
+func (t *pgTx) CreateDelivery(ctx context.Context, delivery model.Delivery) error {
+	defer observeQuery("TxCreateDelivery", time.Now())
+	_, err := t.tx.ExecContext(ctx, `INSERT INTO webhook_deliveries (webhook_id, event, payload, status, next_attempt, created) 
+	VALUES ($1, $2, $3, $4, now(), now())`,
+		delivery.WebhookID, delivery.Event, delivery.Payload, model.DeliveryPending)
+	if err != nil {
+		util.Errorf(ctx, "error TxCreateDelivery: %v", err)
+		return err
+	}
+	return err
+}
+
+// возвращаем доставки, время очередной попытки которых наступило
+func (p *pgDb) GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]model.Delivery, error) {
+	defer observeQuery("GetDueDeliveries", time.Now())
+	return p.getDeliveries(ctx, `WHERE webhook_deliveries.status = $1 AND webhook_deliveries.next_attempt <= $2 
+	ORDER BY webhook_deliveries.next_attempt LIMIT $3`, "GetDueDeliveries", model.DeliveryPending, now, limit)
+}
+
+// возвращаем журнал доставок, status = "" — все статусы
+func (p *pgDb) GetDeliveries(ctx context.Context, status string, limit int) ([]model.Delivery, error) {
+	defer observeQuery("GetDeliveries", time.Now())
+	return p.getDeliveries(ctx, `WHERE ($1 = '' OR webhook_deliveries.status = $1) 
+	ORDER BY webhook_deliveries.created DESC LIMIT $2`, "GetDeliveries", status, limit)
+}
+
+func (p *pgDb) getDeliveries(ctx context.Context, where, name string, args ...interface{}) ([]model.Delivery, error) {
+	deliveries := []model.Delivery{}
+	rows, err := p.dbConn.QueryContext(ctx, `SELECT webhook_deliveries.id, webhooks.id, webhooks.title, webhooks.url, webhooks.secret, 
+	webhook_deliveries.event, webhook_deliveries.payload, webhook_deliveries.status, webhook_deliveries.attempts, 
+	webhook_deliveries.next_attempt, webhook_deliveries.response_code, webhook_deliveries.last_error, webhook_deliveries.created 
+	FROM webhook_deliveries JOIN webhooks ON webhooks.id = webhook_deliveries.webhook_id `+where, args...)
+	if err != nil {
+		util.Errorf(ctx, "error %s: %v", name, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		d := model.Delivery{}
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.Title, &d.URL, &d.Secret, &d.Event, &d.Payload, &d.Status, &d.Attempts,
+			&d.NextAttempt, &d.ResponseCode, &d.LastError, &d.Created)
+		if err != nil {
+			util.Errorf(ctx, "error %s: %v", name, err)
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
+
+func (p *pgDb) UpdateDelivery(ctx context.Context, delivery model.Delivery) error {
+	defer observeQuery("UpdateDelivery", time.Now())
+	_, err := p.dbConn.ExecContext(ctx, `UPDATE webhook_deliveries SET status = $1, attempts = $2, next_attempt = $3, 
+	response_code = $4, last_error = $5 WHERE id = $6`,
+		&delivery.Status, &delivery.Attempts, &delivery.NextAttempt, &delivery.ResponseCode, &delivery.LastError, &delivery.ID)
+	if err != nil {
+		util.Errorf(ctx, "error UpdateDelivery: %v", err)
+		return err
+	}
+	return err
+}
+
+// возвращаем доставку из очереди недоставленных обратно в очередь
+func (p *pgDb) RetryDelivery(ctx context.Context, id int64) error {
+	defer observeQuery("RetryDelivery", time.Now())
+	_, err := p.dbConn.ExecContext(ctx, `UPDATE webhook_deliveries SET status = $1, attempts = 0, next_attempt = now() 
+	WHERE id = $2 AND status = $3`, model.DeliveryPending, id, model.DeliveryDead)
+	if err != nil {
+		util.Errorf(ctx, "error RetryDelivery: %v", err)
+		return err
+	}
+	return err
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"../model"
+	"../util"
+	_ "github.com/lib/pq"
+)
+
+// nextRegNumber выдает следующий номер текущего года из счетчика reg_numbers.
+// Строка счетчика блокируется до конца транзакции, так что параллельные регистрации
+// получают разные номера. Счетчик нового года начинается после наибольшего номера
+// вида "123" среди приказов этого года; номер, уже занятый приказом, пропускается
+func nextRegNumber(ctx context.Context, tx *sql.Tx) (string, error) {
+	var number int64
+	err := tx.QueryRowContext(ctx, `INSERT INTO reg_numbers (year, last)
+	SELECT date_part('year', CURRENT_DATE)::int, COALESCE(MAX(reg_number::bigint), 0) + 1 FROM orders
+	WHERE reg_number ~ '^[0-9]{1,18}$' AND date_part('year', reg_date) = date_part('year', CURRENT_DATE)
+	ON CONFLICT (year) DO UPDATE SET last = reg_numbers.last + 1 RETURNING last`).Scan(&number)
+	for err == nil {
+		var taken bool
+		err = tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM orders WHERE reg_number = $1
+		AND date_part('year', reg_date) = date_part('year', CURRENT_DATE))`, strconv.FormatInt(number, 10)).Scan(&taken)
+		if err != nil || !taken {
+			break
+		}
+		err = tx.QueryRowContext(ctx, `UPDATE reg_numbers SET last = last + 1
+		WHERE year = date_part('year', CURRENT_DATE)::int RETURNING last`).Scan(&number)
+	}
+	return strconv.FormatInt(number, 10), err
+}
+
+// переводим приказ в новое состояние и пишем журнал согласования в транзакции единицы работы.
+// При регистрации присваиваем следующий номер в текущем году и дату регистрации. Строка приказа
+// блокируется до проверки состояния: повторная отправка той же формы не займет второй номер
+// и не оставит в журнале второй переход
+func transitOrder(ctx context.Context, tx *sql.Tx, name string, t model.OrderTransition) error {
+	var status string
+	err := tx.QueryRowContext(ctx, `SELECT status FROM orders WHERE id = $1 FOR UPDATE`, t.OrderID).Scan(&status)
+	if err != nil {
+		util.Errorf(ctx, "error %s: %v", name, err)
+		return err
+	}
+	// Приказ успел перейти в другое состояние, пока пользователь смотрел на страницу
+	if status != t.From {
+		return fmt.Errorf("приказ %d уже не в состоянии %q", t.OrderID, t.From)
+	}
+
+	var res sql.Result
+	if t.To == model.StatusRegistered {
+		var number string
+		if number, err = nextRegNumber(ctx, tx); err != nil {
+			util.Errorf(ctx, "error %s: %v", name, err)
+			return err
+		}
+		res, err = tx.ExecContext(ctx, `UPDATE orders SET status = $1, reg_date = CURRENT_DATE, reg_number = $4
+		WHERE id = $2 AND status = $3`, t.To, t.OrderID, t.From, number)
+	} else {
+		res, err = tx.ExecContext(ctx, `UPDATE orders SET status = $1 WHERE id = $2 AND status = $3`, t.To, t.OrderID, t.From)
+	}
+	if err != nil {
+		util.Errorf(ctx, "error %s: %v", name, err)
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return fmt.Errorf("приказ %d уже не в состоянии %q", t.OrderID, t.From)
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO order_transitions (order_id, from_status, to_status, user_id, comment, created) 
+	VALUES ($1, $2, $3, (SELECT id FROM users WHERE users.username = $4), $5, now())`,
+		t.OrderID, t.From, t.To, t.Username, t.Comment)
+	if err != nil {
+		util.Errorf(ctx, "error %s: %v", name, err)
+		return err
+	}
+	return nil
+}
+
+func (p *pgDb) GetOrderTransitions(ctx context.Context, orderID int64) ([]model.OrderTransition, error) {
+	defer observeQuery("GetOrderTransitions", time.Now())
+	transitions := []model.OrderTransition{}
+	rows, err := p.dbConn.QueryContext(ctx, `SELECT id, order_id, from_status, to_status, 
+	(SELECT username FROM users WHERE users.id = order_transitions.user_id) AS username, comment, created 
+	FROM order_transitions WHERE order_id = $1 ORDER BY created`, orderID)
+	if err != nil {
+		util.Errorf(ctx, "error GetOrderTransitions: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t := model.OrderTransition{}
+		err := rows.Scan(&t.ID, &t.OrderID, &t.From, &t.To, &t.Username, &t.Comment, &t.Created)
+		if err != nil {
+			util.Errorf(ctx, "error GetOrderTransitions: %v", err)
+			continue
+		}
+		transitions = append(transitions, t)
+	}
+	return transitions, nil
+}
+
+// возвращаем приказы в состоянии status, username = "" — любого автора
+func (p *pgDb) GetWorkflowOrders(ctx context.Context, status, username string) ([]model.Order, error) {
+	defer observeQuery("GetWorkflowOrders", time.Now())
+	rows, err := p.dbConn.QueryContext(ctx, `SELECT id, 
+	(SELECT name FROM hbtype WHERE hbtype.id = orders.doc_type_id) AS name, 
+	(SELECT name FROM hbkind WHERE hbkind.id = orders.kind_of_doc_id) AS name, 
+	(SELECT name FROM hblabel WHERE hblabel.id = orders.doc_label_id) AS name, 
+	reg_date, reg_number, description, 
+	(SELECT username FROM users WHERE orders.user_id = users.id) AS username,
+	file_original, file_copy, current, status FROM orders WHERE status = $1 
+	AND ($2 = '' OR user_id = (SELECT id FROM users WHERE users.username = $2)) ORDER BY id`, status, username)
+
+	orders := []model.Order{}
+	if err != nil {
+		util.Errorf(ctx, "error GetWorkflowOrders: %v", err)
+		return orders, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		order := model.Order{}
+		err := rows.Scan(&order.ID, &order.DocType, &order.KindOfDoc, &order.DocLabel, &order.RegDate, &order.RegNumber,
+			&order.Description, &order.Username, &order.FileOriginal, &order.FileCopy, &order.Current, &order.Status)
+		if err != nil {
+			util.Errorf(ctx, "error GetWorkflowOrders: %v", err)
+			continue
+		}
+		orders = append(orders, order)
+	}
+	return orders, err
+}
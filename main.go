@@ -1,34 +1,28 @@
 package main
 
 import (
-	"flag"
 	"log"
 	"net/http"
+	"os"
 
 	"./daemon"
+	"./util"
 )
 
-var assetsPath string
-
-func processFlags() *daemon.Config {
-	cfg := &daemon.Config{}
-
-	flag.StringVar(&cfg.ListenSpec, "listen", ":3000", "HTTP listen spec")
-	flag.StringVar(&cfg.Db.ConnectString, "db-connect", "host=localhost port=5433 user=postgres password=31yu*#km dbname=gowebapp sslmode=disable", "DB Connect String")
-	flag.StringVar(&assetsPath, "assets-path", "assets", "Path to assets dir")
-
-	flag.Parse()
-	return cfg
-}
-
 // Передаем в конфиг папку с интерфейсом
 func setupHTTPAssets(cfg *daemon.Config) {
-	log.Printf("Assets served from %q.", assetsPath)
-	cfg.UI.Assets = http.Dir(assetsPath)
+	log.Printf("Assets served from %q.", cfg.AssetsPath)
+	cfg.UI.Assets = http.Dir(cfg.AssetsPath)
 }
 
 func main() {
-	cfg := processFlags()
+	cfg, err := daemon.LoadConfig(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Error loading config: %v", err)
+	}
+	// журнал JSON, в том числе для log.Printf
+	util.SetupLog(cfg.LogLevel)
+	log.Printf("Effective config:\n%s", cfg)
 	setupHTTPAssets(cfg)
 
 	if err := daemon.Run(cfg); err != nil {
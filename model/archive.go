@@ -0,0 +1,381 @@
+package model
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"../util"
+)
+
+// Версия формата архивного пакета. Во второй версии отделы выгружаются с деревом,
+// руководителем и признаком действующего, в третьей у приказов есть дата утраты силы;
+// пакеты прежних версий по-прежнему принимаются
+const ArchiveVersion = 3
+
+// Имена служебных файлов и каталог с файлами приказов внутри пакета
+const (
+	ArchiveManifest  = "manifest.json"
+	ArchiveChecksums = "SHA256SUMS"
+	ArchiveFiles     = "files/"
+)
+
+// Archive — манифест архивного пакета: реестр приказов со справочниками,
+// отделами и пользователями. Пути файлов в приказах указаны внутри пакета
+type Archive struct {
+	Version      int           // Версия формата
+	Created      time.Time     // Дата выгрузки
+	DocTypes     []HBDocType   // Типы документов
+	KindOfDocs   []HBKindOfDoc // Виды документов
+	DocLabels    []HBDocLabel  // Штампы
+	Departaments []Departament // Отделы; ParentID — идентификатор из Departaments
+	Users        []User        // Пользователи без хэшей паролей
+	Orders       []Order       // Приказы во всех состояниях
+	Signatures   []Signature   // Подписи оригиналов, OrderID — идентификатор из Orders
+	Missing      []string      // Файлы, отсутствовавшие на диске при выгрузке
+}
+
+// archivePath возвращает путь файла внутри пакета для пути на диске
+func archivePath(file string) string {
+	name := filepath.ToSlash(filepath.Clean(file))
+	name = strings.TrimPrefix(name, strings.TrimPrefix(filepath.ToSlash(filepath.Clean(util.UploadDir)), "./")+"/")
+	return ArchiveFiles + strings.TrimLeft(name, "./")
+}
+
+// ExportArchive выгружает весь реестр в ZIP: манифест, файлы приказов и контрольные суммы SHA-256
+func (m *Model) ExportArchive(ctx context.Context, w io.Writer) (Archive, error) {
+	archive := Archive{Version: ArchiveVersion, Created: time.Now()}
+	var err error
+	if archive.DocTypes, err = m.db.GetHBDocType(ctx); err != nil {
+		return archive, err
+	}
+	if archive.KindOfDocs, err = m.db.GetHBKindOfDoc(ctx); err != nil {
+		return archive, err
+	}
+	if archive.DocLabels, err = m.db.GetHBDocLabel(ctx); err != nil {
+		return archive, err
+	}
+	if archive.Departaments, err = m.db.GetDepartaments(ctx); err != nil {
+		return archive, err
+	}
+	if archive.Users, err = m.db.GetUsers(ctx); err != nil {
+		return archive, err
+	}
+	for i := range archive.Users {
+		archive.Users[i].Password = ""
+	}
+	if archive.Orders, err = m.db.GetAllOrders(ctx); err != nil {
+		return archive, err
+	}
+
+	zw := zip.NewWriter(w)
+	sums := map[string]string{}
+	// файл на диске → путь в пакете, один файл может встречаться в нескольких приказах
+	written := map[string]string{}
+	used := map[string]bool{}
+	// addFile дописывает файл в пакет и возвращает его путь внутри пакета. Отсутствующий
+	// на диске файл попадает в Missing, ошибка записи в пакет прерывает выгрузку
+	addFile := func(file string) (string, error) {
+		if file == "" {
+			return "", nil
+		}
+		if name, ok := written[file]; ok {
+			return name, nil
+		}
+		name := archivePath(file)
+		if used[name] {
+			name = path.Join(path.Dir(name), fmt.Sprintf("%d-%s", len(used), path.Base(name)))
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			log.Printf("ExportArchive: %v", err)
+			archive.Missing = append(archive.Missing, file)
+			written[file] = ""
+			return "", nil
+		}
+		defer f.Close()
+		fw, err := zw.Create(name)
+		if err != nil {
+			return "", err
+		}
+		h := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(fw, h), f); err != nil {
+			return "", fmt.Errorf("%s: %v", file, err)
+		}
+		sums[name] = hex.EncodeToString(h.Sum(nil))
+		written[file] = name
+		used[name] = true
+		return name, nil
+	}
+
+	for i, order := range archive.Orders {
+		if archive.Orders[i].FileOriginal, err = addFile(order.FileOriginal); err != nil {
+			return archive, err
+		}
+		if archive.Orders[i].FileCopy, err = addFile(order.FileCopy); err != nil {
+			return archive, err
+		}
+		signature, err := m.db.GetSignature(ctx, order.ID)
+		if err != nil {
+			return archive, err
+		}
+		if signature.OrderID != 0 {
+			if signature.File, err = addFile(signature.File); err != nil {
+				return archive, err
+			}
+			archive.Signatures = append(archive.Signatures, signature)
+		}
+	}
+
+	manifest, err := json.MarshalIndent(archive, "", "  ")
+	if err != nil {
+		return archive, err
+	}
+	fw, err := zw.Create(ArchiveManifest)
+	if err != nil {
+		return archive, err
+	}
+	if _, err := fw.Write(manifest); err != nil {
+		return archive, err
+	}
+	sum := sha256.Sum256(manifest)
+	sums[ArchiveManifest] = hex.EncodeToString(sum[:])
+
+	// контрольные суммы в формате sha256sum, чтобы пакет можно было проверить без программы
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s  %s\n", sums[name], name)
+	}
+	fw, err = zw.Create(ArchiveChecksums)
+	if err != nil {
+		return archive, err
+	}
+	if _, err := fw.Write(buf.Bytes()); err != nil {
+		return archive, err
+	}
+	return archive, zw.Close()
+}
+
+// ImportArchive восстанавливает пакет ExportArchive в пустую БД: проверяет контрольные суммы,
+// записывает реестр одной транзакцией с новыми идентификаторами и только затем переносит файлы
+// в каталог загрузок. Если файл с таким путем уже есть, пакет не восстанавливается
+func (m *Model) ImportArchive(ctx context.Context, r io.ReaderAt, size int64) (Archive, error) {
+	archive := Archive{}
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return archive, err
+	}
+	entries := map[string]*zip.File{}
+	for _, f := range zr.File {
+		entries[f.Name] = f
+	}
+
+	sumsFile, ok := entries[ArchiveChecksums]
+	if !ok {
+		return archive, fmt.Errorf("в пакете нет %s", ArchiveChecksums)
+	}
+	data, err := readZipFile(sumsFile)
+	if err != nil {
+		return archive, err
+	}
+	sums := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), "  ", 2)
+		if len(fields) != 2 {
+			continue
+		}
+		sums[fields[1]] = fields[0]
+	}
+	for name, f := range entries {
+		if name == ArchiveChecksums {
+			continue
+		}
+		sum, ok := sums[name]
+		if !ok {
+			return archive, fmt.Errorf("нет контрольной суммы для %s", name)
+		}
+		if err := checkZipFile(f, sum); err != nil {
+			return archive, err
+		}
+	}
+	for name := range sums {
+		if _, ok := entries[name]; !ok {
+			return archive, fmt.Errorf("в пакете нет файла %s", name)
+		}
+	}
+
+	manifest, ok := entries[ArchiveManifest]
+	if !ok {
+		return archive, fmt.Errorf("в пакете нет %s", ArchiveManifest)
+	}
+	data, err = readZipFile(manifest)
+	if err != nil {
+		return archive, err
+	}
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return archive, err
+	}
+	if archive.Version < 1 || archive.Version > ArchiveVersion {
+		return archive, fmt.Errorf("неподдерживаемая версия пакета %d", archive.Version)
+	}
+	// в первой версии дерева отделов не было: все отделы верхнего уровня и действующие.
+	// Признак активности справочников мог отсутствовать, поэтому все записи действуют
+	if archive.Version == 1 {
+		for i := range archive.Departaments {
+			archive.Departaments[i].ParentID = 0
+			archive.Departaments[i].Head = ""
+			archive.Departaments[i].Active = true
+		}
+		for i := range archive.DocTypes {
+			archive.DocTypes[i].Active = true
+		}
+		for i := range archive.KindOfDocs {
+			archive.KindOfDocs[i].Active = true
+		}
+		for i := range archive.DocLabels {
+			archive.DocLabels[i].Active = true
+		}
+	}
+
+	// распаковываем файлы во временные рядом с местом назначения, на место переносим
+	// только после записи реестра; уже существующие файлы не трогаем
+	extracted := map[string]string{}
+	staged := map[string]string{}
+	cleanup := func() {
+		for _, tmp := range staged {
+			os.Remove(tmp)
+		}
+	}
+	extract := func(name string) (string, error) {
+		if name == "" {
+			return "", nil
+		}
+		if file, ok := extracted[name]; ok {
+			return file, nil
+		}
+		rel := path.Clean(strings.TrimPrefix(name, ArchiveFiles))
+		if !strings.HasPrefix(name, ArchiveFiles) || strings.HasPrefix(rel, "..") || path.IsAbs(rel) {
+			return "", fmt.Errorf("недопустимый путь файла %s", name)
+		}
+		f, ok := entries[name]
+		if !ok {
+			return "", fmt.Errorf("в пакете нет файла %s", name)
+		}
+		file := filepath.Join(util.UploadDir, filepath.FromSlash(rel))
+		if _, err := os.Lstat(file); err == nil {
+			return "", fmt.Errorf("файл %s уже есть в каталоге загрузок", file)
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return "", err
+		}
+		tmp, err := extractZipFile(f, filepath.Dir(file))
+		if err != nil {
+			return "", err
+		}
+		extracted[name] = file
+		staged[file] = tmp
+		return file, nil
+	}
+	for i, order := range archive.Orders {
+		if archive.Orders[i].FileOriginal, err = extract(order.FileOriginal); err != nil {
+			cleanup()
+			return archive, err
+		}
+		if archive.Orders[i].FileCopy, err = extract(order.FileCopy); err != nil {
+			cleanup()
+			return archive, err
+		}
+	}
+	for i, signature := range archive.Signatures {
+		if archive.Signatures[i].File, err = extract(signature.File); err != nil {
+			cleanup()
+			return archive, err
+		}
+	}
+
+	if err := m.db.RestoreArchive(ctx, archive); err != nil {
+		cleanup()
+		return archive, err
+	}
+	// реестр уже записан: жесткая ссылка не заменит файл, появившийся за время восстановления
+	var moveErr error
+	for file, tmp := range staged {
+		if err := os.Link(tmp, file); err != nil {
+			log.Printf("ImportArchive: %v", err)
+			if moveErr == nil {
+				moveErr = err
+			}
+		}
+	}
+	cleanup()
+	return archive, moveErr
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	var buf bytes.Buffer
+	_, err = io.Copy(&buf, rc)
+	return buf.Bytes(), err
+}
+
+func checkZipFile(f *zip.File, sum string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, rc); err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != sum {
+		return fmt.Errorf("контрольная сумма %s не совпадает", f.Name)
+	}
+	return nil
+}
+
+// extractZipFile распаковывает файл пакета во временный файл каталога dir и возвращает его имя
+func extractZipFile(f *zip.File, dir string) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	dst, err := ioutil.TempFile(dir, ".import-")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(dst, rc)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return "", err
+	}
+	return dst.Name(), nil
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Источники автозаполнения: справочники приказов, отделы, пользователи и номера приказов
+const (
+	AutocompleteDepartaments = "departaments"
+	AutocompleteUsers        = "users"
+	AutocompleteRegNumbers   = "reg_numbers"
+)
+
+// AutocompletePageSize — число вариантов на одной странице автозаполнения
+const AutocompletePageSize = 20
+
+// AutocompleteSources — допустимые источники: имена справочников и остальные источники
+var AutocompleteSources = map[string]bool{
+	HandbookDocType:          true,
+	HandbookKindOfDoc:        true,
+	HandbookDocLabel:         true,
+	AutocompleteDepartaments: true,
+	AutocompleteUsers:        true,
+	AutocompleteRegNumbers:   true,
+}
+
+// AutocompletePage — страница вариантов: сначала начинающиеся с введенного текста,
+// затем содержащие его. More — есть следующая страница
+type AutocompletePage struct {
+	Items []string
+	More  bool
+}
+
+// Autocomplete возвращает варианты из источника source, содержащие term, страницу page с 1.
+// Отключенные записи справочников и отделы не предлагаются
+func (m *Model) Autocomplete(ctx context.Context, source, term string, page int) (AutocompletePage, error) {
+	result := AutocompletePage{Items: []string{}}
+	if !AutocompleteSources[source] {
+		return result, fmt.Errorf("неизвестный источник автозаполнения %q", source)
+	}
+	if page < 1 {
+		page = 1
+	}
+	// запрашиваем на один вариант больше, чтобы узнать, есть ли следующая страница
+	items, err := m.db.Autocomplete(ctx, source, strings.TrimSpace(term), (page-1)*AutocompletePageSize, AutocompletePageSize+1)
+	if err != nil {
+		return result, err
+	}
+	if len(items) > AutocompletePageSize {
+		items, result.More = items[:AutocompletePageSize], true
+	}
+	result.Items = items
+	return result, nil
+}
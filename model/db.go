@@ -1,34 +1,88 @@
 package model
 
 import (
+	"context"
 	"time"
+
+	"../util"
 )
 
 type db interface {
-	GetUsers() ([]User, error)
-	GetUser(id int64) (User, error)
-	CreateUser(user User) error
-	UpdateUser(user User) error
-	DeleteUser(id int64) error
-	GetOrders(limit, offset int) ([]Order, error)
-	GetUserByUsername(username string) (User, error)
-	GetOrder(id int64) (Order, error)
-	DeleteOrder(id int64) error
-	UpdateOrder(order Order) error
-	CreateOrder(order Order) error
-	GetDateOrders(startDate, endDate time.Time, limit, offset int) ([]Order, error)
-	GetDateUserByUsername(startDate, endDate time.Time, username string, limit, offset int) ([]Order, error)
-	GetCountDateOrdersByUsername(startDate, endDate time.Time, username string) (int, error)
-	GetCountDateOrders(startDate, endDate time.Time) (int, error)
-	GetSearchOrders(order Order, startDate, endDate time.Time) ([]Order, error)
-	GetDepartaments() ([]Departament, error)
-	GetDepartament(departamentID int64) (Departament, error)
-	CreateDepartament(departament Departament) error
-	CreateHBKindOfDoc(hbkind HBKindOfDoc) error
-	GetHBKindOfDoc() ([]HBKindOfDoc, error)
-	CreateHBDocLabel(hblabel HBDocLabel) error
-	GetHBDocLabel() ([]HBDocLabel, error)
-	CreateHBDocType(hbtype HBDocType) error
-	GetHBDocType() ([]HBDocType, error)
-	Get2HBDocType(codeFragment string) ([]HBDocType, error)
+	GetUsers(ctx context.Context) ([]User, error)
+	GetUser(ctx context.Context, id int64) (User, error)
+	CreateUser(ctx context.Context, user User) error
+	UpdateUser(ctx context.Context, user User) error
+	DeleteUser(ctx context.Context, id int64) error
+	GetOrders(ctx context.Context, limit, offset int) ([]Order, error)
+	GetUserByUsername(ctx context.Context, username string) (User, error)
+	SetPassword(ctx context.Context, id int64, hash string, mustChange bool) error
+	GetTOTP(ctx context.Context, userID int64) (TOTP, error)
+	SaveTOTP(ctx context.Context, userID int64, secret string, enabled bool) error
+	UseTOTPStep(ctx context.Context, userID, step int64) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, hashes []string) error
+	UseRecoveryCode(ctx context.Context, userID int64, hash string) (bool, error)
+	CountRecoveryCodes(ctx context.Context, userID int64) (int, error)
+	GetOrder(ctx context.Context, id int64) (Order, error)
+	DeleteOrder(ctx context.Context, id int64) error
+	Begin(ctx context.Context) (Tx, error)
+	GetOrdersPage(ctx context.Context, startDate, endDate time.Time, username, sortBy string, sortDesc bool, cursor util.Cursor, offset, limit int) ([]Order, error)
+	GetCountDateOrdersByUsername(ctx context.Context, startDate, endDate time.Time, username string) (int, error)
+	GetCountDateOrders(ctx context.Context, startDate, endDate time.Time) (int, error)
+	GetStatOrders(ctx context.Context, startDate, endDate time.Time) ([]StatRow, error)
+	GetOrderCountsByYear(ctx context.Context) ([]YearCount, error)
+	GetSearchOrders(ctx context.Context, order Order, startDate, endDate time.Time) ([]Order, error)
+	GetDepartaments(ctx context.Context) ([]Departament, error)
+	GetDepartament(ctx context.Context, departamentID int64) (Departament, error)
+	CreateDepartament(ctx context.Context, departament Departament) error
+	UpdateDepartament(ctx context.Context, departament Departament) error
+	DeleteDepartament(ctx context.Context, id, reassignTo int64) error
+	ImportOrgChart(ctx context.Context, departaments []OrgImportRow) error
+	CreateHBKindOfDoc(ctx context.Context, hbkind HBKindOfDoc) error
+	GetHBKindOfDoc(ctx context.Context) ([]HBKindOfDoc, error)
+	CreateHBDocLabel(ctx context.Context, hblabel HBDocLabel) error
+	GetHBDocLabel(ctx context.Context) ([]HBDocLabel, error)
+	CreateHBDocType(ctx context.Context, hbtype HBDocType) error
+	GetHBDocType(ctx context.Context) ([]HBDocType, error)
+	Autocomplete(ctx context.Context, source, term string, offset, limit int) ([]string, error)
+	GetHandbookEntries(ctx context.Context, handbook string) ([]HandbookEntry, error)
+	RenameHandbookEntry(ctx context.Context, handbook string, id int64, name string) error
+	SetHandbookEntryActive(ctx context.Context, handbook string, id int64, active bool) error
+	MergeHandbookEntries(ctx context.Context, handbook string, fromID, intoID int64) error
+	GetSchedules(ctx context.Context) ([]Schedule, error)
+	CreateSchedule(ctx context.Context, schedule Schedule) error
+	DeleteSchedule(ctx context.Context, id int64) error
+	UpdateScheduleLastRun(ctx context.Context, id int64, lastRun time.Time) error
+	GetDepartamentOrders(ctx context.Context, departament string, startDate, endDate time.Time) ([]Order, error)
+	GetCancelledOrders(ctx context.Context, departament string, startDate, endDate time.Time) ([]Order, error)
+	CreateNotification(ctx context.Context, notification Notification) error
+	GetNotifications(ctx context.Context, userID int64, limit int) ([]Notification, error)
+	GetCountUnreadNotifications(ctx context.Context, userID int64) (int, error)
+	MarkNotificationsRead(ctx context.Context, userID int64) error
+	GetSubscriptions(ctx context.Context, userID int64) ([]Subscription, error)
+	GetSubscribers(ctx context.Context, docType, username string) ([]Subscription, error)
+	CreateSubscription(ctx context.Context, subscription Subscription) error
+	DeleteSubscription(ctx context.Context, id, userID int64) error
+	GetWebhooks(ctx context.Context) ([]Webhook, error)
+	CreateWebhook(ctx context.Context, webhook Webhook) error
+	DeleteWebhook(ctx context.Context, id int64) error
+	GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]Delivery, error)
+	GetDeliveries(ctx context.Context, status string, limit int) ([]Delivery, error)
+	UpdateDelivery(ctx context.Context, delivery Delivery) error
+	RetryDelivery(ctx context.Context, id int64) error
+	GetOrderTransitions(ctx context.Context, orderID int64) ([]OrderTransition, error)
+	GetWorkflowOrders(ctx context.Context, status, username string) ([]Order, error)
+	SaveSignature(ctx context.Context, signature Signature) error
+	GetSignature(ctx context.Context, orderID int64) (Signature, error)
+	BuildDisposalAct(ctx context.Context, now time.Time) (int64, int, error)
+	GetDisposalActs(ctx context.Context) ([]DisposalAct, error)
+	GetDisposalAct(ctx context.Context, id int64) (DisposalAct, error)
+	ApproveDisposalAct(ctx context.Context, id int64, version int, username, comment string) ([]string, error)
+	ExcludeDisposalItem(ctx context.Context, actID, itemID int64) error
+	UpdateHBKindOfDocRetention(ctx context.Context, id int64, retentionYears int) error
+	ImportOrders(ctx context.Context, orders []Order, handbooks ImportHandbooks) error
+	RegNumberTaken(ctx context.Context, year int, number string) (bool, error)
+	GetAllOrders(ctx context.Context) ([]Order, error)
+	GetPreferences(ctx context.Context, userID int64) (Preferences, error)
+	SavePreferences(ctx context.Context, prefs Preferences) error
+	RestoreArchive(ctx context.Context, archive Archive) error
 }
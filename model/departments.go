@@ -1,7 +1,326 @@
 package model
 
-// Departament is ...
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Departament — отдел. Отделы образуют дерево по ParentID: подписки и рассылки
+// по отделу охватывают все вложенные отделы, руководитель видит приказы
+// сотрудников своего отдела и вложенных в него
 type Departament struct {
-	ID     int64  // Идентификатор
-	Title  string // Наименование
+	ID       int64  // Идентификатор
+	ParentID int64  // Вышестоящий отдел, 0 — верхний уровень
+	Code     string // Код в оргструктуре, по нему сверяется загрузка
+	Title    string // Наименование
+	Head     string // Руководитель (имя пользователя), пусто — не назначен
+	Active   bool   // Действующий отдел
+	Level    int    // Глубина в дереве, заполняет DepartamentTree
+}
+
+// DepartamentTree возвращает отделы в порядке обхода дерева: за отделом идут вложенные в него,
+// с глубиной Level. Отделы с неизвестным вышестоящим считаются верхним уровнем
+func DepartamentTree(departaments []Departament) []Departament {
+	known := map[int64]bool{}
+	for _, d := range departaments {
+		known[d.ID] = true
+	}
+	children := map[int64][]Departament{}
+	for _, d := range departaments {
+		parent := d.ParentID
+		if !known[parent] || parent == d.ID {
+			parent = 0
+		}
+		children[parent] = append(children[parent], d)
+	}
+	tree := make([]Departament, 0, len(departaments))
+	visited := map[int64]bool{}
+	var walk func(parent int64, level int)
+	walk = func(parent int64, level int) {
+		list := children[parent]
+		sort.Slice(list, func(i, j int) bool { return list[i].Title < list[j].Title })
+		for _, d := range list {
+			if visited[d.ID] {
+				continue
+			}
+			visited[d.ID] = true
+			d.Level = level
+			tree = append(tree, d)
+			walk(d.ID, level+1)
+		}
+	}
+	walk(0, 0)
+	return tree
+}
+
+// subtree возвращает id отдела и всех вложенных в него
+func subtree(departaments []Departament, id int64) map[int64]bool {
+	ids := map[int64]bool{id: true}
+	for changed := true; changed; {
+		changed = false
+		for _, d := range departaments {
+			if ids[d.ParentID] && !ids[d.ID] {
+				ids[d.ID] = true
+				changed = true
+			}
+		}
+	}
+	return ids
+}
+
+// SaveDepartament добавляет отдел, если ID пуст, иначе сохраняет изменения.
+// Отдел нельзя вложить в самого себя или в свой вложенный отдел
+func (m *Model) SaveDepartament(ctx context.Context, departament Departament) error {
+	departament.Title = strings.TrimSpace(departament.Title)
+	departament.Code = strings.TrimSpace(departament.Code)
+	if departament.Title == "" {
+		return fmt.Errorf("не указано наименование отдела")
+	}
+	if departament.ParentID != 0 {
+		all, err := m.db.GetDepartaments(ctx)
+		if err != nil {
+			return err
+		}
+		if departament.ID != 0 && subtree(all, departament.ID)[departament.ParentID] {
+			return fmt.Errorf("отдел нельзя вложить в самого себя или во вложенный в него отдел")
+		}
+	}
+	if departament.ID == 0 {
+		return m.db.CreateDepartament(ctx, departament)
+	}
+	return m.db.UpdateDepartament(ctx, departament)
+}
+
+// DeleteDepartament удаляет отдел. Сотрудники, рассылки и подписки отдела переходят
+// в отдел reassignTo (0 — в вышестоящий), вложенные отделы — в вышестоящий
+func (m *Model) DeleteDepartament(ctx context.Context, id, reassignTo int64) error {
+	departament, err := m.db.GetDepartament(ctx, id)
+	if err != nil {
+		return err
+	}
+	if reassignTo == 0 {
+		reassignTo = departament.ParentID
+	}
+	if reassignTo == 0 {
+		return fmt.Errorf("у отдела %q нет вышестоящего, укажите отдел, в который перевести сотрудников", departament.Title)
+	}
+	if reassignTo == id {
+		return fmt.Errorf("сотрудников нельзя перевести в удаляемый отдел")
+	}
+	return m.db.DeleteDepartament(ctx, id, reassignTo)
+}
+
+// Поля отдела, которые можно загрузить из таблицы оргструктуры
+const (
+	OrgCode   = "code"
+	OrgTitle  = "title"
+	OrgParent = "parent"
+	OrgHead   = "head"
+	OrgActive = "active"
+)
+
+// OrgColumns — допустимые заголовки столбцов таблицы оргструктуры
+var OrgColumns = map[string]string{
+	"code":             OrgCode,
+	"код":              OrgCode,
+	"title":            OrgTitle,
+	"наименование":     OrgTitle,
+	"отдел":            OrgTitle,
+	"parent":           OrgParent,
+	"parent_code":      OrgParent,
+	"вышестоящий":      OrgParent,
+	"код вышестоящего": OrgParent,
+	"head":             OrgHead,
+	"руководитель":     OrgHead,
+	"active":           OrgActive,
+	"действует":        OrgActive,
+}
+
+// OrgImportResult — отчет о загрузке оргструктуры
+type OrgImportResult struct {
+	Total   int           // Строк с данными
+	Created int           // Новых отделов
+	Updated int           // Обновленных отделов
+	DryRun  bool          // Пробный запуск
+	Errors  []ImportError // Ошибки по строкам
+}
+
+// OrgImportRow — отдел из таблицы; вышестоящий задан кодом
+type OrgImportRow struct {
+	Departament
+	ParentCode string
+}
+
+// ParseOrgRows разбирает таблицу оргструктуры: первая строка — заголовки,
+// каждая следующая — отдел. Код и наименование обязательны
+func ParseOrgRows(rows [][]string) ([]OrgImportRow, []int, []ImportError) {
+	if len(rows) == 0 {
+		return nil, nil, []ImportError{{Row: 1, Message: "таблица пуста"}}
+	}
+	columns := make([]string, len(rows[0]))
+	found := map[string]bool{}
+	for i, title := range rows[0] {
+		if field, ok := OrgColumns[strings.ToLower(strings.TrimSpace(title))]; ok {
+			columns[i] = field
+			found[field] = true
+		}
+	}
+	var errs []ImportError
+	for _, field := range []string{OrgCode, OrgTitle} {
+		if !found[field] {
+			errs = append(errs, ImportError{Row: 1, Message: fmt.Sprintf("нет обязательного столбца %s", field)})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	var deps []OrgImportRow
+	var lines []int
+	codes := map[string]int{}
+	titles := map[string]int{}
+	for n, row := range rows[1:] {
+		line := n + 2
+		if isEmptyRow(row) {
+			continue
+		}
+		d := OrgImportRow{Departament: Departament{Active: true}}
+		var rowErrs []string
+		for i, field := range columns {
+			if field == "" {
+				continue
+			}
+			value := ""
+			if i < len(row) {
+				value = strings.TrimSpace(row[i])
+			}
+			switch field {
+			case OrgCode:
+				d.Code = value
+			case OrgTitle:
+				d.Title = value
+			case OrgParent:
+				d.ParentCode = value
+			case OrgHead:
+				d.Head = value
+			case OrgActive:
+				switch strings.ToLower(value) {
+				case "", "да", "1", "true", "+":
+					d.Active = true
+				case "нет", "0", "false", "-":
+					d.Active = false
+				default:
+					rowErrs = append(rowErrs, fmt.Sprintf("непонятное значение %q в столбце active", value))
+				}
+			}
+		}
+		if d.Code == "" {
+			rowErrs = append(rowErrs, "не указан код отдела")
+		} else if prev, ok := codes[d.Code]; ok {
+			rowErrs = append(rowErrs, fmt.Sprintf("код %s уже встречается в строке %d", d.Code, prev))
+		} else {
+			codes[d.Code] = line
+		}
+		if d.Title == "" {
+			rowErrs = append(rowErrs, "не указано наименование отдела")
+		} else if prev, ok := titles[d.Title]; ok {
+			rowErrs = append(rowErrs, fmt.Sprintf("отдел %q уже встречается в строке %d", d.Title, prev))
+		} else {
+			titles[d.Title] = line
+		}
+		if d.ParentCode != "" && d.ParentCode == d.Code {
+			rowErrs = append(rowErrs, "отдел не может быть вышестоящим для самого себя")
+		}
+		for _, msg := range rowErrs {
+			errs = append(errs, ImportError{Row: line, Message: msg})
+		}
+		deps = append(deps, d)
+		lines = append(lines, line)
+	}
+	return deps, lines, errs
+}
+
+// ImportOrgChart загружает оргструктуру из таблицы. Отделы сверяются по коду:
+// существующие обновляются, новые добавляются, отсутствующие в таблице не меняются.
+// Вышестоящий отдел ищется по коду в таблице и в БД, руководитель — среди пользователей.
+// При наличии ошибок или в пробном запуске в БД ничего не записывается
+func (m *Model) ImportOrgChart(ctx context.Context, rows [][]string, dryRun bool) (OrgImportResult, error) {
+	result := OrgImportResult{DryRun: dryRun}
+	deps, lines, errs := ParseOrgRows(rows)
+	result.Total = len(deps)
+	result.Errors = errs
+
+	existing, err := m.db.GetDepartaments(ctx)
+	if err != nil {
+		return result, err
+	}
+	users, err := m.db.GetUsers(ctx)
+	if err != nil {
+		return result, err
+	}
+	usernames := map[string]bool{}
+	for _, u := range users {
+		usernames[u.Username] = true
+	}
+
+	byCode := map[string]Departament{}
+	byTitle := map[string]Departament{}
+	codeOf := map[int64]string{}
+	for _, d := range existing {
+		byTitle[d.Title] = d
+		codeOf[d.ID] = d.Code
+		if d.Code != "" {
+			byCode[d.Code] = d
+		}
+	}
+	// итоговое дерево по кодам: отделы из БД, поверх — строки таблицы
+	parentOf := map[string]string{}
+	for code, d := range byCode {
+		parentOf[code] = codeOf[d.ParentID]
+	}
+	for _, d := range deps {
+		if d.Code != "" {
+			parentOf[d.Code] = d.ParentCode
+		}
+	}
+	for i, d := range deps {
+		if d.Code == "" {
+			continue
+		}
+		// отдел без кода, заведенный до загрузки оргструктуры, получает код из таблицы
+		if _, ok := byCode[d.Code]; ok {
+			result.Updated++
+		} else if prev, ok := byTitle[d.Title]; ok && prev.Code == "" {
+			result.Updated++
+		} else if ok {
+			result.Errors = append(result.Errors, ImportError{Row: lines[i], Message: fmt.Sprintf("отдел %q уже есть в БД с кодом %s", d.Title, prev.Code)})
+		} else {
+			result.Created++
+		}
+		if _, ok := parentOf[d.ParentCode]; d.ParentCode != "" && !ok {
+			result.Errors = append(result.Errors, ImportError{Row: lines[i], Message: fmt.Sprintf("вышестоящего отдела с кодом %s нет ни в таблице, ни в БД", d.ParentCode)})
+		}
+		if d.Head != "" && !usernames[d.Head] {
+			result.Errors = append(result.Errors, ImportError{Row: lines[i], Message: fmt.Sprintf("пользователя %q нет", d.Head)})
+		}
+		// поднимаемся к корню: если вернулись к себе — в дереве цикл
+		for code, steps := parentOf[d.Code], 0; code != "" && steps <= len(parentOf); code, steps = parentOf[code], steps+1 {
+			if code == d.Code {
+				result.Errors = append(result.Errors, ImportError{Row: lines[i], Message: fmt.Sprintf("отдел %s оказывается вложенным в самого себя", d.Code)})
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(result.Errors, func(i, j int) bool { return result.Errors[i].Row < result.Errors[j].Row })
+
+	if dryRun || len(result.Errors) > 0 {
+		return result, nil
+	}
+	if err := m.db.ImportOrgChart(ctx, deps); err != nil {
+		return result, err
+	}
+	return result, nil
 }
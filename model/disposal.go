@@ -0,0 +1,81 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Состояния акта о выделении документов к уничтожению
+const (
+	ActDraft    = "draft"    // Формируется
+	ActApproved = "approved" // Утвержден архивариусом
+	ActPurged   = "purged"   // Документы уничтожены
+)
+
+// ActStatusTitles — наименования состояний акта для интерфейса
+var ActStatusTitles = map[string]string{
+	ActDraft:    "Формируется",
+	ActApproved: "Утвержден",
+	ActPurged:   "Документы уничтожены",
+}
+
+// DisposalAct — акт о выделении к уничтожению документов с истекшим сроком хранения
+type DisposalAct struct {
+	ID       int64          // Идентификатор
+	Created  time.Time      // Дата формирования
+	Status   string         // draft, approved, purged
+	Approver string         // Утвердивший архивариус
+	Approved time.Time      // Дата утверждения
+	Comment  string         // Комментарий архивариуса
+	Version  int            // Растет при каждом изменении состава акта
+	Count    int            // Количество документов в акте
+	Items    []DisposalItem // Документы акта
+}
+
+// DisposalItem — документ в акте. Реквизиты копируются в акт,
+// чтобы акт остался после удаления приказа
+type DisposalItem struct {
+	ID          int64     // Идентификатор
+	ActID       int64     // Акт
+	OrderID     int64     // Приказ (0 — уже удален)
+	DocType     string    // Тип документа
+	KindOfDoc   string    // Вид документа
+	RegDate     time.Time // Дата регистрации
+	RegNumber   string    // Регистрационный номер
+	Description string    // Описание
+	DueDate     time.Time // Дата истечения срока хранения
+}
+
+// DisposalDueDate возвращает дату истечения срока хранения: срок исчисляется
+// с 1 января года, следующего за годом регистрации
+func DisposalDueDate(regDate time.Time, retentionYears int) time.Time {
+	return time.Date(regDate.Year()+1+retentionYears, 1, 1, 0, 0, 0, 0, regDate.Location())
+}
+
+// CanApproveDisposal сообщает, может ли пользователь утверждать акты
+func CanApproveDisposal(user User) bool {
+	return user.IsAdmin || user.Role == RoleArchivist
+}
+
+// ApproveDisposalAct утверждает версию акта, которую видел архивариус, и уничтожает
+// перечисленные в ней приказы одной транзакцией. Если с тех пор акт пополнился или из него
+// исключили документ, утверждение отклоняется. Файлы удаляются после фиксации,
+// кроме прикрепленных и к другим приказам
+func (m *Model) ApproveDisposalAct(ctx context.Context, actID int64, version int, user User, comment string) error {
+	if !CanApproveDisposal(user) {
+		return fmt.Errorf("пользователь %s не может утверждать акты", user.Username)
+	}
+	files, err := m.db.ApproveDisposalAct(ctx, actID, version, user.Username, comment)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			log.Printf("ApproveDisposalAct: %v", err)
+		}
+	}
+	return nil
+}
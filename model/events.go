@@ -0,0 +1,85 @@
+package model
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// EventType — тип события модели
+type EventType string
+
+// События, которые публикует модель
+const (
+	OrderCreated   EventType = "OrderCreated"
+	OrderUpdated   EventType = "OrderUpdated"
+	OrderCancelled EventType = "OrderCancelled"
+	UserCreated    EventType = "UserCreated"
+)
+
+// Event — событие модели. Для событий приказов заполнено поле Order,
+// для событий пользователей — User
+type Event struct {
+	Type  EventType
+	Time  time.Time
+	Order Order
+	User  User
+}
+
+// Handler — подписчик на события модели
+type Handler func(Event)
+
+// Bus — шина событий модели
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+	queue    chan Event
+}
+
+// NewBus создает шину и запускает доставку событий подписчикам
+func NewBus() *Bus {
+	b := &Bus{queue: make(chan Event, 100)}
+	go b.dispatch()
+	return b
+}
+
+// Subscribe добавляет подписчика на все события
+func (b *Bus) Subscribe(h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers = append(b.handlers, h)
+}
+
+// PublishTimeout — сколько Publish ждет места в заполненной очереди, прежде чем отбросить событие
+var PublishTimeout = 10 * time.Second
+
+// Publish ставит событие в очередь, не дожидаясь подписчиков. Если очередь заполнена,
+// ждет освобождения места не дольше PublishTimeout
+func (b *Bus) Publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	select {
+	case b.queue <- e:
+		return
+	default:
+	}
+	timer := time.NewTimer(PublishTimeout)
+	defer timer.Stop()
+	select {
+	case b.queue <- e:
+	case <-timer.C:
+		log.Printf("event bus: queue is full for %s, dropping %s", PublishTimeout, e.Type)
+	}
+}
+
+func (b *Bus) dispatch() {
+	for e := range b.queue {
+		b.mu.RLock()
+		handlers := b.handlers
+		b.mu.RUnlock()
+		for _, h := range handlers {
+			h(e)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package model
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBusPublishWaitsForFullQueue(t *testing.T) {
+	b := NewBus()
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	received := 0
+	b.Subscribe(func(e Event) {
+		<-release
+		mu.Lock()
+		received++
+		mu.Unlock()
+		wg.Done()
+	})
+
+	// очередь на 100 событий и одно в обработке: остальные должны дождаться места
+	const n = 150
+	wg.Add(n)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < n; i++ {
+			b.Publish(Event{Type: OrderCreated})
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Publish не ждал места в заполненной очереди")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	wg.Wait()
+	<-done
+	if received != n {
+		t.Errorf("доставлено %d событий из %d", received, n)
+	}
+}
+
+func TestBusPublishTimeout(t *testing.T) {
+	old := PublishTimeout
+	PublishTimeout = 10 * time.Millisecond
+	defer func() { PublishTimeout = old }()
+
+	b := &Bus{queue: make(chan Event)} // без dispatch очередь никто не читает
+	start := time.Now()
+	b.Publish(Event{Type: OrderCreated})
+	if d := time.Since(start); d < PublishTimeout {
+		t.Errorf("Publish вернулся через %s, раньше PublishTimeout", d)
+	}
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Справочники приказов, значения — имена таблиц
+const (
+	HandbookDocType   = "hbtype"
+	HandbookKindOfDoc = "hbkind"
+	HandbookDocLabel  = "hblabel"
+)
+
+// Handbook — справочник приказов
+type Handbook struct {
+	Name  string // Имя таблицы
+	Title string // Наименование поля приказа
+}
+
+// Handbooks — справочники в порядке полей формы приказа
+var Handbooks = []Handbook{
+	{HandbookDocType, "Тип документа"},
+	{HandbookKindOfDoc, "Вид документа"},
+	{HandbookDocLabel, "Штамп секретности"},
+}
+
+// FindHandbook находит справочник по имени таблицы
+func FindHandbook(name string) (Handbook, bool) {
+	for _, hb := range Handbooks {
+		if hb.Name == name {
+			return hb, true
+		}
+	}
+	return Handbook{}, false
+}
+
+// HandbookEntry — запись справочника на странице администратора
+type HandbookEntry struct {
+	ID     int64  // Идентификатор
+	Name   string // Наименование
+	Active bool   // Доступна для новых приказов
+	Orders int    // Количество приказов с этой записью
+}
+
+// RenameHandbookEntry переименовывает запись справочника
+func (m *Model) RenameHandbookEntry(ctx context.Context, handbook string, id int64, name string) error {
+	if _, ok := FindHandbook(handbook); !ok {
+		return fmt.Errorf("неизвестный справочник %q", handbook)
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("наименование не может быть пустым")
+	}
+	return m.db.RenameHandbookEntry(ctx, handbook, id, name)
+}
+
+// SetHandbookEntryActive отключает запись справочника или включает ее снова.
+// Отключенная запись остается у существующих приказов, но не предлагается для новых
+func (m *Model) SetHandbookEntryActive(ctx context.Context, handbook string, id int64, active bool) error {
+	if _, ok := FindHandbook(handbook); !ok {
+		return fmt.Errorf("неизвестный справочник %q", handbook)
+	}
+	return m.db.SetHandbookEntryActive(ctx, handbook, id, active)
+}
+
+// MergeHandbookEntries переносит все приказы и ссылки с записи fromID на intoID
+// и удаляет запись fromID
+func (m *Model) MergeHandbookEntries(ctx context.Context, handbook string, fromID, intoID int64) error {
+	if _, ok := FindHandbook(handbook); !ok {
+		return fmt.Errorf("неизвестный справочник %q", handbook)
+	}
+	if fromID == intoID {
+		return fmt.Errorf("запись нельзя объединить саму с собой")
+	}
+	return m.db.MergeHandbookEntries(ctx, handbook, fromID, intoID)
+}
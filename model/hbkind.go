@@ -2,6 +2,8 @@ package model
 
 // HBKindOfDoc is ...
 type HBKindOfDoc struct {
-	ID   int64  // Идентификатор
-	Name string // Наименование
+	ID             int64  // Идентификатор
+	Name           string // Наименование
+	Active         bool   // Доступен для новых приказов
+	RetentionYears int    // Срок хранения в годах, 0 — постоянно
 }
@@ -2,6 +2,7 @@ package model
 
 // HBDocLabel is ...
 type HBDocLabel struct {
-	ID   int64  // Идентификатор
-	Name string // Наименование
+	ID     int64  // Идентификатор
+	Name   string // Наименование
+	Active bool   // Доступен для новых приказов
 }
@@ -2,6 +2,7 @@ package model
 
 // HBDocType is ...
 type HBDocType struct {
-	ID   int64  // Идентификатор
-	Name string // Наименование
+	ID     int64  // Идентификатор
+	Name   string // Наименование
+	Active bool   // Доступен для новых приказов
 }
@@ -0,0 +1,277 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Поля приказа, которые можно загрузить из таблицы
+const (
+	ImportDocType     = "doc_type"
+	ImportKindOfDoc   = "kind_of_doc"
+	ImportDocLabel    = "doc_label"
+	ImportRegDate     = "reg_date"
+	ImportRegNumber   = "reg_number"
+	ImportDescription = "description"
+	ImportCurrent     = "current"
+)
+
+// ImportColumns — допустимые заголовки столбцов таблицы и соответствующие им поля приказа
+var ImportColumns = map[string]string{
+	"doc_type":         ImportDocType,
+	"тип":              ImportDocType,
+	"тип документа":    ImportDocType,
+	"kind_of_doc":      ImportKindOfDoc,
+	"вид":              ImportKindOfDoc,
+	"вид документа":    ImportKindOfDoc,
+	"doc_label":        ImportDocLabel,
+	"штамп":            ImportDocLabel,
+	"пометка":          ImportDocLabel,
+	"reg_date":         ImportRegDate,
+	"дата":             ImportRegDate,
+	"дата регистрации": ImportRegDate,
+	"reg_number":       ImportRegNumber,
+	"номер":            ImportRegNumber,
+	"рег. номер":       ImportRegNumber,
+	"регистрационный номер": ImportRegNumber,
+	"description": ImportDescription,
+	"описание":    ImportDescription,
+	"current":     ImportCurrent,
+	"действует":   ImportCurrent,
+}
+
+// форматы дат, встречающиеся в старых таблицах
+var importDateLayouts = []string{"02.01.2006", "2006-01-02", "02-01-2006", "02/01/2006", "2.1.2006"}
+
+// ImportOptions — параметры загрузки
+type ImportOptions struct {
+	DryRun          bool   // Только проверить, ничего не записывая
+	CreateHandbooks bool   // Добавлять в справочники отсутствующие наименования
+	Username        string // Автор загружаемых приказов
+}
+
+// ImportError — ошибка в строке таблицы
+type ImportError struct {
+	Row     int    // Номер строки в таблице, начиная с 1
+	Message string // Описание ошибки
+}
+
+// ImportHandbooks — наименования, которые будут добавлены в справочники
+type ImportHandbooks struct {
+	DocTypes   []string
+	KindOfDocs []string
+	DocLabels  []string
+}
+
+// ImportResult — отчет о загрузке
+type ImportResult struct {
+	Total     int             // Строк с данными
+	Imported  int             // Загружено приказов
+	DryRun    bool            // Пробный запуск
+	Handbooks ImportHandbooks // Новые наименования справочников
+	Errors    []ImportError   // Ошибки по строкам
+}
+
+// ParseImportRows разбирает таблицу: первая строка — заголовки столбцов,
+// остальные — приказы. Пустые строки пропускаются
+func ParseImportRows(rows [][]string) ([]Order, []int, []ImportError) {
+	if len(rows) == 0 {
+		return nil, nil, []ImportError{{Row: 1, Message: "таблица пуста"}}
+	}
+	columns := make([]string, len(rows[0]))
+	found := map[string]bool{}
+	for i, title := range rows[0] {
+		if field, ok := ImportColumns[strings.ToLower(strings.TrimSpace(title))]; ok {
+			columns[i] = field
+			found[field] = true
+		}
+	}
+	var errs []ImportError
+	// штамп в orders.doc_label_id обязателен, как и в форме приказа
+	for _, field := range []string{ImportDocType, ImportKindOfDoc, ImportDocLabel, ImportRegDate, ImportRegNumber} {
+		if !found[field] {
+			errs = append(errs, ImportError{Row: 1, Message: fmt.Sprintf("нет обязательного столбца %s", field)})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	var orders []Order
+	var lines []int
+	seen := map[string]int{}
+	for n, row := range rows[1:] {
+		line := n + 2
+		if isEmptyRow(row) {
+			continue
+		}
+		order := Order{Current: true, Status: StatusRegistered}
+		var rowErrs []string
+		for i, field := range columns {
+			if field == "" {
+				continue
+			}
+			value := ""
+			if i < len(row) {
+				value = strings.TrimSpace(row[i])
+			}
+			switch field {
+			case ImportDocType:
+				order.DocType = value
+			case ImportKindOfDoc:
+				order.KindOfDoc = value
+			case ImportDocLabel:
+				order.DocLabel = value
+			case ImportRegNumber:
+				order.RegNumber = value
+			case ImportDescription:
+				order.Description = value
+			case ImportRegDate:
+				date, err := parseImportDate(value)
+				if err != nil {
+					rowErrs = append(rowErrs, err.Error())
+				}
+				order.RegDate = date
+			case ImportCurrent:
+				switch strings.ToLower(value) {
+				case "", "да", "1", "true", "+":
+					order.Current = true
+				case "нет", "0", "false", "-":
+					order.Current = false
+				default:
+					rowErrs = append(rowErrs, fmt.Sprintf("непонятное значение %q в столбце current", value))
+				}
+			}
+		}
+		if order.DocType == "" {
+			rowErrs = append(rowErrs, "не указан тип документа")
+		}
+		if order.KindOfDoc == "" {
+			rowErrs = append(rowErrs, "не указан вид документа")
+		}
+		if order.DocLabel == "" {
+			rowErrs = append(rowErrs, "не указан штамп")
+		}
+		if order.RegNumber == "" {
+			rowErrs = append(rowErrs, "не указан регистрационный номер")
+		} else if !order.RegDate.IsZero() {
+			key := fmt.Sprintf("%d/%s", order.RegDate.Year(), order.RegNumber)
+			if prev, ok := seen[key]; ok {
+				rowErrs = append(rowErrs, fmt.Sprintf("номер %s за %d год уже встречается в строке %d", order.RegNumber, order.RegDate.Year(), prev))
+			} else {
+				seen[key] = line
+			}
+		}
+		for _, msg := range rowErrs {
+			errs = append(errs, ImportError{Row: line, Message: msg})
+		}
+		orders = append(orders, order)
+		lines = append(lines, line)
+	}
+	return orders, lines, errs
+}
+
+func parseImportDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, fmt.Errorf("не указана дата регистрации")
+	}
+	for _, layout := range importDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("неверная дата регистрации %q", value)
+}
+
+func isEmptyRow(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// ImportOrders загружает приказы из таблицы. Наименования справочников сверяются
+// с hbtype/hbkind/hblabel; при CreateHandbooks отсутствующие будут добавлены, отключенные —
+// ошибка. Номер, уже занятый в году регистрации, тоже ошибка.
+// При наличии ошибок или в пробном запуске в БД ничего не записывается,
+// иначе все приказы записываются одной транзакцией
+func (m *Model) ImportOrders(ctx context.Context, rows [][]string, opts ImportOptions) (ImportResult, error) {
+	result := ImportResult{DryRun: opts.DryRun}
+	orders, lines, errs := ParseImportRows(rows)
+	result.Total = len(orders)
+	result.Errors = errs
+
+	types, err := m.db.GetHBDocType(ctx)
+	if err != nil {
+		return result, err
+	}
+	kinds, err := m.db.GetHBKindOfDoc(ctx)
+	if err != nil {
+		return result, err
+	}
+	labels, err := m.db.GetHBDocLabel(ctx)
+	if err != nil {
+		return result, err
+	}
+	// known: наименование есть в справочнике, значение — доступно ли оно для новых приказов
+	known := map[string]map[string]bool{ImportDocType: {}, ImportKindOfDoc: {}, ImportDocLabel: {}}
+	for _, t := range types {
+		known[ImportDocType][t.Name] = t.Active
+	}
+	for _, k := range kinds {
+		known[ImportKindOfDoc][k.Name] = k.Active
+	}
+	for _, l := range labels {
+		known[ImportDocLabel][l.Name] = l.Active
+	}
+	// проверяем наименование и при необходимости запоминаем его для добавления в справочник
+	resolve := func(field, name, title string, line int, created *[]string) {
+		active, ok := known[field][name]
+		if name == "" || active {
+			return
+		}
+		if ok {
+			result.Errors = append(result.Errors, ImportError{Row: line, Message: fmt.Sprintf("%s %q отключен", title, name)})
+			return
+		}
+		if opts.CreateHandbooks {
+			known[field][name] = true
+			*created = append(*created, name)
+			return
+		}
+		result.Errors = append(result.Errors, ImportError{Row: line, Message: fmt.Sprintf("%s %q нет в справочнике", title, name)})
+	}
+	for i, order := range orders {
+		resolve(ImportDocType, order.DocType, "тип документа", lines[i], &result.Handbooks.DocTypes)
+		resolve(ImportKindOfDoc, order.KindOfDoc, "вид документа", lines[i], &result.Handbooks.KindOfDocs)
+		resolve(ImportDocLabel, order.DocLabel, "штамп", lines[i], &result.Handbooks.DocLabels)
+		orders[i].Username = opts.Username
+		if order.RegNumber == "" || order.RegDate.IsZero() {
+			continue
+		}
+		taken, err := m.db.RegNumberTaken(ctx, order.RegDate.Year(), order.RegNumber)
+		if err != nil {
+			return result, err
+		}
+		if taken {
+			result.Errors = append(result.Errors, ImportError{Row: lines[i],
+				Message: fmt.Sprintf("номер %s за %d год уже есть в БД", order.RegNumber, order.RegDate.Year())})
+		}
+	}
+
+	sort.SliceStable(result.Errors, func(i, j int) bool { return result.Errors[i].Row < result.Errors[j].Row })
+
+	if opts.DryRun || len(result.Errors) > 0 {
+		return result, nil
+	}
+	if err := m.db.ImportOrders(ctx, orders, result.Handbooks); err != nil {
+		return result, err
+	}
+	result.Imported = len(orders)
+	return result, nil
+}
@@ -0,0 +1,97 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// importDb — справочники и занятые номера для проверки загрузки; остальные методы db не нужны
+type importDb struct {
+	db
+	taken    map[string]bool
+	imported []Order
+}
+
+func (d *importDb) GetHBDocType(ctx context.Context) ([]HBDocType, error) {
+	return []HBDocType{{Name: "Приказ", Active: true}, {Name: "Распоряжение", Active: false}}, nil
+}
+
+func (d *importDb) GetHBKindOfDoc(ctx context.Context) ([]HBKindOfDoc, error) {
+	return []HBKindOfDoc{{Name: "По основной деятельности", Active: true}}, nil
+}
+
+func (d *importDb) GetHBDocLabel(ctx context.Context) ([]HBDocLabel, error) {
+	return []HBDocLabel{{Name: "Без штампа", Active: true}}, nil
+}
+
+func (d *importDb) RegNumberTaken(ctx context.Context, year int, number string) (bool, error) {
+	return d.taken[number], nil
+}
+
+func (d *importDb) ImportOrders(ctx context.Context, orders []Order, handbooks ImportHandbooks) error {
+	d.imported = orders
+	return nil
+}
+
+func TestImportOrdersValidation(t *testing.T) {
+	d := &importDb{taken: map[string]bool{"7": true}}
+	m := &Model{db: d}
+	rows := [][]string{
+		{"doc_type", "kind_of_doc", "doc_label", "reg_date", "reg_number"},
+		{"Приказ", "По основной деятельности", "Без штампа", "2019-02-01", "6"},
+		{"Приказ", "По основной деятельности", "Без штампа", "2019-02-02", "7"},
+		{"Распоряжение", "По основной деятельности", "Без штампа", "2019-02-03", "8"},
+	}
+	result, err := m.ImportOrders(context.Background(), rows, ImportOptions{Username: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) != 2 {
+		t.Fatalf("ошибки: %+v", result.Errors)
+	}
+	if e := result.Errors[0]; e.Row != 3 || !strings.Contains(e.Message, "уже есть в БД") {
+		t.Errorf("занятый номер: %+v", e)
+	}
+	if e := result.Errors[1]; e.Row != 4 || !strings.Contains(e.Message, "отключен") {
+		t.Errorf("отключенный тип: %+v", e)
+	}
+	if d.imported != nil {
+		t.Error("при ошибках приказы записаны в БД")
+	}
+
+	result, err = m.ImportOrders(context.Background(), rows[:2], ImportOptions{Username: "admin"})
+	if err != nil || len(result.Errors) != 0 || len(d.imported) != 1 {
+		t.Errorf("загрузка без ошибок: %+v, %v", result, err)
+	}
+}
+
+// без штампа приказ не записать в БД, поэтому ошибка видна уже в пробном запуске
+func TestImportOrdersRequiresLabel(t *testing.T) {
+	d := &importDb{}
+	m := &Model{db: d}
+	rows := [][]string{
+		{"doc_type", "kind_of_doc", "reg_date", "reg_number"},
+		{"Приказ", "По основной деятельности", "2019-02-01", "6"},
+	}
+	result, err := m.ImportOrders(context.Background(), rows, ImportOptions{DryRun: true, Username: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Row != 1 || !strings.Contains(result.Errors[0].Message, ImportDocLabel) {
+		t.Errorf("нет столбца штампа: %+v", result.Errors)
+	}
+
+	rows = [][]string{
+		{"doc_type", "kind_of_doc", "doc_label", "reg_date", "reg_number"},
+		{"Приказ", "По основной деятельности", "", "2019-02-01", "6"},
+		{"Приказ", "По основной деятельности", "Без штампа", "2019-02-02", "7"},
+	}
+	result, err = m.ImportOrders(context.Background(), rows, ImportOptions{DryRun: true, Username: "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) != 1 || result.Errors[0].Row != 2 || result.Errors[0].Message != "не указан штамп" {
+		t.Errorf("пустой штамп: %+v", result.Errors)
+	}
+}
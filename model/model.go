@@ -1,6 +1,7 @@
 package model
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -9,15 +10,42 @@ import (
 // Model is ...
 type Model struct {
 	db
+	*Bus
 }
 
 // New is ...
 func New(db db) *Model {
 	return &Model{
-		db: db,
+		db:  db,
+		Bus: NewBus(),
 	}
 }
 
+// CreateOrder сохраняет приказ с записью в журнале согласования и публикует OrderCreated.
+// Для проекта событие публикуется позже, при регистрации
+func (m *Model) CreateOrder(ctx context.Context, order Order) (id int64, err error) {
+	err = m.Do(ctx, func(u *UnitOfWork) error {
+		id, err = u.CreateOrder(order)
+		return err
+	})
+	return id, err
+}
+
+// UpdateOrder сохраняет приказ и публикует OrderUpdated,
+// либо OrderCancelled, если приказ утратил силу
+func (m *Model) UpdateOrder(ctx context.Context, order Order) error {
+	return m.Do(ctx, func(u *UnitOfWork) error {
+		return u.UpdateOrder(order)
+	})
+}
+
+// CreateUser сохраняет пользователя и публикует UserCreated
+func (m *Model) CreateUser(ctx context.Context, user User) error {
+	return m.Do(ctx, func(u *UnitOfWork) error {
+		return u.CreateUser(user)
+	})
+}
+
 
 func decodeJson(r *http.Request, target interface{}) error {
 	decoder := json.NewDecoder(r.Body)
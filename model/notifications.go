@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// Notification — уведомление во входящих пользователя
+type Notification struct {
+	ID      int64     // Идентификатор
+	UserID  int64     // Получатель
+	Event   EventType // Тип события
+	OrderID int64     // Приказ, к которому относится уведомление (0 — нет)
+	Message string    // Текст уведомления
+	Created time.Time // Время создания
+	Read    bool      // Флаг прочтения
+}
+
+// Subscription — подписка пользователя на события приказов.
+// Пустые DocType или Departament означают «любой»
+type Subscription struct {
+	ID          int64  // Идентификатор
+	UserID      int64  // Подписчик
+	Username    string // Имя пользователя подписчика
+	Email       string // Электронная почта подписчика
+	DocType     string // Тип документа
+	Departament string // Отдел автора приказа
+	ByEmail     bool   // Дублировать уведомления на почту
+}
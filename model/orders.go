@@ -1,7 +1,10 @@
 package model
 
 import (
+	"context"
 	"time"
+
+	"../util"
 )
 
 // Order is ...
@@ -17,4 +20,100 @@ type Order struct {
 	FileOriginal string    // Оригинальный файл
 	FileCopy     string    // Копия файла
 	Current      bool      // Флаг действия документа
+	Status       string    // Состояние согласования (draft, review, signature, registered)
+	Cancelled    time.Time // Дата утраты силы, заполняется только при выгрузке реестра
+}
+
+// OrdersQuery — запрос страницы списка приказов
+type OrdersQuery struct {
+	StartDate, EndDate time.Time   // Период регистрации
+	Username           string      // Только приказы автора и сотрудников отделов, которыми он руководит, иначе все зарегистрированные
+	SortBy             string      // Столбец сортировки
+	SortDesc           bool        // Сортировка по убыванию
+	Cursor             util.Cursor // Граничная строка соседней страницы
+	Page               int         // Номер страницы для перехода без курсора, начиная с 1
+	Limit              int         // Приказов на странице
+}
+
+// OrdersPage — страница списка приказов с навигацией
+type OrdersPage struct {
+	Orders   []Order
+	Page     int                   // Номер текущей страницы
+	Pages    []util.PaginationPage // Окно номеров страниц
+	Next     string                // Курсор следующей страницы, пусто — страницы нет
+	Previous string                // Курсор предыдущей страницы, пусто — страницы нет
+}
+
+// sort — сортировка запроса в том виде, в котором она записывается в курсор
+func (q OrdersQuery) sort() string {
+	if q.SortDesc {
+		return q.SortBy + " desc"
+	}
+	return q.SortBy
+}
+
+// GetOrdersPage возвращает страницу приказов: по курсору соседние страницы выбираются по ключу
+// (столбец сортировки, id) без OFFSET, переход по номеру страницы — со смещением
+func (m *Model) GetOrdersPage(ctx context.Context, q OrdersQuery, linkLimit int) (OrdersPage, error) {
+	page := OrdersPage{Page: 1}
+	if !IsSortable(q.SortBy) {
+		q.SortBy, q.SortDesc = ColumnRegDate, true
+	}
+	// курсор другой сортировки (пользователь сменил ее) ведет в начало списка
+	if q.Cursor.Sort != q.sort() {
+		q.Cursor = util.Cursor{}
+	}
+	var all int
+	var err error
+	if q.Username != "" {
+		all, err = m.db.GetCountDateOrdersByUsername(ctx, q.StartDate, q.EndDate, q.Username)
+	} else {
+		all, err = m.db.GetCountDateOrders(ctx, q.StartDate, q.EndDate)
+	}
+	if err != nil {
+		return page, err
+	}
+
+	offset := 0
+	if !q.Cursor.IsZero() {
+		page.Page = q.Cursor.Page
+	} else if q.Page > 1 {
+		page.Page = q.Page
+		offset = (q.Page - 1) * q.Limit
+	}
+	// одна лишняя строка показывает, есть ли страница дальше в направлении выборки
+	orders, err := m.db.GetOrdersPage(ctx, q.StartDate, q.EndDate, q.Username, q.SortBy, q.SortDesc, q.Cursor, offset, q.Limit+1)
+	if err != nil {
+		return page, err
+	}
+	more := len(orders) > q.Limit
+	if more {
+		orders = orders[:q.Limit]
+	}
+	hasNext, hasPrevious := more, offset > 0
+	if q.Cursor.Before {
+		// выборка шла назад: строки перевернуты, а за ними есть страница, с которой пришли
+		for i, j := 0, len(orders)-1; i < j; i, j = i+1, j-1 {
+			orders[i], orders[j] = orders[j], orders[i]
+		}
+		hasNext, hasPrevious = true, more
+	} else if !q.Cursor.IsZero() {
+		hasPrevious = true
+	}
+	if len(orders) > 0 {
+		first, last := orders[0], orders[len(orders)-1]
+		if hasNext {
+			page.Next = util.Cursor{Sort: q.sort(), Key: last.SortKey(q.SortBy), ID: last.ID, Page: page.Page + 1}.Token()
+		}
+		if hasPrevious {
+			previous := page.Page - 1
+			if previous < 1 {
+				previous = 1
+			}
+			page.Previous = util.Cursor{Sort: q.sort(), Key: first.SortKey(q.SortBy), ID: first.ID, Page: previous, Before: true}.Token()
+		}
+	}
+	page.Orders = orders
+	page.Pages = util.Pagination(q.Limit, all, linkLimit, page.Page)
+	return page, nil
 }
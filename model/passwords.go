@@ -0,0 +1,171 @@
+package model
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordPolicy — требования к паролям пользователей, задаются в разделе [password] настроек
+type PasswordPolicy struct {
+	MinLength  int    `toml:"min_length"`   // Минимальная длина в символах
+	MinClasses int    `toml:"min_classes"`  // Сколько классов символов нужно: строчные, прописные, цифры, прочие
+	Blocklist  string `toml:"blocklist"`    // Файл запрещенных паролей, по одному в строке
+	MaxAgeDays int    `toml:"max_age_days"` // Срок действия пароля в днях, 0 — бессрочно
+	TOTPRoles  string `toml:"totp_roles"`   // Роли через запятую, которым второй фактор обязателен: admin, author, lawyer...
+
+	blocked map[string]bool
+}
+
+// DefaultPasswordPolicy — действующие требования к паролям, задаются в настройках демона
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 8, MinClasses: 2}
+
+// commonPasswords запрещены всегда, даже без файла blocklist
+var commonPasswords = []string{"12345", "123456", "12345678", "123456789", "password", "qwerty", "qwerty123", "admin", "йцукен"}
+
+// LoadBlocklist читает файл запрещенных паролей в дополнение к самым распространенным.
+// Сравнение без учета регистра
+func (p *PasswordPolicy) LoadBlocklist() error {
+	p.blocked = map[string]bool{}
+	if p.Blocklist == "" {
+		return nil
+	}
+	f, err := os.Open(p.Blocklist)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if s := strings.TrimSpace(scanner.Text()); s != "" && !strings.HasPrefix(s, "#") {
+			p.blocked[strings.ToLower(s)] = true
+		}
+	}
+	return scanner.Err()
+}
+
+// passwordClasses считает классы символов в пароле
+func passwordClasses(password string) int {
+	var lower, upper, digit, other int
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+// Check проверяет новый пароль пользователя username на соответствие требованиям
+func (p PasswordPolicy) Check(username, password string) error {
+	if n := len([]rune(password)); n < p.MinLength {
+		return fmt.Errorf("пароль короче %d символов", p.MinLength)
+	}
+	if passwordClasses(password) < p.MinClasses {
+		return fmt.Errorf("пароль должен содержать символы не менее %d классов из 4: строчные и прописные буквы, цифры, прочие знаки", p.MinClasses)
+	}
+	lower := strings.ToLower(password)
+	if lower == strings.ToLower(username) {
+		return fmt.Errorf("пароль не может совпадать с именем пользователя")
+	}
+	if p.blocked[lower] || contains(commonPasswords, lower) {
+		return fmt.Errorf("пароль слишком распространен, выберите другой")
+	}
+	return nil
+}
+
+// Expired сообщает, истек ли срок действия пароля
+func (p PasswordPolicy) Expired(user User, now time.Time) bool {
+	return p.MaxAgeDays > 0 && !user.PasswordChanged.IsZero() && now.Sub(user.PasswordChanged) > time.Duration(p.MaxAgeDays)*24*time.Hour
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// PasswordChangeRequired сообщает, должен ли пользователь сменить пароль, прежде чем продолжить работу:
+// администратор потребовал смену или истек срок действия пароля
+func PasswordChangeRequired(user User) bool {
+	return user.MustChangePassword || DefaultPasswordPolicy.Expired(user, time.Now())
+}
+
+// ChangePassword меняет пароль по запросу самого пользователя после ввода прежнего
+func (m *Model) ChangePassword(ctx context.Context, username, oldPassword, newPassword, confirm string) error {
+	user, err := m.db.GetUserByUsername(ctx, username)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(oldPassword)) != nil {
+		return fmt.Errorf("неверный текущий пароль")
+	}
+	if newPassword != confirm {
+		return fmt.Errorf("новый пароль и подтверждение не совпадают")
+	}
+	if newPassword == oldPassword {
+		return fmt.Errorf("новый пароль должен отличаться от текущего")
+	}
+	if err := DefaultPasswordPolicy.Check(username, newPassword); err != nil {
+		return err
+	}
+	return m.setPassword(ctx, user.ID, newPassword, false)
+}
+
+// ChangeEmail меняет адрес почты пользователя после ввода текущего пароля: по адресу
+// приходит ссылка сброса пароля. Возвращает прежний адрес для уведомления
+func (m *Model) ChangeEmail(ctx context.Context, username, password, email string) (string, error) {
+	user, err := m.db.GetUserByUsername(ctx, username)
+	if err != nil {
+		return "", err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return "", fmt.Errorf("неверный текущий пароль")
+	}
+	old := user.Email
+	user.Email = email
+	// пустой пароль UpdateUser не меняет
+	user.Password = ""
+	return old, m.UpdateUser(ctx, user)
+}
+
+// ResetPassword задает временный пароль от имени администратора; пользователь сменит его при следующем входе
+func (m *Model) ResetPassword(ctx context.Context, id int64, password string) error {
+	user, err := m.db.GetUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := DefaultPasswordPolicy.Check(user.Username, password); err != nil {
+		return err
+	}
+	return m.setPassword(ctx, id, password, true)
+}
+
+// SetPasswordChangeRequired по требованию администратора обязывает сменить пароль при следующем входе
+// или снимает требование, не меняя сам пароль
+func (m *Model) SetPasswordChangeRequired(ctx context.Context, id int64, required bool) error {
+	return m.db.SetPassword(ctx, id, "", required)
+}
+
+func (m *Model) setPassword(ctx context.Context, id int64, password string, mustChange bool) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+	if err != nil {
+		return err
+	}
+	return m.db.SetPassword(ctx, id, string(hash), mustChange)
+}
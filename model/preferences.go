@@ -0,0 +1,140 @@
+package model
+
+import (
+	"sort"
+	"strings"
+)
+
+// Столбцы списков приказов, по которым можно сортировать и которые можно скрыть
+const (
+	ColumnDocType     = "doc_type"
+	ColumnKindOfDoc   = "kind_of_doc"
+	ColumnDocLabel    = "doc_label"
+	ColumnRegDate     = "reg_date"
+	ColumnRegNumber   = "reg_number"
+	ColumnDescription = "description"
+	ColumnUsername    = "username"
+	ColumnCurrent     = "current"
+	ColumnStatus      = "status"
+)
+
+// Column — столбец списка приказов
+type Column struct {
+	Key      string // Идентификатор
+	Title    string // Заголовок
+	Sortable bool   // Можно сортировать
+}
+
+// OrderColumns — столбцы списков приказов в порядке вывода
+var OrderColumns = []Column{
+	{ColumnDocType, "Тип", true},
+	{ColumnKindOfDoc, "Вид", true},
+	{ColumnDocLabel, "Штамп", true},
+	{ColumnRegDate, "Дата рег", true},
+	{ColumnRegNumber, "Рег номер", true},
+	{ColumnDescription, "Описание", false},
+	{ColumnUsername, "Автор", true},
+	{ColumnCurrent, "Действие", false},
+	{ColumnStatus, "Состояние", false},
+}
+
+// PageSizes — допустимые размеры страницы
+var PageSizes = []int{7, 10, 25, 50, 100}
+
+// DefaultPageSize — размер страницы по умолчанию, задается в настройках демона
+var DefaultPageSize = 7
+
+// Preferences — настройки списков приказов пользователя
+type Preferences struct {
+	UserID   int64    // Пользователь
+	PageSize int      // Приказов на странице
+	SortBy   string   // Столбец сортировки
+	SortDesc bool     // Сортировка по убыванию
+	Hidden   []string // Скрытые столбцы
+}
+
+// DefaultPreferences возвращает настройки для пользователя, который их не менял
+func DefaultPreferences(userID int64) Preferences {
+	return Preferences{UserID: userID, PageSize: DefaultPageSize, SortBy: ColumnRegDate, SortDesc: true}
+}
+
+// IsSortable сообщает, можно ли сортировать по столбцу
+func IsSortable(key string) bool {
+	for _, c := range OrderColumns {
+		if c.Key == key {
+			return c.Sortable
+		}
+	}
+	return false
+}
+
+// Normalize заменяет недопустимые значения значениями по умолчанию
+func (p *Preferences) Normalize() {
+	valid := false
+	for _, size := range PageSizes {
+		if p.PageSize == size {
+			valid = true
+		}
+	}
+	if !valid {
+		p.PageSize = DefaultPageSize
+	}
+	if !IsSortable(p.SortBy) {
+		p.SortBy, p.SortDesc = ColumnRegDate, true
+	}
+	hidden := []string{}
+	for _, key := range p.Hidden {
+		for _, c := range OrderColumns {
+			if c.Key == key {
+				hidden = append(hidden, key)
+			}
+		}
+	}
+	p.Hidden = hidden
+}
+
+// Visible возвращает видимость столбцов для шаблонов
+func (p Preferences) Visible() map[string]bool {
+	visible := map[string]bool{}
+	for _, c := range OrderColumns {
+		visible[c.Key] = true
+	}
+	for _, key := range p.Hidden {
+		visible[key] = false
+	}
+	return visible
+}
+
+// SortKey возвращает значение столбца сортировки приказа в том виде, в котором его сравнивает БД
+func (o Order) SortKey(column string) string {
+	switch column {
+	case ColumnDocType:
+		return o.DocType
+	case ColumnKindOfDoc:
+		return o.KindOfDoc
+	case ColumnDocLabel:
+		return o.DocLabel
+	case ColumnRegNumber:
+		return o.RegNumber
+	case ColumnUsername:
+		return o.Username
+	}
+	return o.RegDate.Format("2006-01-02")
+}
+
+// SortOrders сортирует приказы по настройкам пользователя, при равенстве — по идентификатору
+func SortOrders(orders []Order, prefs Preferences) {
+	sort.SliceStable(orders, func(i, j int) bool {
+		a, b := orders[i].SortKey(prefs.SortBy), orders[j].SortKey(prefs.SortBy)
+		if a == b {
+			if prefs.SortDesc {
+				return orders[i].ID > orders[j].ID
+			}
+			return orders[i].ID < orders[j].ID
+		}
+		if prefs.SortDesc {
+			return strings.Compare(a, b) > 0
+		}
+		return strings.Compare(a, b) < 0
+	})
+}
@@ -0,0 +1,88 @@
+package model
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errResetToken — единая ошибка для любой негодной ссылки: не подсказываем, что именно не так
+var errResetToken = fmt.Errorf("ссылка для сброса пароля недействительна или устарела, запросите новую")
+
+// resetSignature подписывает ссылку сброса: id пользователя, срок действия и время последней
+// смены пароля. После смены пароля подпись перестает сходиться, поэтому ссылка одноразовая
+func resetSignature(key []byte, id, expires int64, passwordChanged time.Time) []byte {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%d:%d:%d", id, expires, passwordChanged.UnixNano())
+	return mac.Sum(nil)
+}
+
+// PasswordResetToken выдает подписанную ссылку сброса пароля для пользователя username,
+// действительную ttl. Пользователь без адреса почты ссылку получить не может
+func (m *Model) PasswordResetToken(ctx context.Context, key []byte, username string, ttl time.Duration) (User, string, error) {
+	user, err := m.db.GetUserByUsername(ctx, username)
+	if err != nil {
+		return user, "", err
+	}
+	if user.Email == "" {
+		return user, "", fmt.Errorf("у пользователя %s не указан адрес почты", username)
+	}
+	expires := time.Now().Add(ttl).Unix()
+	payload := fmt.Sprintf("%d:%d", user.ID, expires)
+	token := base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(resetSignature(key, user.ID, expires, user.PasswordChanged))
+	return user, token, nil
+}
+
+// CheckResetToken возвращает пользователя, которому выдана действующая ссылка сброса
+func (m *Model) CheckResetToken(ctx context.Context, key []byte, token string) (User, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return User{}, errResetToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return User{}, errResetToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return User{}, errResetToken
+	}
+	fields := strings.Split(string(payload), ":")
+	if len(fields) != 2 {
+		return User{}, errResetToken
+	}
+	id, err1 := strconv.ParseInt(fields[0], 10, 64)
+	expires, err2 := strconv.ParseInt(fields[1], 10, 64)
+	if err1 != nil || err2 != nil || time.Now().Unix() > expires {
+		return User{}, errResetToken
+	}
+	user, err := m.db.GetUser(ctx, id)
+	if err != nil {
+		return User{}, errResetToken
+	}
+	if !hmac.Equal(signature, resetSignature(key, id, expires, user.PasswordChanged)) {
+		return User{}, errResetToken
+	}
+	return user, nil
+}
+
+// ResetPasswordByToken задает новый пароль по ссылке из письма. Ссылка после этого недействительна
+func (m *Model) ResetPasswordByToken(ctx context.Context, key []byte, token, password, confirm string) error {
+	user, err := m.CheckResetToken(ctx, key, token)
+	if err != nil {
+		return err
+	}
+	if password != confirm {
+		return fmt.Errorf("новый пароль и подтверждение не совпадают")
+	}
+	if err := DefaultPasswordPolicy.Check(user.Username, password); err != nil {
+		return err
+	}
+	return m.setPassword(ctx, user.ID, password, false)
+}
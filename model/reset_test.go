@@ -0,0 +1,93 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// resetDb — один пользователь; смена пароля сдвигает password_changed, как в БД
+type resetDb struct {
+	db
+	user User
+}
+
+func (d *resetDb) GetUser(ctx context.Context, id int64) (User, error) {
+	if id != d.user.ID {
+		return User{}, fmt.Errorf("пользователь %d не найден", id)
+	}
+	return d.user, nil
+}
+
+func (d *resetDb) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	if username != d.user.Username {
+		return User{}, fmt.Errorf("пользователь %s не найден", username)
+	}
+	return d.user, nil
+}
+
+func (d *resetDb) SetPassword(ctx context.Context, id int64, hash string, mustChange bool) error {
+	if hash != "" {
+		d.user.Password = hash
+		d.user.PasswordChanged = d.user.PasswordChanged.Add(time.Second)
+	}
+	d.user.MustChangePassword = mustChange
+	return nil
+}
+
+func newResetModel() (*Model, *resetDb) {
+	d := &resetDb{user: User{ID: 7, Username: "ivanov", Email: "ivanov@example.org", PasswordChanged: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}}
+	return &Model{db: d}, d
+}
+
+func TestResetTokenSingleUse(t *testing.T) {
+	ctx := context.Background()
+	key := []byte("test-key")
+	m, d := newResetModel()
+	_, token, err := m.PasswordResetToken(ctx, key, "ivanov", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, err := m.CheckResetToken(ctx, key, token); err != nil || user.ID != 7 {
+		t.Fatalf("CheckResetToken: %v, %+v", err, user)
+	}
+	if err := m.ResetPasswordByToken(ctx, key, token, "Novyi-parol1", "Novyi-parol1"); err != nil {
+		t.Fatal(err)
+	}
+	if d.user.Password == "" {
+		t.Fatal("пароль не сменен")
+	}
+	if err := m.ResetPasswordByToken(ctx, key, token, "Drugoi-parol2", "Drugoi-parol2"); err != errResetToken {
+		t.Errorf("повторное использование ссылки: %v", err)
+	}
+}
+
+func TestResetTokenExpiry(t *testing.T) {
+	ctx := context.Background()
+	key := []byte("test-key")
+	m, _ := newResetModel()
+	_, token, err := m.PasswordResetToken(ctx, key, "ivanov", -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CheckResetToken(ctx, key, token); err != errResetToken {
+		t.Errorf("просроченная ссылка: %v", err)
+	}
+	// подпись другим ключом не принимается
+	_, token, err = m.PasswordResetToken(ctx, []byte("other-key"), "ivanov", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CheckResetToken(ctx, key, token); err != errResetToken {
+		t.Errorf("чужой ключ: %v", err)
+	}
+}
+
+func TestResetTokenNoEmail(t *testing.T) {
+	m, d := newResetModel()
+	d.user.Email = ""
+	if _, _, err := m.PasswordResetToken(context.Background(), []byte("test-key"), "ivanov", time.Hour); err == nil {
+		t.Error("ссылка выдана пользователю без почты")
+	}
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// Schedule — расписание рассылки отчета руководителю отдела
+type Schedule struct {
+	ID          int64     // Идентификатор
+	Title       string    // Наименование
+	Spec        string    // Расписание в формате cron: "0 8 * * 1"
+	Format      string    // Формат отчета: html, csv или ods
+	Departament string    // Отдел, по которому строится отчет
+	Recipients  string    // Адреса получателей через запятую
+	LastRun     time.Time // Время последней успешной отправки
+	Active      bool      // Флаг активности
+}
+
+// Форматы отчетов
+const (
+	ReportCSV  = "csv"
+	ReportHTML = "html"
+	ReportODS  = "ods"
+)
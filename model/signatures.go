@@ -0,0 +1,56 @@
+package model
+
+import (
+	"context"
+	"crypto/x509"
+	"io/ioutil"
+	"time"
+
+	"../util"
+)
+
+// Signature — результат проверки электронной подписи оригинала приказа
+type Signature struct {
+	OrderID     int64     // Приказ
+	File        string    // Файл отсоединенной подписи (.sig)
+	Subject     string    // Владелец сертификата подписанта
+	Serial      string    // Серийный номер сертификата
+	SigningTime time.Time // Время подписи
+	Verified    bool      // Подпись верна и сертификат доверенный
+	Error       string    // Причина, если проверка не прошла
+	Checked     time.Time // Время проверки
+}
+
+// VerifyOrderSignature проверяет подпись sigFile над оригиналом приказа
+// и сохраняет результат проверки
+func (m *Model) VerifyOrderSignature(ctx context.Context, order Order, sigFile string, roots *x509.CertPool) (Signature, error) {
+	signature, err := CheckSignature(order, sigFile, roots)
+	if err != nil {
+		return signature, err
+	}
+	return signature, m.SaveSignature(ctx, signature)
+}
+
+// CheckSignature проверяет подпись sigFile над оригиналом приказа, не сохраняя результат.
+// Ошибка — только если файлы не прочитать, неверная подпись отмечается в Verified и Error
+func CheckSignature(order Order, sigFile string, roots *x509.CertPool) (Signature, error) {
+	signature := Signature{OrderID: order.ID, File: sigFile, Checked: time.Now()}
+
+	content, err := ioutil.ReadFile(order.FileOriginal)
+	if err != nil {
+		return signature, err
+	}
+	sig, err := ioutil.ReadFile(sigFile)
+	if err != nil {
+		return signature, err
+	}
+	info, err := util.VerifyDetachedSignature(content, sig, roots)
+	signature.Subject = info.Subject
+	signature.Serial = info.Serial
+	signature.SigningTime = info.SigningTime
+	signature.Verified = err == nil
+	if err != nil {
+		signature.Error = err.Error()
+	}
+	return signature, nil
+}
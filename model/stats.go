@@ -0,0 +1,173 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// StatRow — одна строка агрегированного запроса статистики
+type StatRow struct {
+	Month       time.Time // Первое число месяца регистрации
+	DocType     string    // Тип документа
+	KindOfDoc   string    // Вид документа
+	DocLabel    string    // Пометка секретности
+	Username    string    // Автор
+	Departament string    // Отдел автора
+	Count       int       // Количество приказов
+}
+
+// YearCount — количество приказов за год в одном состоянии, для метрик
+type YearCount struct {
+	Year   int    // Год регистрации
+	Status string // Состояние приказа
+	Count  int    // Количество приказов
+}
+
+// StatItem — значение одного разреза статистики
+type StatItem struct {
+	Name     string // Наименование (месяц, тип, вид, ...)
+	Count    int    // Количество за выбранный период
+	Previous int    // Количество за тот же период прошлого года
+}
+
+// Statistics — статистика приказов за период с разбивкой по разрезам
+type Statistics struct {
+	StartDate     time.Time
+	EndDate       time.Time
+	Total         int
+	PreviousTotal int
+	ByMonth       []StatItem
+	ByDocType     []StatItem
+	ByKindOfDoc   []StatItem
+	ByDocLabel    []StatItem
+	ByUsername    []StatItem
+	ByDepartament []StatItem
+}
+
+// MaxStatYears — наибольшая длина периода статистики в годах
+const MaxStatYears = 10
+
+// GetStatistics собирает статистику за период и сравнивает её с тем же периодом прошлого года
+// Период длиннее MaxStatYears сокращается до последних MaxStatYears лет
+func (m *Model) GetStatistics(ctx context.Context, startDate, endDate time.Time) (Statistics, error) {
+	if startDate.After(endDate) {
+		return Statistics{}, fmt.Errorf("начало периода позже окончания")
+	}
+	if min := endDate.AddDate(-MaxStatYears, 0, 0); startDate.Before(min) {
+		startDate = min
+	}
+	stat := Statistics{StartDate: startDate, EndDate: endDate}
+
+	rows, err := m.GetStatOrders(ctx, startDate, endDate)
+	if err != nil {
+		return stat, err
+	}
+	prevRows, err := m.GetStatOrders(ctx, startDate.AddDate(-1, 0, 0), endDate.AddDate(-1, 0, 0))
+	if err != nil {
+		return stat, err
+	}
+
+	// Месяцы прошлого года сдвигаем на год вперед, чтобы они совпали с текущими
+	month := func(r StatRow) string { return r.Month.Format("2006-01") }
+	prevMonth := func(r StatRow) string { return r.Month.AddDate(1, 0, 0).Format("2006-01") }
+
+	stat.ByMonth = groupStat(rows, prevRows, month, prevMonth)
+	stat.ByMonth = fillMonths(stat.ByMonth, startDate, endDate)
+	stat.ByDocType = sortStat(groupStat(rows, prevRows, func(r StatRow) string { return r.DocType }, nil))
+	stat.ByKindOfDoc = sortStat(groupStat(rows, prevRows, func(r StatRow) string { return r.KindOfDoc }, nil))
+	stat.ByDocLabel = sortStat(groupStat(rows, prevRows, func(r StatRow) string { return r.DocLabel }, nil))
+	stat.ByUsername = sortStat(groupStat(rows, prevRows, func(r StatRow) string { return r.Username }, nil))
+	stat.ByDepartament = sortStat(groupStat(rows, prevRows, func(r StatRow) string { return r.Departament }, nil))
+
+	for _, r := range rows {
+		stat.Total += r.Count
+	}
+	for _, r := range prevRows {
+		stat.PreviousTotal += r.Count
+	}
+	return stat, nil
+}
+
+// MonthLabels возвращает подписи месяцев для графика
+func (s Statistics) MonthLabels() []string {
+	labels := []string{}
+	for _, item := range s.ByMonth {
+		labels = append(labels, item.Name)
+	}
+	return labels
+}
+
+// MonthCounts возвращает количество приказов по месяцам для графика
+func (s Statistics) MonthCounts() []int {
+	counts := []int{}
+	for _, item := range s.ByMonth {
+		counts = append(counts, item.Count)
+	}
+	return counts
+}
+
+// MonthPrevious возвращает количество приказов по месяцам прошлого года для графика
+func (s Statistics) MonthPrevious() []int {
+	counts := []int{}
+	for _, item := range s.ByMonth {
+		counts = append(counts, item.Previous)
+	}
+	return counts
+}
+
+// groupStat суммирует строки по ключу, prevKey (если задан) используется для строк прошлого года
+func groupStat(rows, prevRows []StatRow, key, prevKey func(StatRow) string) []StatItem {
+	if prevKey == nil {
+		prevKey = key
+	}
+	index := make(map[string]int)
+	items := []StatItem{}
+	get := func(name string) *StatItem {
+		i, ok := index[name]
+		if !ok {
+			i = len(items)
+			index[name] = i
+			items = append(items, StatItem{Name: name})
+		}
+		return &items[i]
+	}
+	for _, r := range rows {
+		get(key(r)).Count += r.Count
+	}
+	for _, r := range prevRows {
+		get(prevKey(r)).Previous += r.Count
+	}
+	return items
+}
+
+// sortStat упорядочивает разрез по убыванию количества
+func sortStat(items []StatItem) []StatItem {
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].Count != items[j].Count {
+			return items[i].Count > items[j].Count
+		}
+		return items[i].Name < items[j].Name
+	})
+	return items
+}
+
+// fillMonths добавляет месяцы без приказов, чтобы на графике не было пропусков
+func fillMonths(items []StatItem, startDate, endDate time.Time) []StatItem {
+	index := make(map[string]StatItem)
+	for _, item := range items {
+		index[item.Name] = item
+	}
+	months := []StatItem{}
+	first := time.Date(startDate.Year(), startDate.Month(), 1, 0, 0, 0, 0, startDate.Location())
+	for t := first; !t.After(endDate); t = t.AddDate(0, 1, 0) {
+		name := t.Format("2006-01")
+		item, ok := index[name]
+		if !ok {
+			item = StatItem{Name: name}
+		}
+		months = append(months, item)
+	}
+	return months
+}
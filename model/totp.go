@@ -0,0 +1,195 @@
+package model
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"../util"
+)
+
+// TOTPIssuer — имя сервиса в приложении-аутентификаторе
+const TOTPIssuer = "БД приказов"
+
+// RecoveryCodesCount — число одноразовых кодов восстановления, выдаваемых за раз
+const RecoveryCodesCount = 10
+
+// TOTPRoleAdmin в списке totp_roles обозначает администраторов, TOTPRoleAuthor — сотрудников без роли
+const (
+	TOTPRoleAdmin  = "admin"
+	TOTPRoleAuthor = "author"
+)
+
+// TOTP — второй фактор пользователя
+type TOTP struct {
+	Secret   string // Ключ в base32, пусто — не подключался
+	Enabled  bool   // Подключение подтверждено кодом
+	LastStep int64  // Интервал последнего принятого кода, повторно не принимается
+}
+
+// ParseTOTPRoles разбирает список ролей через запятую, для которых второй фактор обязателен
+func ParseTOTPRoles(list string) (map[string]bool, error) {
+	roles := map[string]bool{}
+	for _, role := range strings.Split(list, ",") {
+		role = strings.TrimSpace(role)
+		switch {
+		case role == "":
+			continue
+		case role == TOTPRoleAdmin:
+			roles[TOTPRoleAdmin] = true
+		case role == TOTPRoleAuthor:
+			roles[RoleAuthor] = true
+		case RoleTitles[role] != "":
+			roles[role] = true
+		default:
+			return nil, fmt.Errorf("неизвестная роль %q", role)
+		}
+	}
+	return roles, nil
+}
+
+// TOTPRequired сообщает, обязан ли пользователь подключить второй фактор по настройке totp_roles
+func (p PasswordPolicy) TOTPRequired(user User) bool {
+	roles, _ := ParseTOTPRoles(p.TOTPRoles)
+	return roles[user.Role] || (user.IsAdmin && roles[TOTPRoleAdmin])
+}
+
+// TOTPEnrolmentRequired сообщает, должен ли пользователь подключить второй фактор, прежде чем продолжить работу
+func TOTPEnrolmentRequired(user User) bool {
+	return !user.TOTPEnabled && DefaultPasswordPolicy.TOTPRequired(user)
+}
+
+// hashRecoveryCode возвращает хеш кода восстановления: в БД коды хранятся только так
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.Replace(strings.TrimSpace(code), "-", "", -1))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// newRecoveryCodes создает новые коды вида xxxxx-xxxxx и их хеши
+func newRecoveryCodes() ([]string, []string, error) {
+	var codes, hashes []string
+	for i := 0; i < RecoveryCodesCount; i++ {
+		b := make([]byte, 7)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		s := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+		codes = append(codes, s[:5]+"-"+s[5:])
+		hashes = append(hashes, hashRecoveryCode(s))
+	}
+	return codes, hashes, nil
+}
+
+// BeginTOTPEnrolment создает новый ключ для подключения второго фактора и адрес для QR-кода.
+// До подтверждения кодом ключ не действует, уже подключенный фактор не заменяется
+func (m *Model) BeginTOTPEnrolment(ctx context.Context, user User) (string, string, error) {
+	if user.TOTPEnabled {
+		return "", "", fmt.Errorf("второй фактор уже подключен")
+	}
+	secret, err := util.NewTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := m.db.SaveTOTP(ctx, user.ID, secret, false); err != nil {
+		return "", "", err
+	}
+	return secret, util.TOTPURI(TOTPIssuer, user.Username, secret), nil
+}
+
+// checkTOTP проверяет код приложения и запоминает его интервал, чтобы код нельзя было повторить
+func (m *Model) checkTOTP(ctx context.Context, userID int64, code string) error {
+	totp, err := m.db.GetTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	step, ok := util.CheckTOTP(totp.Secret, strings.TrimSpace(code), time.Now())
+	if totp.Secret == "" || !ok || step <= totp.LastStep {
+		return fmt.Errorf("неверный код подтверждения")
+	}
+	if ok, err := m.db.UseTOTPStep(ctx, userID, step); err != nil || !ok {
+		return fmt.Errorf("неверный код подтверждения")
+	}
+	return nil
+}
+
+// ConfirmTOTP подтверждает подключение кодом из приложения и выдает коды восстановления.
+// Коды показываются один раз: в БД остаются только их хеши
+func (m *Model) ConfirmTOTP(ctx context.Context, user User, code string) ([]string, error) {
+	if err := m.checkTOTP(ctx, user.ID, code); err != nil {
+		return nil, err
+	}
+	totp, err := m.db.GetTOTP(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.db.SaveTOTP(ctx, user.ID, totp.Secret, true); err != nil {
+		return nil, err
+	}
+	return m.issueRecoveryCodes(ctx, user.ID)
+}
+
+func (m *Model) issueRecoveryCodes(ctx context.Context, userID int64) ([]string, error) {
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.db.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// RegenerateRecoveryCodes выдает новые коды восстановления взамен прежних, по коду из приложения
+func (m *Model) RegenerateRecoveryCodes(ctx context.Context, user User, code string) ([]string, error) {
+	if err := m.checkTOTP(ctx, user.ID, code); err != nil {
+		return nil, err
+	}
+	return m.issueRecoveryCodes(ctx, user.ID)
+}
+
+// VerifySecondFactor проверяет второй шаг входа: код из приложения или неиспользованный код восстановления
+func (m *Model) VerifySecondFactor(ctx context.Context, userID int64, code string) error {
+	if strings.Contains(code, "-") || len(strings.TrimSpace(code)) == 10 {
+		ok, err := m.db.UseRecoveryCode(ctx, userID, hashRecoveryCode(code))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("неверный код подтверждения")
+		}
+		return nil
+	}
+	return m.checkTOTP(ctx, userID, code)
+}
+
+// DisableTOTP отключает второй фактор по просьбе пользователя, подтвержденной кодом. Если для его роли
+// второй фактор обязателен, отключить нельзя
+func (m *Model) DisableTOTP(ctx context.Context, user User, code string) error {
+	if DefaultPasswordPolicy.TOTPRequired(user) {
+		return fmt.Errorf("для вашей роли второй фактор обязателен")
+	}
+	if err := m.VerifySecondFactor(ctx, user.ID, code); err != nil {
+		return err
+	}
+	return m.ResetTOTP(ctx, user.ID)
+}
+
+// ResetTOTP отключает второй фактор и удаляет коды восстановления, например при утере телефона.
+// Если второй фактор обязателен, пользователь подключит его заново при следующем входе
+func (m *Model) ResetTOTP(ctx context.Context, userID int64) error {
+	if err := m.db.SaveTOTP(ctx, userID, "", false); err != nil {
+		return err
+	}
+	return m.db.ReplaceRecoveryCodes(ctx, userID, nil)
+}
+
+// RecoveryCodesLeft сообщает, сколько кодов восстановления еще не использовано
+func (m *Model) RecoveryCodesLeft(ctx context.Context, userID int64) (int, error) {
+	return m.db.CountRecoveryCodes(ctx, userID)
+}
@@ -0,0 +1,278 @@
+package model
+
+import (
+	"context"
+	"crypto/x509"
+	"mime/multipart"
+	"os"
+	"time"
+
+	"../util"
+)
+
+// Tx — транзакция БД, в которой единица работы меняет приказ, его подпись и журнал
+type Tx interface {
+	// GetOrder возвращает приказ с блокировкой строки до конца транзакции
+	GetOrder(ctx context.Context, id int64) (Order, error)
+	// CreateOrder и UpdateOrder возвращают ошибку, если вида, типа или метки
+	// документа с указанным наименованием нет в справочнике
+	CreateOrder(ctx context.Context, order Order) (int64, error)
+	UpdateOrder(ctx context.Context, order Order) error
+	SaveSignature(ctx context.Context, signature Signature) error
+	DeleteSignature(ctx context.Context, orderID int64) error
+	AddTransition(ctx context.Context, transition OrderTransition) error
+	// TransitOrder возвращает ошибку, если приказ уже не в состоянии transition.From
+	TransitOrder(ctx context.Context, transition OrderTransition) error
+	CreateUser(ctx context.Context, user User) error
+	// GetWebhooks и CreateDelivery ставят события в очередь вебхуков в той же транзакции
+	GetWebhooks(ctx context.Context) ([]Webhook, error)
+	CreateDelivery(ctx context.Context, delivery Delivery) error
+	Commit() error
+	Rollback() error
+}
+
+// Комментарии журнала согласования для изменений, сделанных не переходом
+const (
+	AuditCreated = "Создание приказа"
+	AuditUpdated = "Изменение приказа"
+)
+
+// UnitOfWork — изменения приказа, которые сохраняются или отменяются вместе:
+// загруженные файлы, строка приказа, результат проверки подписи и журнал.
+// Загруженные файлы до фиксации лежат во временных файлах и занимают свое место только
+// при Commit; при отмене удаляются только они. События модели публикуются после фиксации
+type UnitOfWork struct {
+	m       *Model
+	ctx     context.Context
+	tx      Tx
+	uploads []upload
+	events  []Event
+	done    bool
+}
+
+// upload — файл, загруженный в единице работы
+type upload struct {
+	tmp   string // временный файл
+	path  string // постоянный путь, который записывается в приказ
+	moved bool   // файл уже перемещен на постоянный путь
+}
+
+// Begin начинает единицу работы. Ее нужно завершить Commit или Rollback,
+// проще — выполнять изменения через Do
+func (m *Model) Begin(ctx context.Context) (*UnitOfWork, error) {
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &UnitOfWork{m: m, ctx: ctx, tx: tx}, nil
+}
+
+// Do выполняет fn в единице работы: фиксирует ее, если fn вернула nil, иначе отменяет
+func (m *Model) Do(ctx context.Context, fn func(u *UnitOfWork) error) (err error) {
+	u, err := m.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			u.Rollback()
+			panic(p)
+		}
+		if err != nil {
+			u.Rollback()
+		}
+	}()
+	if err = fn(u); err != nil {
+		return err
+	}
+	return u.Commit()
+}
+
+// Upload сохраняет загруженный файл во временный файл и возвращает уникальный путь,
+// на котором файл окажется после фиксации. Этот путь и записывается в приказ
+func (u *UnitOfWork) Upload(src multipart.File, header *multipart.FileHeader) (string, error) {
+	tmp, path, err := util.UploadFile(src, header)
+	if err != nil {
+		return path, err
+	}
+	u.uploads = append(u.uploads, upload{tmp: tmp, path: path})
+	return path, nil
+}
+
+// localPath сообщает, где файл лежит сейчас: для загруженного в этой единице работы — временный файл
+func (u *UnitOfWork) localPath(path string) string {
+	for _, f := range u.uploads {
+		if f.path == path && !f.moved {
+			return f.tmp
+		}
+	}
+	return path
+}
+
+// CheckSignature проверяет подпись, как CheckSignature модели, но файлы, загруженные
+// в этой единице работы, читает из временных файлов
+func (u *UnitOfWork) CheckSignature(order Order, sigFile string, roots *x509.CertPool) (Signature, error) {
+	local := order
+	local.FileOriginal = u.localPath(order.FileOriginal)
+	signature, err := CheckSignature(local, u.localPath(sigFile), roots)
+	signature.File = sigFile
+	return signature, err
+}
+
+// GetOrder возвращает приказ, заблокированный до конца единицы работы
+func (u *UnitOfWork) GetOrder(id int64) (Order, error) {
+	return u.tx.GetOrder(u.ctx, id)
+}
+
+// CreateOrder добавляет приказ и запись о создании в журнал согласования.
+// OrderCreated публикуется после фиксации, для проекта — позже, при регистрации
+func (u *UnitOfWork) CreateOrder(order Order) (int64, error) {
+	id, err := u.tx.CreateOrder(u.ctx, order)
+	if err != nil {
+		return id, err
+	}
+	order.ID = id
+	status := order.Status
+	if status == "" {
+		status = StatusRegistered
+	}
+	if err := u.Audit(OrderTransition{OrderID: id, To: status, Username: order.Username, Comment: AuditCreated}); err != nil {
+		return id, err
+	}
+	if status == StatusRegistered {
+		u.events = append(u.events, Event{Type: OrderCreated, Order: order})
+	}
+	return id, nil
+}
+
+// UpdateOrder сохраняет приказ; после фиксации для зарегистрированного приказа
+// публикуется OrderUpdated, либо OrderCancelled, если приказ утратил силу.
+// При замене оригинала результат проверки прежней подписи удаляется
+func (u *UnitOfWork) UpdateOrder(order Order) error {
+	prev, err := u.tx.GetOrder(u.ctx, order.ID)
+	if err != nil {
+		return err
+	}
+	if err := u.tx.UpdateOrder(u.ctx, order); err != nil {
+		return err
+	}
+	// подпись проверялась над прежним оригиналом; новую подпись сохранит SaveSignature
+	if prev.FileOriginal != order.FileOriginal {
+		if err := u.tx.DeleteSignature(u.ctx, order.ID); err != nil {
+			return err
+		}
+	}
+	// о проектах подписчики не знают, как и в CreateOrder
+	if prev.Status != StatusRegistered {
+		return nil
+	}
+	if prev.Current && !order.Current {
+		u.events = append(u.events, Event{Type: OrderCancelled, Order: order})
+	} else {
+		u.events = append(u.events, Event{Type: OrderUpdated, Order: order})
+	}
+	return nil
+}
+
+// TransitOrder переводит приказ в новое состояние с записью в журнал согласования.
+// После регистрации публикуется OrderCreated: до нее подписчики о приказе не знают
+func (u *UnitOfWork) TransitOrder(transition OrderTransition) error {
+	if err := u.tx.TransitOrder(u.ctx, transition); err != nil {
+		return err
+	}
+	if transition.To != StatusRegistered {
+		return nil
+	}
+	order, err := u.tx.GetOrder(u.ctx, transition.OrderID)
+	if err != nil {
+		return err
+	}
+	u.events = append(u.events, Event{Type: OrderCreated, Order: order})
+	return nil
+}
+
+// CreateUser добавляет пользователя; после фиксации публикуется UserCreated
+func (u *UnitOfWork) CreateUser(user User) error {
+	if err := u.tx.CreateUser(u.ctx, user); err != nil {
+		return err
+	}
+	user.Password = ""
+	u.events = append(u.events, Event{Type: UserCreated, User: user})
+	return nil
+}
+
+// SaveSignature сохраняет результат проверки подписи приказа
+func (u *UnitOfWork) SaveSignature(signature Signature) error {
+	return u.tx.SaveSignature(u.ctx, signature)
+}
+
+// Audit добавляет запись в журнал согласования без смены состояния приказа
+func (u *UnitOfWork) Audit(transition OrderTransition) error {
+	return u.tx.AddTransition(u.ctx, transition)
+}
+
+// Commit ставит накопленные события в очередь вебхуков, перемещает загруженные файлы
+// на их места, фиксирует изменения и публикует события
+func (u *UnitOfWork) Commit() error {
+	if u.done {
+		return nil
+	}
+	u.done = true
+	now := time.Now()
+	for i := range u.events {
+		if u.events[i].Time.IsZero() {
+			u.events[i].Time = now
+		}
+	}
+	if err := u.enqueueWebhooks(); err != nil {
+		u.tx.Rollback()
+		u.removeFiles()
+		return err
+	}
+	for i := range u.uploads {
+		if err := util.MoveUpload(u.uploads[i].tmp, u.uploads[i].path); err != nil {
+			u.tx.Rollback()
+			u.removeFiles()
+			return err
+		}
+		u.uploads[i].moved = true
+	}
+	if err := u.tx.Commit(); err != nil {
+		u.removeFiles()
+		return err
+	}
+	u.uploads = nil
+	for _, e := range u.events {
+		u.m.Publish(e)
+	}
+	return nil
+}
+
+// Rollback отменяет изменения и удаляет временные файлы загрузок.
+// После Commit ничего не делает
+func (u *UnitOfWork) Rollback() error {
+	if u.done {
+		return nil
+	}
+	u.done = true
+	err := u.tx.Rollback()
+	u.removeFiles()
+	return err
+}
+
+// removeFiles удаляет файлы, загруженные в этой единице работы: они уникальны,
+// чужих файлов среди них нет
+func (u *UnitOfWork) removeFiles() {
+	for _, f := range u.uploads {
+		var err error
+		if f.moved {
+			err = util.RemoveUpload(f.path)
+		} else {
+			err = os.Remove(f.tmp)
+		}
+		if err != nil && !os.IsNotExist(err) {
+			util.Errorf(u.ctx, "error UnitOfWork: %v", err)
+		}
+	}
+	u.uploads = nil
+}
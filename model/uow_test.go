@@ -0,0 +1,209 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"../util"
+)
+
+// fakeTx — транзакция без БД: запоминает доставки вебхуков и чем она завершилась
+type fakeTx struct {
+	orders                map[int64]Order
+	deletedSignatures     []int64
+	committed, rolledBack bool
+	commitErr             error
+	webhooks              []Webhook
+	deliveries            []Delivery
+}
+
+func (t *fakeTx) GetOrder(ctx context.Context, id int64) (Order, error) {
+	if order, ok := t.orders[id]; ok {
+		return order, nil
+	}
+	return Order{ID: id}, nil
+}
+func (t *fakeTx) CreateOrder(ctx context.Context, order Order) (int64, error)  { return 1, nil }
+func (t *fakeTx) UpdateOrder(ctx context.Context, order Order) error           { return nil }
+func (t *fakeTx) SaveSignature(ctx context.Context, signature Signature) error { return nil }
+func (t *fakeTx) AddTransition(ctx context.Context, transition OrderTransition) error {
+	return nil
+}
+func (t *fakeTx) DeleteSignature(ctx context.Context, orderID int64) error {
+	t.deletedSignatures = append(t.deletedSignatures, orderID)
+	return nil
+}
+func (t *fakeTx) TransitOrder(ctx context.Context, transition OrderTransition) error { return nil }
+func (t *fakeTx) CreateUser(ctx context.Context, user User) error                    { return nil }
+func (t *fakeTx) GetWebhooks(ctx context.Context) ([]Webhook, error)                 { return t.webhooks, nil }
+func (t *fakeTx) CreateDelivery(ctx context.Context, delivery Delivery) error {
+	t.deliveries = append(t.deliveries, delivery)
+	return nil
+}
+func (t *fakeTx) Commit() error   { t.committed = true; return t.commitErr }
+func (t *fakeTx) Rollback() error { t.rolledBack = true; return nil }
+
+type memFile struct{ *strings.Reader }
+
+func (memFile) Close() error { return nil }
+
+func newTestUnitOfWork(t *testing.T) (*UnitOfWork, *fakeTx) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "uploads")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := util.UploadDir
+	util.UploadDir = dir
+	t.Cleanup(func() {
+		util.UploadDir = old
+		os.RemoveAll(dir)
+	})
+	tx := &fakeTx{}
+	return &UnitOfWork{m: &Model{Bus: NewBus()}, ctx: context.Background(), tx: tx}, tx
+}
+
+func uploadString(t *testing.T, u *UnitOfWork, name, content string) string {
+	t.Helper()
+	var f multipart.File = memFile{strings.NewReader(content)}
+	path, err := u.Upload(f, &multipart.FileHeader{Filename: name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestUploadCommit(t *testing.T) {
+	first, _ := newTestUnitOfWork(t)
+	firstPath := uploadString(t, first, "order.pdf", "первый")
+	if _, err := os.Stat(firstPath); !os.IsNotExist(err) {
+		t.Fatal("файл на постоянном месте до фиксации")
+	}
+	if got := readFile(t, first.localPath(firstPath)); got != "первый" {
+		t.Errorf("временный файл: %q", got)
+	}
+	if err := first.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// файл с тем же именем к другому приказу получает свой путь
+	second := &UnitOfWork{m: first.m, ctx: context.Background(), tx: &fakeTx{}}
+	secondPath := uploadString(t, second, "order.pdf", "второй")
+	if secondPath == firstPath {
+		t.Fatalf("одинаковые пути загрузок: %s", firstPath)
+	}
+	if filepath.Base(secondPath) != "order.pdf" {
+		t.Errorf("имя файла не сохранилось: %s", secondPath)
+	}
+	if err := second.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, firstPath); got != "первый" {
+		t.Errorf("первый файл перезаписан: %q", got)
+	}
+	if got := readFile(t, secondPath); got != "второй" {
+		t.Errorf("второй файл: %q", got)
+	}
+}
+
+func TestUploadRollback(t *testing.T) {
+	u, tx := newTestUnitOfWork(t)
+	path := uploadString(t, u, "order.pdf", "черновик")
+	tmp := u.localPath(path)
+	if err := u.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if !tx.rolledBack {
+		t.Error("транзакция не отменена")
+	}
+	for _, p := range []string{tmp, path} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("после отмены остался %s", p)
+		}
+	}
+}
+
+func TestUploadCommitFailure(t *testing.T) {
+	u, tx := newTestUnitOfWork(t)
+	tx.commitErr = errors.New("serialization failure")
+	path := uploadString(t, u, "order.pdf", "текст")
+	if err := u.Commit(); err == nil {
+		t.Fatal("ожидалась ошибка фиксации")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("после неудачной фиксации файл остался на постоянном месте")
+	}
+}
+
+func TestCommitEnqueuesWebhooks(t *testing.T) {
+	u, tx := newTestUnitOfWork(t)
+	tx.webhooks = []Webhook{
+		{ID: 1, Active: true},
+		{ID: 2, Active: true, Events: string(UserCreated)},
+		{ID: 3, Active: false},
+	}
+	if _, err := u.CreateOrder(Order{DocType: "Приказ", Username: "author"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.deliveries) != 0 {
+		t.Fatal("доставки поставлены до фиксации")
+	}
+	if err := u.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.deliveries) != 1 || tx.deliveries[0].WebhookID != 1 || tx.deliveries[0].Event != OrderCreated {
+		t.Fatalf("доставки: %+v", tx.deliveries)
+	}
+	if !strings.Contains(tx.deliveries[0].Payload, `"event":"OrderCreated"`) || strings.Contains(tx.deliveries[0].Payload, `"time":"0001-`) {
+		t.Errorf("тело доставки: %s", tx.deliveries[0].Payload)
+	}
+}
+
+func TestDraftEventsNotEnqueued(t *testing.T) {
+	u, tx := newTestUnitOfWork(t)
+	tx.webhooks = []Webhook{{ID: 1, Active: true}}
+	if _, err := u.CreateOrder(Order{Status: StatusDraft}); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.UpdateOrder(Order{ID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.deliveries) != 0 {
+		t.Errorf("для проекта поставлены доставки: %+v", tx.deliveries)
+	}
+}
+
+func TestUpdateOrderDropsStaleSignature(t *testing.T) {
+	u, tx := newTestUnitOfWork(t)
+	tx.orders = map[int64]Order{
+		1: {ID: 1, FileOriginal: "upload/a/order.pdf", Status: StatusRegistered, Current: true},
+		2: {ID: 2, FileOriginal: "upload/b/order.pdf", Status: StatusRegistered, Current: true},
+	}
+	if err := u.UpdateOrder(Order{ID: 1, FileOriginal: "upload/c/order.pdf", Current: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.UpdateOrder(Order{ID: 2, FileOriginal: "upload/b/order.pdf", Current: true, Description: "новое"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.deletedSignatures) != 1 || tx.deletedSignatures[0] != 1 {
+		t.Errorf("удалены подписи приказов %v, ожидался только 1", tx.deletedSignatures)
+	}
+}
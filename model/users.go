@@ -11,4 +11,9 @@ type User struct {
 	Email    string
 	IsAdmin  bool
 	Title    string
+	Role     string // Роль в процессе согласования приказов
+
+	PasswordChanged    time.Time // Когда пароль меняли последний раз
+	MustChangePassword bool      // Сменить пароль при следующем входе
+	TOTPEnabled        bool      // Вход с кодом из приложения-аутентификатора
 }
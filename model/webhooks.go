@@ -0,0 +1,106 @@
+package model
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Webhook — внешний адрес, на который отправляются события приказов
+type Webhook struct {
+	ID        int64  // Идентификатор
+	Title     string // Наименование (например, «Бухгалтерия»)
+	URL       string // Адрес получателя
+	Secret    string // Ключ подписи HMAC-SHA256
+	Events    string // Типы событий через запятую, пусто — все события
+	KindOfDoc string // Вид документа, пусто — любой
+	Active    bool   // Флаг активности
+}
+
+// Accepts проверяет, подходит ли событие под фильтр вебхука
+func (w Webhook) Accepts(e Event) bool {
+	if !w.Active {
+		return false
+	}
+	if w.Events != "" {
+		found := false
+		for _, t := range strings.Split(w.Events, ",") {
+			if EventType(strings.TrimSpace(t)) == e.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if w.KindOfDoc != "" && w.KindOfDoc != e.Order.KindOfDoc {
+		return false
+	}
+	return true
+}
+
+// Статусы доставки вебхука
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// Delivery — одна доставка события на вебхук (запись очереди)
+type Delivery struct {
+	ID           int64     // Идентификатор
+	WebhookID    int64     // Вебхук
+	Title        string    // Наименование вебхука
+	URL          string    // Адрес вебхука
+	Secret       string    // Ключ подписи вебхука
+	Event        EventType // Тип события
+	Payload      string    // Тело запроса (JSON)
+	Status       string    // pending, delivered, dead
+	Attempts     int       // Количество попыток
+	NextAttempt  time.Time // Время следующей попытки
+	ResponseCode int       // Последний HTTP код ответа
+	LastError    string    // Последняя ошибка
+	Created      time.Time // Время постановки в очередь
+}
+
+// WebhookPayload — тело запроса к вебхуку
+type WebhookPayload struct {
+	Event EventType `json:"event"`
+	Time  time.Time `json:"time"`
+	Order *Order    `json:"order,omitempty"`
+	User  *User     `json:"user,omitempty"`
+}
+
+// enqueueWebhooks ставит события в очередь доставки каждому подходящему вебхуку
+// в транзакции единицы работы: доставка сохраняется вместе с изменением или не сохраняется вовсе
+func (u *UnitOfWork) enqueueWebhooks() error {
+	if len(u.events) == 0 {
+		return nil
+	}
+	hooks, err := u.tx.GetWebhooks(u.ctx)
+	if err != nil {
+		return err
+	}
+	for _, e := range u.events {
+		payload := WebhookPayload{Event: e.Type, Time: e.Time}
+		if e.Type == UserCreated {
+			payload.User = &e.User
+		} else {
+			payload.Order = &e.Order
+		}
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		for _, hook := range hooks {
+			if !hook.Accepts(e) {
+				continue
+			}
+			if err := u.tx.CreateDelivery(u.ctx, Delivery{WebhookID: hook.ID, Event: e.Type, Payload: string(data)}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
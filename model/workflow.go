@@ -0,0 +1,154 @@
+package model
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Состояния приказа в процессе согласования
+const (
+	StatusDraft      = "draft"      // Проект
+	StatusReview     = "review"     // Правовая экспертиза
+	StatusSignature  = "signature"  // На подписи
+	StatusRegistered = "registered" // Зарегистрирован
+)
+
+// Роли пользователей в процессе согласования.
+// Пустая роль — обычный сотрудник, автор приказов
+const (
+	RoleAuthor    = ""
+	RoleLawyer    = "lawyer"
+	RoleSigner    = "signer"
+	RoleArchivist = "archivist"
+)
+
+// StatusTitles — наименования состояний для интерфейса
+var StatusTitles = map[string]string{
+	StatusDraft:      "Проект",
+	StatusReview:     "Правовая экспертиза",
+	StatusSignature:  "На подписи",
+	StatusRegistered: "Зарегистрирован",
+}
+
+// RoleTitles — наименования ролей для интерфейса
+var RoleTitles = map[string]string{
+	RoleAuthor:    "Сотрудник",
+	RoleLawyer:    "Юрист",
+	RoleSigner:    "Подписант",
+	RoleArchivist: "Архивариус",
+}
+
+// Transition — разрешенный переход между состояниями
+type Transition struct {
+	From  string
+	To    string
+	Role  string // Роль, которой разрешен переход; RoleAuthor — только автору приказа
+	Title string // Наименование действия
+}
+
+// Transitions — схема согласования приказа
+var Transitions = []Transition{
+	{StatusDraft, StatusReview, RoleAuthor, "Отправить на правовую экспертизу"},
+	{StatusReview, StatusSignature, RoleLawyer, "Согласовать"},
+	{StatusReview, StatusDraft, RoleLawyer, "Вернуть на доработку"},
+	{StatusSignature, StatusRegistered, RoleSigner, "Подписать и зарегистрировать"},
+	{StatusSignature, StatusDraft, RoleSigner, "Вернуть на доработку"},
+}
+
+// OrderTransition — запись журнала согласования приказа
+type OrderTransition struct {
+	ID       int64     // Идентификатор
+	OrderID  int64     // Приказ
+	From     string    // Исходное состояние
+	To       string    // Новое состояние
+	Username string    // Кто выполнил переход
+	Comment  string    // Комментарий
+	Created  time.Time // Время перехода
+}
+
+// Allowed сообщает, может ли пользователь выполнить переход для приказа
+func (t Transition) Allowed(order Order, user User) bool {
+	if t.From != order.Status {
+		return false
+	}
+	if user.IsAdmin {
+		return true
+	}
+	if t.Role == RoleAuthor {
+		return order.Username == user.Username
+	}
+	return t.Role == user.Role
+}
+
+// CanEditOrder сообщает, может ли пользователь изменить реквизиты и файлы приказа. Проект
+// правят автор и администратор; на экспертизе и на подписи приказ не меняется, чтобы
+// согласовывали и подписывали именно то, что отправлено; зарегистрированный исправляет
+// только администратор
+func CanEditOrder(order Order, user User) bool {
+	switch order.Status {
+	case StatusDraft:
+		return user.IsAdmin || order.Username == user.Username
+	case StatusRegistered, "":
+		return user.IsAdmin
+	}
+	return false
+}
+
+// AllowedTransitions возвращает переходы, доступные пользователю для приказа
+func AllowedTransitions(order Order, user User) []Transition {
+	transitions := []Transition{}
+	for _, t := range Transitions {
+		if t.Allowed(order, user) {
+			transitions = append(transitions, t)
+		}
+	}
+	return transitions
+}
+
+// TransitOrder переводит приказ в новое состояние от имени пользователя.
+// Регистрационный номер присваивается при переходе в StatusRegistered
+func (m *Model) TransitOrder(ctx context.Context, orderID int64, to string, user User, comment string) error {
+	order, err := m.db.GetOrder(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	var transition *Transition
+	for _, t := range Transitions {
+		if t.To == to && t.Allowed(order, user) {
+			transition = &t
+			break
+		}
+	}
+	if transition == nil {
+		return fmt.Errorf("переход %q -> %q не разрешен пользователю %s", order.Status, to, user.Username)
+	}
+	return m.Do(ctx, func(u *UnitOfWork) error {
+		return u.TransitOrder(OrderTransition{OrderID: orderID, From: order.Status, To: to, Username: user.Username, Comment: comment})
+	})
+}
+
+// GetAwaitingOrders возвращает приказы, ожидающие действия пользователя
+func (m *Model) GetAwaitingOrders(ctx context.Context, user User) ([]Order, error) {
+	orders := []Order{}
+	// Собственные проекты автора
+	drafts, err := m.db.GetWorkflowOrders(ctx, StatusDraft, user.Username)
+	if err != nil {
+		return nil, err
+	}
+	orders = append(orders, drafts...)
+
+	seen := map[string]bool{StatusDraft: true}
+	for _, t := range Transitions {
+		if t.Role == RoleAuthor || seen[t.From] || (!user.IsAdmin && t.Role != user.Role) {
+			continue
+		}
+		seen[t.From] = true
+		awaiting, err := m.db.GetWorkflowOrders(ctx, t.From, "")
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, awaiting...)
+	}
+	return orders, nil
+}
@@ -0,0 +1,29 @@
+package model
+
+import "testing"
+
+func TestCanEditOrder(t *testing.T) {
+	author := User{Username: "author"}
+	other := User{Username: "other", Role: RoleLawyer}
+	admin := User{Username: "admin", IsAdmin: true}
+	for _, tc := range []struct {
+		status string
+		user   User
+		want   bool
+	}{
+		{StatusDraft, author, true},
+		{StatusDraft, other, false},
+		{StatusDraft, admin, true},
+		{StatusReview, author, false},
+		{StatusReview, other, false},
+		{StatusReview, admin, false},
+		{StatusSignature, admin, false},
+		{StatusRegistered, author, false},
+		{StatusRegistered, admin, true},
+	} {
+		order := Order{Status: tc.status, Username: "author"}
+		if got := CanEditOrder(order, tc.user); got != tc.want {
+			t.Errorf("%s, %s: %v, ожидалось %v", tc.status, tc.user.Username, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package ui
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path"
+	"time"
+
+	"../context"
+	"../model"
+	"../util"
+)
+
+// Выгрузка и загрузка реестра архивным пакетом ZIP
+func ArchiveHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type PageArchive struct {
+			Archive *model.Archive
+			Error   string
+			IsAdmin bool
+		}
+		u := context.Get(r, "user").(model.User)
+		page := PageArchive{IsAdmin: u.IsAdmin}
+
+		if r.Method == "POST" {
+			r.ParseMultipartForm(32 << 20)
+			file, handler, err := r.FormFile("File")
+			if err != nil {
+				page.Error = "Не выбран файл"
+			} else {
+				defer file.Close()
+				archive, err := m.ImportArchive(r.Context(), file, handler.Size)
+				if err != nil {
+					page.Error = err.Error()
+				} else {
+					page.Archive = &archive
+				}
+			}
+		}
+
+		tmpl, err := template.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "archive.html"))
+		if err != nil {
+			util.Errorf(r.Context(), "error ArchiveHandler: %v", err)
+			return
+		}
+		if err := tmpl.ExecuteTemplate(w, "layout", page); err != nil {
+			log.Println(err.Error())
+			http.Error(w, http.StatusText(500), 500)
+		}
+	}
+}
+
+// Скачивание архивного пакета со всем реестром
+func ExportArchiveHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=dborders-%s.zip", time.Now().Format("2006-01-02")))
+		if _, err := m.ExportArchive(r.Context(), w); err != nil {
+			// заголовки уже отправлены, пакет окажется неполным и не пройдет проверку
+			log.Printf("ExportArchiveHandler: %v", err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package ui
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+
+	"../context"
+	"../model"
+	"../util"
+	"github.com/gorilla/mux"
+)
+
+// departamentForm собирает отдел из полей формы
+func departamentForm(r *http.Request) model.Departament {
+	parentID, _ := strconv.ParseInt(r.FormValue("ParentID"), 10, 64)
+	return model.Departament{
+		ParentID: parentID,
+		Code:     r.FormValue("Code"),
+		Title:    r.FormValue("Title"),
+		Head:     r.FormValue("Head"),
+		Active:   r.FormValue("Active") == "on",
+	}
+}
+
+// Оргструктура: дерево отделов, добавление отдела и загрузка из таблицы CSV/ODS
+func DepartamentsHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type PageDepartaments struct {
+			Departaments []model.Departament
+			Users        []model.User
+			Columns      map[string]string
+			Result       *model.OrgImportResult
+			Error        string
+			IsAdmin      bool
+		}
+		u := context.Get(r, "user").(model.User)
+		page := PageDepartaments{Columns: model.OrgColumns, IsAdmin: u.IsAdmin}
+
+		if r.Method == "POST" {
+			r.ParseMultipartForm(32 << 20)
+			switch r.FormValue("Action") {
+			case "create":
+				if err := m.SaveDepartament(r.Context(), departamentForm(r)); err != nil {
+					util.Errorf(r.Context(), "error DepartamentsHandler: %v", err)
+					page.Error = err.Error()
+				} else {
+					http.Redirect(w, r, "/departaments", 301)
+					return
+				}
+			case "import":
+				file, handler, err := r.FormFile("File")
+				if err != nil {
+					page.Error = "Не выбран файл"
+					break
+				}
+				defer file.Close()
+				rows, err := util.ReadSheet(handler.Filename, file)
+				if err != nil {
+					page.Error = err.Error()
+					break
+				}
+				result, err := m.ImportOrgChart(r.Context(), rows, r.FormValue("DryRun") == "on")
+				if err != nil {
+					page.Error = err.Error()
+				}
+				page.Result = &result
+			default:
+				page.Error = fmt.Sprintf("неизвестное действие %q", r.FormValue("Action"))
+			}
+		}
+
+		departaments, err := m.GetDepartaments(r.Context())
+		if err != nil {
+			fmt.Fprintf(w, "err: %s\n", err)
+			return
+		}
+		users, err := m.GetUsers(r.Context())
+		if err != nil {
+			fmt.Fprintf(w, "err: %s\n", err)
+			return
+		}
+		tmpl, err := template.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "departaments.html"))
+		if err != nil {
+			util.Errorf(r.Context(), "error DepartamentsHandler: %v", err)
+			return
+		}
+		page.Departaments = model.DepartamentTree(departaments)
+		page.Users = users
+		if err := tmpl.ExecuteTemplate(w, "layout", page); err != nil {
+			log.Println(err.Error())
+			http.Error(w, http.StatusText(500), 500)
+		}
+	}
+}
+
+// Изменение отдела и удаление с переводом сотрудников в другой отдел
+func EditDepartamentHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type PageEditDepartament struct {
+			Departament  model.Departament
+			Departaments []model.Departament
+			Users        []model.User
+			Error        string
+			IsAdmin      bool
+		}
+		id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		u := context.Get(r, "user").(model.User)
+		page := PageEditDepartament{IsAdmin: u.IsAdmin}
+
+		if r.Method == "POST" {
+			err := r.ParseForm()
+			if err != nil {
+				log.Println(err)
+			}
+			switch r.FormValue("Action") {
+			case "save":
+				departament := departamentForm(r)
+				departament.ID = id
+				err = m.SaveDepartament(r.Context(), departament)
+			case "delete":
+				reassignTo, _ := strconv.ParseInt(r.FormValue("ReassignTo"), 10, 64)
+				err = m.DeleteDepartament(r.Context(), id, reassignTo)
+			default:
+				err = fmt.Errorf("неизвестное действие %q", r.FormValue("Action"))
+			}
+			if err == nil {
+				http.Redirect(w, r, "/departaments", 301)
+				return
+			}
+			util.Errorf(r.Context(), "error EditDepartamentHandler: %v", err)
+			page.Error = err.Error()
+		}
+
+		departament, err := m.GetDepartament(r.Context(), id)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		departaments, err := m.GetDepartaments(r.Context())
+		if err != nil {
+			fmt.Fprintf(w, "err: %s\n", err)
+			return
+		}
+		users, err := m.GetUsers(r.Context())
+		if err != nil {
+			fmt.Fprintf(w, "err: %s\n", err)
+			return
+		}
+		tmpl, err := template.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "departaments_edit.html"))
+		if err != nil {
+			util.Errorf(r.Context(), "error EditDepartamentHandler: %v", err)
+			return
+		}
+		page.Departament = departament
+		page.Departaments = model.DepartamentTree(departaments)
+		page.Users = users
+		if err := tmpl.ExecuteTemplate(w, "layout", page); err != nil {
+			log.Println(err.Error())
+			http.Error(w, http.StatusText(500), 500)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package ui
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+
+	"../context"
+	"../model"
+	"../util"
+	"github.com/gorilla/mux"
+)
+
+// Сроки хранения по видам документов
+func RetentionHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type PageRetention struct {
+			Kinds   []model.HBKindOfDoc
+			Error   string
+			IsAdmin bool
+		}
+		page := PageRetention{}
+
+		if r.Method == "POST" {
+			err := r.ParseForm()
+			if err != nil {
+				log.Println(err)
+			}
+			id, _ := strconv.ParseInt(r.FormValue("ID"), 10, 64)
+			years, err := strconv.Atoi(r.FormValue("RetentionYears"))
+			if err != nil || years < 0 {
+				page.Error = "Срок хранения должен быть неотрицательным числом лет"
+			} else if err := m.UpdateHBKindOfDocRetention(r.Context(), id, years); err != nil {
+				page.Error = err.Error()
+			} else {
+				http.Redirect(w, r, "/retention", 301)
+				return
+			}
+		}
+
+		kinds, err := m.GetHBKindOfDoc(r.Context())
+		if err != nil {
+			fmt.Fprintf(w, "err: %s\n", err)
+			return
+		}
+		tmpl, err := template.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "retention.html"))
+		if err != nil {
+			util.Errorf(r.Context(), "error RetentionHandler: %v", err)
+			return
+		}
+		u := context.Get(r, "user")
+		page.Kinds = kinds
+		page.IsAdmin = u.(model.User).IsAdmin
+		if err := tmpl.ExecuteTemplate(w, "layout", page); err != nil {
+			log.Println(err.Error())
+			http.Error(w, http.StatusText(500), 500)
+		}
+	}
+}
+
+// Акты о выделении документов к уничтожению
+func ListDisposalActsHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type PageDisposal struct {
+			Acts    []model.DisposalAct
+			IsAdmin bool
+		}
+		acts, err := m.GetDisposalActs(r.Context())
+		if err != nil {
+			fmt.Fprintf(w, "err: %s\n", err)
+			return
+		}
+		// Передаем функцию в шаблон
+		funcMap := template.FuncMap{
+			// форматируем дату
+			"fdate": util.FormatDate,
+			// наименование состояния акта
+			"actstatus": func(status string) string { return model.ActStatusTitles[status] },
+		}
+		tmpl := template.New("disposal").Funcs(funcMap)
+		tmpl, err = tmpl.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "disposal.html"))
+		if err != nil {
+			util.Errorf(r.Context(), "error ListDisposalActsHandler: %v", err)
+			return
+		}
+		u := context.Get(r, "user")
+		page := PageDisposal{Acts: acts, IsAdmin: u.(model.User).IsAdmin}
+		if err := tmpl.ExecuteTemplate(w, "layout", page); err != nil {
+			log.Println(err.Error())
+			http.Error(w, http.StatusText(500), 500)
+		}
+	}
+}
+
+// Акт о выделении к уничтожению: просмотр, исключение документов и утверждение
+func DisposalActHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type PageDisposalAct struct {
+			Act        model.DisposalAct
+			CanApprove bool
+			Error      string
+			IsAdmin    bool
+		}
+		vars := mux.Vars(r)
+		id := int64(intVar(vars, "id"))
+		u := context.Get(r, "user").(model.User)
+		page := PageDisposalAct{CanApprove: model.CanApproveDisposal(u), IsAdmin: u.IsAdmin}
+
+		if r.Method == "POST" {
+			if !page.CanApprove {
+				http.Error(w, "Archivist required", http.StatusForbidden)
+				return
+			}
+			err := r.ParseForm()
+			if err != nil {
+				log.Println(err)
+			}
+			if item, _ := strconv.ParseInt(r.FormValue("Exclude"), 10, 64); item > 0 {
+				err = m.ExcludeDisposalItem(r.Context(), id, item)
+			} else {
+				version, _ := strconv.Atoi(r.FormValue("Version"))
+				err = m.ApproveDisposalAct(r.Context(), id, version, u, r.FormValue("Comment"))
+			}
+			if err != nil {
+				page.Error = err.Error()
+			} else {
+				http.Redirect(w, r, fmt.Sprintf("/disposal/%d", id), 301)
+				return
+			}
+		}
+
+		act, err := m.GetDisposalAct(r.Context(), id)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		// Передаем функцию в шаблон
+		funcMap := template.FuncMap{
+			// форматируем дату
+			"fdate": util.FormatDate,
+			// наименование состояния акта
+			"actstatus": func(status string) string { return model.ActStatusTitles[status] },
+		}
+		tmpl := template.New("disposal_act").Funcs(funcMap)
+		tmpl, err = tmpl.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "disposal_act.html"))
+		if err != nil {
+			util.Errorf(r.Context(), "error DisposalActHandler: %v", err)
+			return
+		}
+		page.Act = act
+		if err := tmpl.ExecuteTemplate(w, "layout", page); err != nil {
+			log.Println(err.Error())
+			http.Error(w, http.StatusText(500), 500)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package ui
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"../context"
+	"../model"
+	"../util"
+	"github.com/gorilla/mux"
+)
+
+// Справочники приказов: добавление, переименование, отключение и объединение записей.
+// Записи не удаляются — приказы ссылаются на них с ON DELETE RESTRICT
+func HandbooksHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type PageHandbooks struct {
+			Handbooks []model.Handbook
+			Handbook  model.Handbook
+			Entries   []model.HandbookEntry
+			Error     string
+			IsAdmin   bool
+		}
+		handbook, ok := model.FindHandbook(mux.Vars(r)["handbook"])
+		if !ok {
+			http.Redirect(w, r, "/handbooks/"+model.Handbooks[0].Name, 302)
+			return
+		}
+		page := PageHandbooks{Handbooks: model.Handbooks, Handbook: handbook}
+
+		if r.Method == "POST" {
+			err := r.ParseForm()
+			if err != nil {
+				log.Println(err)
+			}
+			id, _ := strconv.ParseInt(r.FormValue("ID"), 10, 64)
+			switch r.FormValue("Action") {
+			case "create":
+				err = createHandbookEntry(r, m, handbook.Name, strings.TrimSpace(r.FormValue("Name")))
+			case "rename":
+				err = m.RenameHandbookEntry(r.Context(), handbook.Name, id, r.FormValue("Name"))
+			case "deactivate":
+				err = m.SetHandbookEntryActive(r.Context(), handbook.Name, id, false)
+			case "activate":
+				err = m.SetHandbookEntryActive(r.Context(), handbook.Name, id, true)
+			case "merge":
+				into, _ := strconv.ParseInt(r.FormValue("Into"), 10, 64)
+				err = m.MergeHandbookEntries(r.Context(), handbook.Name, id, into)
+			default:
+				err = fmt.Errorf("неизвестное действие %q", r.FormValue("Action"))
+			}
+			if err == nil {
+				http.Redirect(w, r, "/handbooks/"+handbook.Name, 301)
+				return
+			}
+			util.Errorf(r.Context(), "error HandbooksHandler: %v", err)
+			page.Error = err.Error()
+		}
+
+		entries, err := m.GetHandbookEntries(r.Context(), handbook.Name)
+		if err != nil {
+			fmt.Fprintf(w, "err: %s\n", err)
+			return
+		}
+		tmpl, err := template.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "handbooks.html"))
+		if err != nil {
+			util.Errorf(r.Context(), "error HandbooksHandler: %v", err)
+			return
+		}
+		u := context.Get(r, "user")
+		page.Entries = entries
+		page.IsAdmin = u.(model.User).IsAdmin
+		if err := tmpl.ExecuteTemplate(w, "layout", page); err != nil {
+			log.Println(err.Error())
+			http.Error(w, http.StatusText(500), 500)
+		}
+	}
+}
+
+// Новая запись справочника через методы создания каждого справочника
+func createHandbookEntry(r *http.Request, m *model.Model, handbook, name string) error {
+	if name == "" {
+		return fmt.Errorf("наименование не может быть пустым")
+	}
+	switch handbook {
+	case model.HandbookDocType:
+		return m.CreateHBDocType(r.Context(), model.HBDocType{Name: name})
+	case model.HandbookKindOfDoc:
+		return m.CreateHBKindOfDoc(r.Context(), model.HBKindOfDoc{Name: name})
+	case model.HandbookDocLabel:
+		return m.CreateHBDocLabel(r.Context(), model.HBDocLabel{Name: name})
+	}
+	return fmt.Errorf("неизвестный справочник %q", handbook)
+}
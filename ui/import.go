@@ -0,0 +1,61 @@
+package ui
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"path"
+
+	"../context"
+	"../model"
+	"../util"
+)
+
+// Загрузка исторических приказов из таблицы CSV/ODS с пробным запуском
+func ImportOrdersHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type PageImport struct {
+			Result  *model.ImportResult
+			Columns map[string]string
+			Error   string
+			IsAdmin bool
+		}
+		u := context.Get(r, "user").(model.User)
+		page := PageImport{Columns: model.ImportColumns, IsAdmin: u.IsAdmin}
+
+		if r.Method == "POST" {
+			r.ParseMultipartForm(32 << 20)
+			file, handler, err := r.FormFile("File")
+			if err != nil {
+				page.Error = "Не выбран файл"
+			} else {
+				defer file.Close()
+				rows, err := util.ReadSheet(handler.Filename, file)
+				if err != nil {
+					page.Error = err.Error()
+				} else {
+					opts := model.ImportOptions{
+						DryRun:          r.FormValue("DryRun") == "on",
+						CreateHandbooks: r.FormValue("CreateHandbooks") == "on",
+						Username:        u.Username,
+					}
+					result, err := m.ImportOrders(r.Context(), rows, opts)
+					if err != nil {
+						page.Error = err.Error()
+					}
+					page.Result = &result
+				}
+			}
+		}
+
+		tmpl, err := template.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "import.html"))
+		if err != nil {
+			util.Errorf(r.Context(), "error ImportOrdersHandler: %v", err)
+			return
+		}
+		if err := tmpl.ExecuteTemplate(w, "layout", page); err != nil {
+			log.Println(err.Error())
+			http.Error(w, http.StatusText(500), 500)
+		}
+	}
+}
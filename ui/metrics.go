@@ -0,0 +1,41 @@
+package ui
+
+import (
+	"net/http"
+
+	"../util"
+)
+
+var (
+	httpRequestsTotal = util.Metrics.NewCounter("dborders_http_requests_total",
+		"HTTP requests by mux route template, method and status code.", "route", "method", "code")
+	httpRequestDuration = util.Metrics.NewHistogram("dborders_http_request_duration_seconds",
+		"HTTP request latency by mux route template and method.", util.DefBuckets, "route", "method")
+	loginsTotal = util.Metrics.NewCounter("dborders_logins_total",
+		"Login attempts by result.", "result")
+)
+
+// statusRecorder запоминает код и размер ответа для журнала и метрик
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush нужен обработчикам, которые отдают ответ частями
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
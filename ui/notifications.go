@@ -0,0 +1,140 @@
+package ui
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path"
+
+	"../context"
+	"../model"
+	"../util"
+	"github.com/gorilla/mux"
+)
+
+// Входящие уведомления пользователя. При просмотре помечаются прочитанными
+func NotificationsHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type PageNotifications struct {
+			Notifications []model.Notification
+			IsAdmin       bool
+		}
+		u := context.Get(r, "user").(model.User)
+		notifications, err := m.GetNotifications(r.Context(), u.ID, 100)
+		if err != nil {
+			fmt.Fprintf(w, "err: %s\n", err)
+			return
+		}
+		if err := m.MarkNotificationsRead(r.Context(), u.ID); err != nil {
+			util.Errorf(r.Context(), "error NotificationsHandler: %v", err)
+		}
+		// Передаем функцию в шаблон
+		funcMap := template.FuncMap{
+			// форматируем дату
+			"fdate": util.FormatDate,
+		}
+		tmpl := template.New("notifications").Funcs(funcMap)
+		tmpl, err = tmpl.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "notifications.html"))
+		if err != nil {
+			util.Errorf(r.Context(), "error NotificationsHandler: %v", err)
+			return
+		}
+		page := PageNotifications{Notifications: notifications, IsAdmin: u.IsAdmin}
+		if err := tmpl.ExecuteTemplate(w, "layout", page); err != nil {
+			log.Println(err.Error())
+			http.Error(w, http.StatusText(500), 500)
+		}
+	}
+}
+
+// Количество непрочитанных уведомлений для значка в шапке
+func CountNotificationsHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := context.Get(r, "user").(model.User)
+		count, err := m.GetCountUnreadNotifications(r.Context(), u.ID)
+		if err != nil {
+			http.Error(w, http.StatusText(500), 500)
+			return
+		}
+		a, err := json.Marshal(struct{ Unread int }{count})
+		if err != nil {
+			log.Println("ERROR: " + err.Error())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(a)
+	}
+}
+
+// Подписки пользователя на события приказов
+func SubscriptionsHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type PageSubscriptions struct {
+			Subscriptions []model.Subscription
+			HBDocType     []model.HBDocType
+			Departaments  []model.Departament
+			IsAdmin       bool
+		}
+		u := context.Get(r, "user").(model.User)
+
+		if r.Method == "POST" {
+			err := r.ParseForm()
+			if err != nil {
+				log.Println(err)
+			}
+			subscription := model.Subscription{
+				UserID:      u.ID,
+				DocType:     r.FormValue("DocType"),
+				Departament: r.FormValue("Departament"),
+				ByEmail:     r.FormValue("ByEmail") == "on",
+			}
+			if err := m.CreateSubscription(r.Context(), subscription); err != nil {
+				http.Error(w, err.Error(), 400)
+				return
+			}
+			http.Redirect(w, r, "/subscriptions", 301)
+			return
+		}
+
+		subscriptions, err := m.GetSubscriptions(r.Context(), u.ID)
+		if err != nil {
+			fmt.Fprintf(w, "err: %s\n", err)
+			return
+		}
+		hbtype, err := m.GetHBDocType(r.Context())
+		if err != nil {
+			fmt.Fprintf(w, "err: %s\n", err)
+			return
+		}
+		departaments, err := m.GetDepartaments(r.Context())
+		if err != nil {
+			fmt.Fprintf(w, "err: %s\n", err)
+			return
+		}
+		tmpl, err := template.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "subscriptions.html"))
+		if err != nil {
+			util.Errorf(r.Context(), "error SubscriptionsHandler: %v", err)
+			return
+		}
+		page := PageSubscriptions{Subscriptions: subscriptions, HBDocType: hbtype, Departaments: departaments, IsAdmin: u.IsAdmin}
+		if err := tmpl.ExecuteTemplate(w, "layout", page); err != nil {
+			log.Println(err.Error())
+			http.Error(w, http.StatusText(500), 500)
+		}
+	}
+}
+
+func DeleteSubscriptionHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id := int64(intVar(vars, "id"))
+		u := context.Get(r, "user").(model.User)
+
+		if err := m.DeleteSubscription(r.Context(), id, u.ID); err != nil {
+			fmt.Fprintf(w, "err: %s", err)
+			return
+		}
+		http.Redirect(w, r, "/subscriptions", 301)
+	}
+}
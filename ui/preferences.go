@@ -0,0 +1,71 @@
+package ui
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+
+	"../context"
+	"../model"
+	"../util"
+)
+
+// Настройки списков приказов: размер страницы, сортировка и скрытые столбцы
+func PreferencesHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type PagePreferences struct {
+			Prefs     model.Preferences
+			Columns   []model.Column
+			Visible   map[string]bool
+			PageSizes []int
+			Error     string
+			IsAdmin   bool
+		}
+		u := context.Get(r, "user").(model.User)
+		prefs, err := m.GetPreferences(r.Context(), u.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		page := PagePreferences{Columns: model.OrderColumns, PageSizes: model.PageSizes, IsAdmin: u.IsAdmin}
+
+		if r.Method == "POST" {
+			err := r.ParseForm()
+			if err != nil {
+				log.Println(err)
+			}
+			prefs.PageSize, _ = strconv.Atoi(r.FormValue("PageSize"))
+			prefs.SortBy = r.FormValue("SortBy")
+			prefs.SortDesc = r.FormValue("SortDesc") == "on"
+			prefs.Hidden = nil
+			for _, c := range model.OrderColumns {
+				if r.FormValue("Column_"+c.Key) != "on" {
+					prefs.Hidden = append(prefs.Hidden, c.Key)
+				}
+			}
+			prefs.Normalize()
+			if len(prefs.Hidden) == len(model.OrderColumns) {
+				page.Error = "Нельзя скрыть все столбцы"
+			} else if err := m.SavePreferences(r.Context(), prefs); err != nil {
+				page.Error = err.Error()
+			} else {
+				http.Redirect(w, r, "/preferences", 301)
+				return
+			}
+		}
+
+		tmpl, err := template.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "preferences.html"))
+		if err != nil {
+			util.Errorf(r.Context(), "error PreferencesHandler: %v", err)
+			return
+		}
+		page.Prefs = prefs
+		page.Visible = prefs.Visible()
+		if err := tmpl.ExecuteTemplate(w, "layout", page); err != nil {
+			log.Println(err.Error())
+			http.Error(w, http.StatusText(500), 500)
+		}
+	}
+}
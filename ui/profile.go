@@ -0,0 +1,90 @@
+package ui
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path"
+
+	"../context"
+	"../model"
+	"../util"
+	"github.com/gorilla/sessions"
+)
+
+// notifyEmailChanged сообщает на прежний адрес, что почта учетной записи изменена:
+// если пароль украден, владелец узнает об этом раньше, чем злоумышленник сбросит пароль
+func notifyEmailChanged(r *http.Request, config Config, username, old, email string) {
+	if old == "" || old == email || config.Mail.Addr == "" {
+		return
+	}
+	body := fmt.Sprintf(`<p>Адрес почты пользователя %s изменен на %s.</p>
+<p>Если вы этого не делали, срочно обратитесь к администратору.</p>`,
+		template.HTMLEscapeString(username), template.HTMLEscapeString(email))
+	go func() {
+		if err := util.SendMail(config.Mail, []string{old}, "Изменен адрес почты", body); err != nil {
+			log.Printf("email change: error sending to %s: %v", old, err)
+		}
+	}()
+}
+
+// Профиль пользователя: сведения об учетной записи, адрес почты и смена пароля.
+// Сюда же RequireLogin направляет тех, кому нужно сменить пароль
+func ProfileHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type PageProfile struct {
+			User           model.User
+			Policy         model.PasswordPolicy
+			ChangeRequired bool
+			Saved          string
+			Error          string
+			IsAdmin        bool
+		}
+		u := context.Get(r, "user").(model.User)
+		page := PageProfile{User: u, Policy: model.DefaultPasswordPolicy, IsAdmin: u.IsAdmin}
+
+		if r.Method == "POST" {
+			err := r.ParseForm()
+			if err != nil {
+				log.Println(err)
+			}
+			switch r.FormValue("Action") {
+			case "email":
+				var old string
+				if old, err = m.ChangeEmail(r.Context(), u.Username, r.FormValue("OldPassword"), r.FormValue("Email")); err == nil {
+					notifyEmailChanged(r, config, u.Username, old, r.FormValue("Email"))
+				}
+			case "password":
+				err = m.ChangePassword(r.Context(), u.Username, r.FormValue("OldPassword"), r.FormValue("NewPassword"), r.FormValue("Confirm"))
+				// прочие сессии пользователя закрываются, текущая остается открытой с новым паролем
+				if err == nil {
+					if u, err = m.GetUser(r.Context(), u.ID); err == nil {
+						session := context.Get(r, "session").(*sessions.Session)
+						loginSession(session, u)
+						err = session.Save(r, w)
+					}
+				}
+			}
+			if err == nil {
+				http.Redirect(w, r, "/profile?saved="+r.FormValue("Action"), 301)
+				return
+			}
+			util.Errorf(r.Context(), "error ProfileHandler: %v", err)
+			page.Error = err.Error()
+		}
+
+		page.ChangeRequired = model.PasswordChangeRequired(u)
+		page.Saved = r.FormValue("saved")
+		tmpl, err := template.New("profile").Funcs(template.FuncMap{"fdate": util.FormatDate}).
+			ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "profile.html"))
+		if err != nil {
+			util.Errorf(r.Context(), "error ProfileHandler: %v", err)
+			return
+		}
+		if err := tmpl.ExecuteTemplate(w, "layout", page); err != nil {
+			log.Println(err.Error())
+			http.Error(w, http.StatusText(500), 500)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package ui
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"../model"
+	"../util"
+)
+
+// Ограничения запросов сброса пароля за resetWindow
+const (
+	resetWindow     = time.Hour
+	resetPerAccount = 3
+	resetPerIP      = 10
+)
+
+// rateLimiter — счетчик событий по ключу в скользящем окне, хранится в памяти процесса
+type rateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	hits   map[string][]time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, hits: map[string][]time.Time{}}
+}
+
+// Allow учитывает событие по ключу и сообщает, укладывается ли оно в лимит
+func (l *rateLimiter) Allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	recent := l.hits[key][:0]
+	for _, t := range l.hits[key] {
+		if now.Sub(t) < l.window {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= l.limit {
+		l.hits[key] = recent
+		return false
+	}
+	l.hits[key] = append(recent, now)
+	// старые ключи вычищаем, чтобы перебор имен не раздувал карту
+	if len(l.hits) > 10000 {
+		for k, ts := range l.hits {
+			if len(ts) == 0 || now.Sub(ts[len(ts)-1]) >= l.window {
+				delete(l.hits, k)
+			}
+		}
+	}
+	return true
+}
+
+var (
+	resetKey        []byte // ключ подписи ссылок сброса, выводится из ключа сессий
+	resetByAccount  = newRateLimiter(resetPerAccount, resetWindow)
+	resetByClientIP = newRateLimiter(resetPerIP, resetWindow)
+)
+
+// deriveResetKey выводит отдельный ключ для ссылок сброса, чтобы подпись cookie и ссылок не совпадали
+func deriveResetKey(secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("password-reset"))
+	return mac.Sum(nil)
+}
+
+// clientIP возвращает адрес клиента из соединения; заголовкам прокси не доверяем
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// resetAvailable сообщает, возможен ли сброс по почте: задан адрес SMTP и внешний адрес для ссылок
+func resetAvailable(config Config) bool {
+	return config.Mail.Addr != "" && config.BaseURL != ""
+}
+
+// resetTokens — выдача ссылок сброса; в модели это PasswordResetToken
+type resetTokens interface {
+	PasswordResetToken(ctx context.Context, key []byte, username string, ttl time.Duration) (model.User, string, error)
+}
+
+// Запрос ссылки сброса пароля. Ответ одинаков, есть такой пользователь или нет
+func ForgotPasswordHandler(config Config, m *model.Model) http.HandlerFunc {
+	return forgotPassword(config, m)
+}
+
+func forgotPassword(config Config, m resetTokens) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := struct {
+			Available bool
+			Sent      bool
+			Error     string
+		}{Available: resetAvailable(config)}
+
+		if r.Method == "POST" && params.Available {
+			username := strings.TrimSpace(r.FormValue("username"))
+			if !resetByClientIP.Allow(clientIP(r)) {
+				w.WriteHeader(http.StatusTooManyRequests)
+				params.Error = "Слишком много запросов, попробуйте позже"
+			} else {
+				params.Sent = true
+				// лимит по имени, а не по найденному пользователю: превышение не выдает, есть ли учетная запись
+				if username != "" && resetByAccount.Allow(strings.ToLower(username)) {
+					sendResetLink(r, config, m, username)
+				}
+			}
+		}
+
+		s, err := loadTmpl("assets/templates/password_forgot.html", params)
+		if err != nil {
+			util.Errorf(r.Context(), "error loading template: %s\n", err)
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		fmt.Fprint(w, s)
+	}
+}
+
+// sendResetLink отправляет письмо в фоне, чтобы время ответа не зависело от наличия пользователя
+func sendResetLink(r *http.Request, config Config, m resetTokens, username string) {
+	ttl := time.Duration(config.ResetTTL) * time.Second
+	user, token, err := m.PasswordResetToken(r.Context(), resetKey, username, ttl)
+	if err != nil {
+		util.Infof(r.Context(), "password reset for %q not sent: %v", username, err)
+		return
+	}
+	link := strings.TrimRight(config.BaseURL, "/") + "/password/reset?token=" + token
+	body := fmt.Sprintf(`<p>Для пользователя %s запрошен сброс пароля.</p>
+<p><a href="%s">Задать новый пароль</a> — ссылка действует %d мин. и только один раз.</p>
+<p>Если вы не запрашивали сброс, просто не обращайте внимания на это письмо.</p>`,
+		template.HTMLEscapeString(user.Username), template.HTMLEscapeString(link), config.ResetTTL/60)
+	go func() {
+		if err := util.SendMail(config.Mail, []string{user.Email}, "Сброс пароля", body); err != nil {
+			log.Printf("password reset: error sending to %s: %v", user.Email, err)
+		}
+	}()
+}
+
+// Новый пароль по ссылке из письма
+func ResetPasswordHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := struct {
+			Token  string
+			Policy model.PasswordPolicy
+			Error  string
+		}{Token: r.FormValue("token"), Policy: model.DefaultPasswordPolicy}
+
+		if r.Method == "POST" {
+			err := m.ResetPasswordByToken(r.Context(), resetKey, params.Token, r.FormValue("password"), r.FormValue("confirm"))
+			if err == nil {
+				http.Redirect(w, r, "/login", 302)
+				return
+			}
+			params.Error = err.Error()
+		} else if _, err := m.CheckResetToken(r.Context(), resetKey, params.Token); err != nil {
+			params.Error = err.Error()
+			params.Token = ""
+		}
+
+		s, err := loadTmpl("assets/templates/password_reset.html", params)
+		if err != nil {
+			util.Errorf(r.Context(), "error loading template: %s\n", err)
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		fmt.Fprint(w, s)
+	}
+}
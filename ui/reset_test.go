@@ -0,0 +1,169 @@
+package ui
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"../model"
+	"../util"
+	"../util/smtptest"
+)
+
+// resetUsers — пользователи с адресами почты вместо модели
+type resetUsers map[string]string
+
+func (u resetUsers) PasswordResetToken(ctx context.Context, key []byte, username string, ttl time.Duration) (model.User, string, error) {
+	email, ok := u[username]
+	if !ok {
+		return model.User{}, "", fmt.Errorf("пользователь %s не найден", username)
+	}
+	return model.User{Username: username, Email: email}, "token-" + username, nil
+}
+
+// newResetHandler — обработчик запроса ссылки с тестовым SMTP сервером и свежими лимитами.
+// Шаблоны ищутся относительно корня репозитория
+func newResetHandler(t *testing.T) (http.HandlerFunc, *smtptest.Server) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(".."); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	srv, err := smtptest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	resetByAccount = newRateLimiter(resetPerAccount, resetWindow)
+	resetByClientIP = newRateLimiter(resetPerIP, resetWindow)
+
+	config := Config{
+		Mail:     util.MailConfig{Addr: srv.Addr, From: "orders@example.org"},
+		BaseURL:  "https://orders.example.org",
+		ResetTTL: 3600,
+	}
+	users := resetUsers{"ivanov": "ivanov@example.org", "petrov": "petrov@example.org"}
+	return forgotPassword(config, users), srv
+}
+
+func requestReset(h http.HandlerFunc, username, ip string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/password/forgot", strings.NewReader(url.Values{"username": {username}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.RemoteAddr = ip + ":40000"
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+// waitMessages ждет n писем: письма уходят в фоне. Лишние письма тоже видны,
+// потому что после n ждем еще немного
+func waitMessages(t *testing.T, srv *smtptest.Server, n int) []smtptest.Message {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); len(srv.Messages()) < n && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(100 * time.Millisecond)
+	return srv.Messages()
+}
+
+// mailBody — HTML части письма, раскодированные из base64
+func mailBody(t *testing.T, msg smtptest.Message) string {
+	t.Helper()
+	m, err := mail.ReadMessage(strings.NewReader(msg.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body strings.Builder
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r io.Reader = part
+		if part.Header.Get("Content-Transfer-Encoding") == "base64" {
+			r = base64.NewDecoder(base64.StdEncoding, part)
+		}
+		if _, err := io.Copy(&body, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return body.String()
+}
+
+func TestForgotPasswordSameResponse(t *testing.T) {
+	h, srv := newResetHandler(t)
+	known := requestReset(h, "ivanov", "10.0.0.1")
+	unknown := requestReset(h, "sidorov", "10.0.0.1")
+	if known.Code != unknown.Code || known.Body.String() != unknown.Body.String() {
+		t.Errorf("ответ выдает наличие пользователя: %d и %d\n%s\n%s", known.Code, unknown.Code, known.Body, unknown.Body)
+	}
+	messages := waitMessages(t, srv, 1)
+	if len(messages) != 1 || strings.Join(messages[0].To, ",") != "ivanov@example.org" {
+		t.Fatalf("письма: %+v", messages)
+	}
+	if body := mailBody(t, messages[0]); !strings.Contains(body, "https://orders.example.org/password/reset?token=token-ivanov") {
+		t.Errorf("в письме нет ссылки:\n%s", body)
+	}
+}
+
+func TestForgotPasswordAccountLimit(t *testing.T) {
+	h, srv := newResetHandler(t)
+	var first string
+	for i := 0; i <= resetPerAccount; i++ {
+		w := requestReset(h, "ivanov", fmt.Sprintf("10.0.1.%d", i))
+		if i == 0 {
+			first = w.Body.String()
+		}
+		// превышение лимита по имени не отличается от обычного ответа
+		if w.Code != 200 || w.Body.String() != first {
+			t.Errorf("запрос %d: %d\n%s", i+1, w.Code, w.Body)
+		}
+	}
+	if messages := waitMessages(t, srv, resetPerAccount); len(messages) != resetPerAccount {
+		t.Errorf("писем %d, ожидалось %d", len(messages), resetPerAccount)
+	}
+}
+
+func TestForgotPasswordIPLimit(t *testing.T) {
+	h, srv := newResetHandler(t)
+	for i := 0; i < resetPerIP; i++ {
+		if w := requestReset(h, fmt.Sprintf("user%d", i), "10.0.2.1"); w.Code != 200 {
+			t.Fatalf("запрос %d: %d", i+1, w.Code)
+		}
+	}
+	if w := requestReset(h, "ivanov", "10.0.2.1"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("сверх лимита по адресу: %d", w.Code)
+	}
+	// с другого адреса запрос проходит
+	if w := requestReset(h, "petrov", "10.0.2.2"); w.Code != 200 {
+		t.Errorf("другой адрес: %d", w.Code)
+	}
+	messages := waitMessages(t, srv, 1)
+	if len(messages) != 1 || strings.Join(messages[0].To, ",") != "petrov@example.org" {
+		t.Errorf("письма: %+v", messages)
+	}
+}
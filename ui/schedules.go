@@ -0,0 +1,96 @@
+package ui
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path"
+
+	"../context"
+	"../model"
+	"../util"
+	"github.com/gorilla/mux"
+)
+
+// Расписания рассылки отчетов руководителям отделов
+func ListSchedulesHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type PageSchedules struct {
+			Schedules    []model.Schedule
+			Departaments []model.Departament
+			Error        string
+			IsAdmin      bool
+		}
+		page := PageSchedules{}
+
+		if r.Method == "POST" {
+			err := r.ParseForm()
+			if err != nil {
+				log.Println(err)
+			}
+			schedule := model.Schedule{
+				Title:       r.FormValue("Title"),
+				Spec:        r.FormValue("Spec"),
+				Format:      r.FormValue("Format"),
+				Departament: r.FormValue("Departament"),
+				Recipients:  r.FormValue("Recipients"),
+				Active:      r.FormValue("Active") == "on",
+			}
+			if schedule.Format != model.ReportCSV && schedule.Format != model.ReportODS {
+				schedule.Format = model.ReportHTML
+			}
+			if _, err := util.ParseCron(schedule.Spec); err != nil {
+				page.Error = err.Error()
+			} else if err := m.CreateSchedule(r.Context(), schedule); err != nil {
+				page.Error = err.Error()
+			} else {
+				http.Redirect(w, r, "/schedules", 301)
+				return
+			}
+		}
+
+		schedules, err := m.GetSchedules(r.Context())
+		if err != nil {
+			fmt.Fprintf(w, "err: %s\n", err)
+			return
+		}
+		departaments, err := m.GetDepartaments(r.Context())
+		if err != nil {
+			fmt.Fprintf(w, "err: %s\n", err)
+			return
+		}
+		// Передаем функцию в шаблон
+		funcMap := template.FuncMap{
+			// форматируем дату
+			"fdate": util.FormatDate,
+		}
+		tmpl := template.New("schedules").Funcs(funcMap)
+		tmpl, err = tmpl.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "schedules.html"))
+		if err != nil {
+			util.Errorf(r.Context(), "error ListSchedulesHandler: %v", err)
+			return
+		}
+		u := context.Get(r, "user")
+		page.Schedules = schedules
+		page.Departaments = departaments
+		page.IsAdmin = u.(model.User).IsAdmin
+		if err := tmpl.ExecuteTemplate(w, "layout", page); err != nil {
+			log.Println(err.Error())
+			http.Error(w, http.StatusText(500), 500)
+		}
+	}
+}
+
+func DeleteScheduleHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id := int64(intVar(vars, "id"))
+
+		if err := m.DeleteSchedule(r.Context(), id); err != nil {
+			fmt.Fprintf(w, "err: %s", err)
+			return
+		}
+		http.Redirect(w, r, "/schedules", 301)
+	}
+}
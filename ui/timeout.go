@@ -0,0 +1,38 @@
+package ui
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"../model"
+)
+
+var (
+	requestTimeout     time.Duration
+	longRequestTimeout time.Duration
+)
+
+// longRequests — маршруты выгрузки и загрузки реестра, которым нужно больше времени
+var longRequests = map[string]bool{
+	"/archive":        true,
+	"/archive/export": true,
+	"/orders/import":  true,
+}
+
+// Timeout задает срок запроса в контексте: когда он истекает или браузер закрывает
+// соединение, pgDb отменяет выполняющийся запрос к PostgreSQL
+func Timeout(h http.Handler, m *model.Model) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout := requestTimeout
+		if longRequests[routeTemplate(r)] {
+			timeout = longRequestTimeout
+		}
+		if timeout > 0 {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			r = r.WithContext(ctx)
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,164 @@
+package ui
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"../context"
+	"../model"
+	"../util"
+	"github.com/gorilla/sessions"
+)
+
+// Второй шаг входа: сколько ждать код после пароля и сколько попыток дать
+const (
+	pendingLoginTTL = 5 * time.Minute
+	totpAttempts    = 5
+	totpWindow      = 15 * time.Minute
+)
+
+// totpByAccount — попытки ввести код по пользователю: перебор не спасает новая сессия
+var totpByAccount = newRateLimiter(totpAttempts, totpWindow)
+
+// pendingUser возвращает пользователя, который ввел пароль, но еще не код; 0 — такого нет или время вышло
+func pendingUser(session *sessions.Session) int64 {
+	id, ok := session.Values["pending_id"].(int64)
+	at, _ := session.Values["pending_at"].(int64)
+	if !ok || time.Since(time.Unix(at, 0)) > pendingLoginTTL {
+		return 0
+	}
+	return id
+}
+
+// Второй шаг входа: код из приложения-аутентификатора или код восстановления
+func LoginTOTPHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		session := context.Get(r, "session").(*sessions.Session)
+		id := pendingUser(session)
+		if id == 0 {
+			delete(session.Values, "pending_id")
+			delete(session.Values, "pending_at")
+			session.Save(r, w)
+			http.Redirect(w, r, "/login", 302)
+			return
+		}
+		params := struct {
+			Error string
+		}{}
+
+		if r.Method == "POST" {
+			err := fmt.Errorf("слишком много попыток, попробуйте позже")
+			if totpByAccount.Allow(strconv.FormatInt(id, 10)) {
+				err = m.VerifySecondFactor(r.Context(), id, r.FormValue("code"))
+			}
+			var u model.User
+			if err == nil {
+				u, err = m.GetUser(r.Context(), id)
+			}
+			if err == nil {
+				loginsTotal.Inc("success")
+				delete(session.Values, "pending_id")
+				delete(session.Values, "pending_at")
+				loginSession(session, u)
+				if err := session.Save(r, w); err != nil {
+					util.Errorf(r.Context(), "error saving session: %s\n", err)
+				}
+				http.Redirect(w, r, "/", 302)
+				return
+			}
+			loginsTotal.Inc("failure")
+			params.Error = err.Error()
+		}
+
+		s, err := loadTmpl("assets/templates/login_totp.html", params)
+		if err != nil {
+			util.Errorf(r.Context(), "error loading template: %s\n", err)
+			http.Error(w, err.Error(), 500)
+			return
+		}
+		fmt.Fprint(w, s)
+	}
+}
+
+// Подключение второго фактора, коды восстановления и отключение
+func TOTPHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type PageTOTP struct {
+			User          model.User
+			Required      bool
+			Secret        string   // ключ, ожидающий подтверждения
+			URI           string   // otpauth:// для QR-кода
+			RecoveryCodes []string // новые коды, показываются один раз
+			CodesLeft     int
+			Error         string
+			IsAdmin       bool
+		}
+		u := context.Get(r, "user").(model.User)
+		page := PageTOTP{User: u, Required: model.DefaultPasswordPolicy.TOTPRequired(u), IsAdmin: u.IsAdmin}
+
+		if r.Method == "POST" {
+			err := r.ParseForm()
+			if err != nil {
+				log.Println(err)
+			}
+			code := r.FormValue("Code")
+			switch r.FormValue("Action") {
+			case "begin":
+				_, _, err = m.BeginTOTPEnrolment(r.Context(), u)
+			case "confirm":
+				page.RecoveryCodes, err = m.ConfirmTOTP(r.Context(), u, code)
+			case "regenerate":
+				page.RecoveryCodes, err = m.RegenerateRecoveryCodes(r.Context(), u, code)
+			case "disable":
+				err = m.DisableTOTP(r.Context(), u, code)
+			default:
+				err = fmt.Errorf("неизвестное действие %q", r.FormValue("Action"))
+			}
+			if err != nil {
+				util.Errorf(r.Context(), "error TOTPHandler: %v", err)
+				page.Error = err.Error()
+			} else if page.RecoveryCodes == nil {
+				http.Redirect(w, r, "/profile/totp", 301)
+				return
+			}
+			// после подтверждения пользователь в контексте запроса еще без второго фактора
+			if u, err = m.GetUser(r.Context(), u.ID); err == nil {
+				page.User = u
+			}
+		}
+
+		if page.User.TOTPEnabled {
+			left, err := m.RecoveryCodesLeft(r.Context(), u.ID)
+			if err != nil {
+				fmt.Fprintf(w, "err: %s\n", err)
+				return
+			}
+			page.CodesLeft = left
+		} else {
+			totp, err := m.GetTOTP(r.Context(), u.ID)
+			if err != nil {
+				fmt.Fprintf(w, "err: %s\n", err)
+				return
+			}
+			if totp.Secret != "" {
+				page.Secret = totp.Secret
+				page.URI = util.TOTPURI(model.TOTPIssuer, u.Username, totp.Secret)
+			}
+		}
+
+		tmpl, err := template.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "totp.html"))
+		if err != nil {
+			util.Errorf(r.Context(), "error TOTPHandler: %v", err)
+			return
+		}
+		if err := tmpl.ExecuteTemplate(w, "layout", page); err != nil {
+			log.Println(err.Error())
+			http.Error(w, http.StatusText(500), 500)
+		}
+	}
+}
@@ -2,14 +2,14 @@ package ui
 
 import (
 	"bytes"
+	"crypto/rand"
+	"crypto/x509"
 	"fmt"
 	"html/template"
 	"log"
-	"net"
 	"net/http"
 	"path"
 
-	"encoding/base64"
 	"encoding/json"
 	"strconv"
 	"time"
@@ -20,40 +20,64 @@ import (
 	"github.com/gorilla/mux"
 	"github.com/gorilla/sessions"
 	"golang.org/x/crypto/bcrypt"
-
 	//"github.com/flosch/pongo2"
 	//"github.com/gorilla/securecookie"
-	"github.com/kabukky/httpscerts"
 )
 
 // Config is ...
 type Config struct {
-	Assets http.FileSystem
+	Assets    http.FileSystem `toml:"-"`
+	TrustedCA *x509.CertPool  `toml:"-"` // Доверенные корневые сертификаты для проверки подписей
+
+	SessionSecret string `toml:"session_secret"`  // Ключ подписи cookie сессии, пусто — случайный при запуске
+	SessionMaxAge int    `toml:"session_max_age"` // Время жизни сессии, секунды
+	PageSize      int    `toml:"page_size"`       // Приказов на странице по умолчанию
+	LinkLimit     int    `toml:"link_limit"`      // Ссылок на страницы в пагинации
+	// Предельное время обработки запроса, секунды, 0 — без ограничения.
+	// По истечении отменяются запросы к БД
+	RequestTimeout     int `toml:"request_timeout"`
+	LongRequestTimeout int `toml:"long_request_timeout"` // То же для выгрузки и загрузки реестра
+
+	Mail     util.MailConfig `toml:"-"`         // SMTP сервер для писем сброса пароля, из раздела [smtp]
+	BaseURL  string          `toml:"base_url"`  // Внешний адрес сервиса для ссылок в письмах, пусто — сброс по почте недоступен
+	ResetTTL int             `toml:"reset_ttl"` // Время действия ссылки сброса пароля, секунды
 }
 
 type Page struct {
-	Orders                         []model.Order
-	HBKindOfDoc                    []model.HBKindOfDoc
-	HBDocLabel                     []model.HBDocLabel
-	HBDocType                      []model.HBDocType
-	PaginationPages                []util.PaginationPage
-	Next, Previous                 int
-	NextIsActive, PreviousIsActive bool
-	IsAdmin                        bool
+	Orders          []model.Order
+	HBKindOfDoc     []model.HBKindOfDoc
+	HBDocLabel      []model.HBDocLabel
+	HBDocType       []model.HBDocType
+	PaginationPages []util.PaginationPage
+	Next, Previous  string            // курсоры соседних страниц, пусто — страницы нет
+	Columns         []model.Column    // столбцы списка
+	Visible         map[string]bool   // видимость столбцов по настройкам пользователя
+	Prefs           model.Preferences // настройки списков пользователя
+	IsAdmin         bool
 }
 
 var (
-	newSessionSecret = base64.StdEncoding.EncodeToString([]byte("session"))
-	store            = sessions.NewCookieStore([]byte(newSessionSecret), nil)
-	limit            = 7
-	linkLimit        = 5
-	start            = 0
+	store     *sessions.CookieStore
+	linkLimit = 5
+	router    *mux.Router // маршруты интерфейса, по ним Logger определяет шаблон пути для метрик
 )
 
-func initSession() {
+// initSession создает хранилище сессий с ключом из настроек. Без ключа генерируется
+// случайный: сессии не переживут перезапуск
+func initSession(cfg Config) {
+	secret := []byte(cfg.SessionSecret)
+	if len(secret) == 0 {
+		log.Printf("ui.session_secret is not set, using a random key: sessions are lost on restart")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatalf("error initSession: %v", err)
+		}
+	}
+	store = sessions.NewCookieStore(secret, nil)
+	resetKey = deriveResetKey(secret)
 	store.Options = &sessions.Options{
-		Path:     "/",      // to match all requests
-		MaxAge:   3600 * 1, // 1 час
+		Path:     "/", // to match all requests
+		MaxAge:   cfg.SessionMaxAge,
 		HttpOnly: true,
 	}
 }
@@ -83,7 +107,7 @@ func LoginHandler(config Config, m *model.Model) http.HandlerFunc {
 			params.Flashes = session.Flashes()
 			s, err := loadTmpl(loginTmpl, params)
 			if err != nil {
-				log.Printf("error loading template: %s\n", err)
+				util.Errorf(r.Context(), "error loading template: %s\n", err)
 				http.Error(w, err.Error(), 500)
 				return
 			}
@@ -100,13 +124,14 @@ func LoginHandler(config Config, m *model.Model) http.HandlerFunc {
 			username := r.Form["username"][0]
 			password := r.Form["password"][0]
 
-			u, err := m.GetUserByUsername(username)
+			u, err := m.GetUserByUsername(r.Context(), username)
 			if err != nil {
-				log.Printf("error: %s\n", err)
+				loginsTotal.Inc("failure")
+				util.Errorf(r.Context(), "error: %s\n", err)
 				session.AddFlash("err: " + err.Error())
 				err = session.Save(r, w)
 				if err != nil {
-					log.Printf("error saving session: %s\n", err)
+					util.Errorf(r.Context(), "error saving session: %s\n", err)
 				}
 				http.Redirect(w, r, "/login", 301)
 				return
@@ -114,21 +139,36 @@ func LoginHandler(config Config, m *model.Model) http.HandlerFunc {
 
 			err = bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 			if err != nil {
+				loginsTotal.Inc("failure")
 				session.AddFlash("err: " + err.Error())
 				err = session.Save(r, w)
 				if err != nil {
-					log.Printf("error saving session: %s\n", err)
+					util.Errorf(r.Context(), "error saving session: %s\n", err)
 				}
 
 				http.Redirect(w, r, "/login", 301)
 				return
 			}
 
-			session.Values["id"] = u.ID
-			session.Values["is_admin"] = u.IsAdmin
+			// с подключенным вторым фактором сессия пока только «наполовину» вошедшая:
+			// id появится после кода из приложения, см. LoginTOTPHandler
+			if u.TOTPEnabled {
+				delete(session.Values, "id")
+				session.Values["pending_id"] = u.ID
+				session.Values["pending_at"] = time.Now().Unix()
+				err = session.Save(r, w)
+				if err != nil {
+					util.Errorf(r.Context(), "error saving session: %s\n", err)
+				}
+				http.Redirect(w, r, "/login/totp", 302)
+				return
+			}
+
+			loginsTotal.Inc("success")
+			loginSession(session, u)
 			err = session.Save(r, w)
 			if err != nil {
-				log.Printf("error saving session: %s\n", err)
+				util.Errorf(r.Context(), "error saving session: %s\n", err)
 			}
 			http.Redirect(w, r, "/", 301)
 		}
@@ -138,13 +178,44 @@ func LoginHandler(config Config, m *model.Model) http.HandlerFunc {
 func LogoutHandler(config Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		session := context.Get(r, "session").(*sessions.Session)
-		delete(session.Values, "id")
+		logoutSession(session)
 		session.Save(r, w)
 		clearSession(w)
 		http.Redirect(w, r, "/login", 301)
 	}
 }
 
+// Загружаем файл из поля field формы в единице работы, пусто — файла в форме нет
+func uploadFormFile(r *http.Request, u *model.UnitOfWork, field string) (string, error) {
+	file, handler, err := r.FormFile(field)
+	if err != nil {
+		return "", nil
+	}
+	defer file.Close()
+	pathfile, err := u.Upload(file, handler)
+	if err != nil {
+		return "", fmt.Errorf("ошибка загрузки %s на сервер: %v", field, err)
+	}
+	return pathfile, nil
+}
+
+// Загружаем отсоединенную подпись оригинала, если она пришла с формой, и проверяем ее.
+// Неверная подпись сохраняется с причиной; ошибка — если подпись не удалось прочитать или сохранить
+func verifySignature(r *http.Request, config Config, u *model.UnitOfWork, order model.Order) error {
+	pathfile, err := uploadFormFile(r, u, "FileSignature")
+	if err != nil || pathfile == "" {
+		return err
+	}
+	signature, err := u.CheckSignature(order, pathfile, config.TrustedCA)
+	if err != nil {
+		return err
+	}
+	if !signature.Verified {
+		log.Printf("Подпись приказа %d не прошла проверку: %s", order.ID, signature.Error)
+	}
+	return u.SaveSignature(signature)
+}
+
 ///// MIDDLEWARE
 func Use(handler http.HandlerFunc, m *model.Model, mids ...func(http.Handler, *model.Model) http.HandlerFunc) http.HandlerFunc {
 	for _, mid := range mids {
@@ -153,22 +224,43 @@ func Use(handler http.HandlerFunc, m *model.Model, mids ...func(http.Handler, *m
 	return handler
 }
 
+// loginSession отмечает вход пользователя в сессии вместе со временем смены его пароля
+func loginSession(session *sessions.Session, u model.User) {
+	session.Values["id"] = u.ID
+	session.Values["is_admin"] = u.IsAdmin
+	session.Values["password_changed"] = u.PasswordChanged.UnixNano()
+}
+
+// logoutSession убирает из сессии отметку о входе
+func logoutSession(session *sessions.Session) {
+	delete(session.Values, "id")
+	delete(session.Values, "is_admin")
+	delete(session.Values, "password_changed")
+}
+
 func ContextManager(h http.Handler, m *model.Model) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		initSession()
 		session, err := store.Get(r, "session")
 		if err != nil {
-			log.Printf("ContextManager: err: %s\n", err)
+			util.Errorf(r.Context(), "error ContextManager: %v", err)
 			return
 		}
 		r = context.Set(r, "session", session)
 
 		if id, ok := session.Values["id"]; ok {
-			u, err := m.GetUser(id.(int64))
+			u, err := m.GetUser(r.Context(), id.(int64))
 			if err != nil {
 				r = context.Set(r, "user", nil)
+			} else if changed, _ := session.Values["password_changed"].(int64); changed != u.PasswordChanged.UnixNano() {
+				// пароль сменили после входа: сессия, открытая со старым паролем, больше не действует
+				logoutSession(session)
+				if err := session.Save(r, w); err != nil {
+					util.Errorf(r.Context(), "error saving session: %s\n", err)
+				}
+				r = context.Set(r, "user", nil)
 			} else {
 				r = context.Set(r, "user", u)
+				r = r.WithContext(util.WithLogFields(r.Context(), util.Fields{"user": u.Username}))
 			}
 		} else {
 			r = context.Set(r, "user", nil)
@@ -183,6 +275,16 @@ func ContextManager(h http.Handler, m *model.Model) http.HandlerFunc {
 func RequireLogin(h http.Handler, m *model.Model) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if u := context.Get(r, "user"); u != nil {
+			// пока пароль не сменен, доступен только профиль; выйти можно всегда
+			if model.PasswordChangeRequired(u.(model.User)) && r.URL.Path != "/profile" && r.URL.Path != "/logout" {
+				http.Redirect(w, r, "/profile", 302)
+				return
+			}
+			// второй фактор, обязательный для роли, подключается до начала работы
+			if model.TOTPEnrolmentRequired(u.(model.User)) && r.URL.Path != "/profile" && r.URL.Path != "/profile/totp" && r.URL.Path != "/logout" {
+				http.Redirect(w, r, "/profile/totp", 302)
+				return
+			}
 			h.ServeHTTP(w, r)
 		} else {
 			http.Redirect(w, r, "/login", 302)
@@ -211,6 +313,40 @@ func requireAdmin(h http.Handler, m *model.Model) http.HandlerFunc {
 }
 
 ///// HELPERS
+
+// ordersQuery собирает параметры страницы списка приказов из запроса и настроек пользователя:
+// ?cursor= для соседних страниц, ?page= для перехода по номеру, ?sort= меняет сортировку
+// (повторный выбор того же столбца меняет направление) и сохраняет ее в настройках.
+// Старые ссылки /orders/{смещение} ведут на страницу, содержащую это смещение
+func ordersQuery(r *http.Request, m *model.Model, u model.User) (model.OrdersQuery, model.Preferences, error) {
+	prefs, err := m.GetPreferences(r.Context(), u.ID)
+	if err != nil {
+		return model.OrdersQuery{}, prefs, err
+	}
+	if sortBy := r.FormValue("sort"); model.IsSortable(sortBy) {
+		if sortBy == prefs.SortBy {
+			prefs.SortDesc = !prefs.SortDesc
+		} else {
+			prefs.SortBy, prefs.SortDesc = sortBy, sortBy == model.ColumnRegDate
+		}
+		if err := m.SavePreferences(r.Context(), prefs); err != nil {
+			return model.OrdersQuery{}, prefs, err
+		}
+	}
+	q := model.OrdersQuery{Limit: prefs.PageSize, SortBy: prefs.SortBy, SortDesc: prefs.SortDesc}
+	cursor, err := util.ParseCursor(r.FormValue("cursor"))
+	if err != nil {
+		return q, prefs, err
+	}
+	q.Cursor = cursor
+	if page, err := strconv.Atoi(r.FormValue("page")); err == nil && page > 0 {
+		q.Page = page
+	} else if offset := intVar(mux.Vars(r), "id"); offset > 0 {
+		q.Page = int(offset)/q.Limit + 1
+	}
+	return q, prefs, nil
+}
+
 func loadTmpl(path string, data interface{}) (string, error) {
 	tmpl, err := template.ParseFiles(path)
 	if err != nil {
@@ -227,37 +363,139 @@ func loadTmpl(path string, data interface{}) (string, error) {
 	return buf.String(), err
 }
 
-func Logger(h http.Handler, m *model.Model) http.HandlerFunc {
+// RequestID назначает идентификатор запроса: из заголовка X-Request-ID прокси или новый.
+// Возвращается в ответе и попадает во все записи журнала по запросу, в том числе из pgDb
+func RequestID(h http.Handler, m *model.Model) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		//log.Printf("%s", r.URL)
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = util.NewRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		r = r.WithContext(util.WithLogFields(r.Context(), util.Fields{"request_id": id}))
 		h.ServeHTTP(w, r)
 	})
 }
 
+// validRequestID проверяет, что идентификатор из заголовка не длиннее 64 символов из букв, цифр, "-", "_" и "."
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// routeTemplate возвращает шаблон маршрута mux для запроса, "unmatched" — маршрута нет
+func routeTemplate(r *http.Request) string {
+	var match mux.RouteMatch
+	if router != nil && router.Match(r, &match) && match.Route != nil {
+		if tpl, err := match.Route.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return "unmatched"
+}
+
+// Logger пишет журнал и метрики запросов по шаблону маршрута mux, а не по пути,
+// чтобы идентификаторы в путях не плодили наборы меток
+func Logger(h http.Handler, m *model.Model) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeTemplate(r)
+		r = r.WithContext(util.WithLogFields(r.Context(), util.Fields{"route": route}))
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		h.ServeHTTP(rec, r)
+		duration := time.Since(start)
+		httpRequestDuration.Observe(duration.Seconds(), route, r.Method)
+		httpRequestsTotal.Inc(route, r.Method, strconv.Itoa(rec.status))
+
+		level := util.LevelInfo
+		if rec.status >= 500 {
+			level = util.LevelError
+		} else if rec.status >= 400 {
+			level = util.LevelWarn
+		}
+		util.Log(r.Context(), level, "request", util.Fields{
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"status":      rec.status,
+			"duration_ms": float64(duration.Microseconds()) / 1000,
+			"bytes":       rec.bytes,
+		})
+	})
+}
+
+// statPeriod возвращает период статистики из параметров запроса:
+// ?year=2019 либо ?start=2019-01-01&end=2019-06-30, по умолчанию текущий год.
+// Некорректные параметры и начало позже конца — ошибка, обработчик отвечает 400
+func statPeriod(r *http.Request) (util.StatMonth, error) {
+	sm := util.DateYearGenerate()
+	if s := r.FormValue("year"); s != "" {
+		year, err := strconv.Atoi(s)
+		if err != nil || year < 1 || year > 9999 {
+			return sm, fmt.Errorf("неверный год %q", s)
+		}
+		sm = util.DateYearRange(year)
+	}
+	if s := r.FormValue("start"); s != "" {
+		startDate, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return sm, fmt.Errorf("неверная дата начала %q", s)
+		}
+		sm.StartDate = startDate
+	}
+	if s := r.FormValue("end"); s != "" {
+		endDate, err := time.Parse("2006-01-02", s)
+		if err != nil {
+			return sm, fmt.Errorf("неверная дата окончания %q", s)
+		}
+		sm.EndDate = endDate
+	}
+	if sm.StartDate.After(sm.EndDate) {
+		return sm, fmt.Errorf("начало периода позже окончания")
+	}
+	return sm, nil
+}
+
 func indexHandler(config Config, m *model.Model) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		type PageIndex struct {
-			Output  []int
+			Stat    model.Statistics
 			IsAdmin bool
 		}
-		output := []int{}
-		sms := util.DateStatGenerate()
-		for _, sm := range sms {
-			count, err := m.GetCountDateOrders(sm.StartDate, sm.EndDate)
-			if err != nil {
-				log.Printf("{\"error\":%q}", err.Error())
-				return
-			}
-			output = append(output, count)
+		sm, err := statPeriod(r)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
 		}
-
-		tmpl, err := template.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "index.html"))
+		stat, err := m.GetStatistics(r.Context(), sm.StartDate, sm.EndDate)
+		if err != nil {
+			util.Errorf(r.Context(), "error indexHandler: %v", err)
+			http.Error(w, http.StatusText(500), 500)
+			return
+		}
+		// Передаем функцию в шаблон
+		funcMap := template.FuncMap{
+			// форматируем дату
+			"fdate": util.FormatDate,
+			// передаем в подшаблон заголовок и разрез статистики
+			"dict": func(title string, items []model.StatItem) map[string][]model.StatItem {
+				return map[string][]model.StatItem{title: items}
+			},
+		}
+		tmpl := template.New("index").Funcs(funcMap)
+		tmpl, err = tmpl.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "index.html"))
 		if err != nil {
-			log.Printf("{\"error\":%q}", err.Error())
+			util.Errorf(r.Context(), "error indexHandler: %v", err)
 			return
 		}
 		u := context.Get(r, "user")
-		page := PageIndex{Output: output, IsAdmin: u.(model.User).IsAdmin}
+		page := PageIndex{Stat: stat, IsAdmin: u.(model.User).IsAdmin}
 		if err := tmpl.ExecuteTemplate(w, "layout", page); err != nil {
 			log.Println(err.Error())
 			http.Error(w, http.StatusText(500), 500)
@@ -265,6 +503,31 @@ func indexHandler(config Config, m *model.Model) http.HandlerFunc {
 	}
 }
 
+// Статистика в формате JSON для графиков
+func StatsHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sm, err := statPeriod(r)
+		if err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+		stat, err := m.GetStatistics(r.Context(), sm.StartDate, sm.EndDate)
+		if err != nil {
+			util.Errorf(r.Context(), "error StatsHandler: %v", err)
+			http.Error(w, http.StatusText(500), 500)
+			return
+		}
+		a, err := json.Marshal(stat)
+		if err != nil {
+			log.Println("ERROR: " + err.Error())
+			http.Error(w, http.StatusText(500), 500)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(a)
+	}
+}
+
 func ListOrdersHandler(config Config, m *model.Model) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		u := context.Get(r, "user")
@@ -272,46 +535,32 @@ func ListOrdersHandler(config Config, m *model.Model) http.HandlerFunc {
 		funcMap := template.FuncMap{
 			// форматируем дату
 			"fdate": util.FormatDate,
+			// наименование состояния согласования
+			"status": statusTitle,
+			// ссылка на правку только там, где она разрешена
+			"canEdit": func(order model.Order) bool { return model.CanEditOrder(order, u.(model.User)) },
 		}
 		// Получим первую и последнюю дату текущего года
 		sm := util.DateYearGenerate()
-		//all, err := m.GetCountDateOrders(sm.StartDate, sm.EndDate)
-		all, err := m.GetCountDateOrdersByUsername(sm.StartDate, sm.EndDate, u.(model.User).Username)
+		q, prefs, err := ordersQuery(r, m, u.(model.User))
 		if err != nil {
-			log.Printf("{\"error\":%q}", err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		vars := mux.Vars(r)
-		id := int(intVar(vars, "id"))
-		if id != 0 {
-			start = id
-		}
-		paginationPages := util.Pagination(limit, all, linkLimit, start)
-
-		//orders, err := m.GetDateOrders(sm.StartDate, sm.EndDate, limit, start)
-		orders, err := m.GetDateUserByUsername(sm.StartDate, sm.EndDate, u.(model.User).Username, limit, start)
-
+		q.StartDate, q.EndDate = sm.StartDate, sm.EndDate
+		q.Username = u.(model.User).Username
+		orders, err := m.GetOrdersPage(r.Context(), q, linkLimit)
 		if err != nil {
-			log.Printf("{\"error\":%q}", err.Error())
+			util.Errorf(r.Context(), "error ListOrdersHandler: %v", err)
 			return
 		}
 
-		next := (start + limit)
-		previous := (start - limit)
-		previousIsActive := false
-		nextIsActive := false
-		if previous < 0 {
-			previousIsActive = true
-		}
-		if next >= all {
-			nextIsActive = true
-		}
-
-		page := Page{Orders: orders, PaginationPages: paginationPages, Next: next, Previous: previous, NextIsActive: nextIsActive, PreviousIsActive: previousIsActive, IsAdmin: u.(model.User).IsAdmin}
+		page := Page{Orders: orders.Orders, PaginationPages: orders.Pages, Next: orders.Next, Previous: orders.Previous,
+			Columns: model.OrderColumns, Visible: prefs.Visible(), Prefs: prefs, IsAdmin: u.(model.User).IsAdmin}
 		tmpl := template.New("orders").Funcs(funcMap)
-		tmpl, err = tmpl.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "orders.html"))
+		tmpl, err = tmpl.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "orders.html"), path.Join("assets/templates", "orders_columns.html"))
 		if err != nil {
-			log.Printf("{\"error\":%q}", err.Error())
+			util.Errorf(r.Context(), "error ListOrdersHandler: %v", err)
 			return
 		}
 		if err := tmpl.ExecuteTemplate(w, "layout", page); err != nil {
@@ -327,21 +576,18 @@ func ListArchiveOrdersHandler(config Config, m *model.Model) http.HandlerFunc {
 		// Получим первую и последнюю дату текущего года
 		sm := util.DateYearGenerate()
 		//log.Printf("%v %v", sm.StartDate, sm.EndDate)
-		all, err := m.GetCountDateOrders(sm.StartDate, sm.EndDate)
+		q, prefs, err := ordersQuery(r, m, u.(model.User))
 		if err != nil {
-			log.Printf("{\"error\":%q}", err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		vars := mux.Vars(r)
-		id := int(intVar(vars, "id"))
-		if id != 0 {
-			start = id
-		}
-		orders, err := m.GetDateOrders(sm.StartDate, sm.EndDate, limit, start)
+		q.StartDate, q.EndDate = sm.StartDate, sm.EndDate
+		ordersPage, err := m.GetOrdersPage(r.Context(), q, linkLimit)
 		if err != nil {
-			log.Printf("{\"error\":%q}", err.Error())
+			util.Errorf(r.Context(), "error ListArchiveOrdersHandler: %v", err)
 			return
 		}
+		orders := ordersPage.Orders
 		if r.Method == "POST" {
 			order := model.Order{}
 			r.ParseMultipartForm(32 << 20)
@@ -357,60 +603,56 @@ func ListArchiveOrdersHandler(config Config, m *model.Model) http.HandlerFunc {
 			order.Username = r.FormValue("Username")
 			startDate, err := time.Parse("2006-01-02", r.FormValue("StartDate"))
 			if err != nil {
-				log.Printf("{\"error\":%q}", err.Error())
+				util.Errorf(r.Context(), "error ListArchiveOrdersHandler: %v", err)
 				// если ничего не пришло то ставим дату этого года
 				startDate = sm.StartDate
 			}
 			endDate, err := time.Parse("2006-01-02", r.FormValue("EndDate"))
 			if err != nil {
-				log.Printf("{\"error\":%q}", err.Error())
+				util.Errorf(r.Context(), "error ListArchiveOrdersHandler: %v", err)
 				// если ничего не пришло то ставим дату этого года
 				endDate = sm.EndDate
 			}
-			orders, err = m.GetSearchOrders(order, startDate, endDate)
+			orders, err = m.GetSearchOrders(r.Context(), order, startDate, endDate)
 			if err != nil {
-				log.Printf("{\"error\":%q}", err.Error())
+				util.Errorf(r.Context(), "error ListArchiveOrdersHandler: %v", err)
 				return
 			}
-			all = 0
+			// результаты поиска выводятся одной страницей
+			model.SortOrders(orders, prefs)
+			ordersPage = model.OrdersPage{}
 			log.Println(order)
 		}
-		paginationPages := util.Pagination(limit, all, linkLimit, start)
-		next := (start + limit)
-		previous := (start - limit)
-		previousIsActive := false
-		nextIsActive := false
-		if previous <= 0 {
-			previousIsActive = true
-		}
-		if next >= all {
-			nextIsActive = true
-		}
-		hbtype, err := m.GetHBDocType()
+		hbtype, err := m.GetHBDocType(r.Context())
 		if err != nil {
 			fmt.Fprintf(w, "err: %s\n", err)
 			return
 		}
-		hbkind, err := m.GetHBKindOfDoc()
+		hbkind, err := m.GetHBKindOfDoc(r.Context())
 		if err != nil {
 			fmt.Fprintf(w, "err: %s\n", err)
 			return
 		}
-		hblabel, err := m.GetHBDocLabel()
+		hblabel, err := m.GetHBDocLabel(r.Context())
 		if err != nil {
 			fmt.Fprintf(w, "err: %s\n", err)
 			return
 		}
-		page := Page{Orders: orders, HBDocType: hbtype, HBKindOfDoc: hbkind, HBDocLabel: hblabel, PaginationPages: paginationPages, Next: next, Previous: previous, NextIsActive: nextIsActive, PreviousIsActive: previousIsActive, IsAdmin: u.(model.User).IsAdmin}
+		page := Page{Orders: orders, HBDocType: hbtype, HBKindOfDoc: hbkind, HBDocLabel: hblabel, PaginationPages: ordersPage.Pages, Next: ordersPage.Next, Previous: ordersPage.Previous,
+			Columns: model.OrderColumns, Visible: prefs.Visible(), Prefs: prefs, IsAdmin: u.(model.User).IsAdmin}
 		// Передаем функцию в шаблон
 		funcMap := template.FuncMap{
 			// форматируем дату
 			"fdate": util.FormatDate,
+			// наименование состояния согласования
+			"status": statusTitle,
+			// ссылка на правку только там, где она разрешена
+			"canEdit": func(order model.Order) bool { return model.CanEditOrder(order, u.(model.User)) },
 		}
 		tmpl := template.New("orders").Funcs(funcMap)
-		tmpl, err = tmpl.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "orders_archive.html"))
+		tmpl, err = tmpl.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "orders_archive.html"), path.Join("assets/templates", "orders_columns.html"))
 		if err != nil {
-			log.Printf("{\"error\":%q}", err.Error())
+			util.Errorf(r.Context(), "error ListArchiveOrdersHandler: %v", err)
 			return
 		}
 
@@ -424,16 +666,31 @@ func ListArchiveOrdersHandler(config Config, m *model.Model) http.HandlerFunc {
 func DetailedOrderHandler(config Config, m *model.Model) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		type PageDetailed struct {
-			Order   model.Order
-			IsAdmin bool
+			Order       model.Order
+			Signature   model.Signature
+			Transitions []model.Transition
+			History     []model.OrderTransition
+			IsAdmin     bool
 		}
 		var err error
 		vars := mux.Vars(r)
 		id := int64(intVar(vars, "id"))
 		order := model.Order{}
+		signature := model.Signature{}
+		history := []model.OrderTransition{}
 
 		if id != 0 {
-			order, err = m.GetOrder(id)
+			order, err = m.GetOrder(r.Context(), id)
+			if err != nil {
+				fmt.Fprintf(w, "err: %s\n", err)
+				return
+			}
+			history, err = m.GetOrderTransitions(r.Context(), id)
+			if err != nil {
+				fmt.Fprintf(w, "err: %s\n", err)
+				return
+			}
+			signature, err = m.GetSignature(r.Context(), id)
 			if err != nil {
 				fmt.Fprintf(w, "err: %s\n", err)
 				return
@@ -443,15 +700,17 @@ func DetailedOrderHandler(config Config, m *model.Model) http.HandlerFunc {
 		funcMap := template.FuncMap{
 			// форматируем дату
 			"fdate": util.FormatDate,
+			// наименование состояния согласования
+			"status": statusTitle,
 		}
 		tmpl := template.New("orders").Funcs(funcMap)
 		tmpl, err = tmpl.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "order_detailed.html"))
 		if err != nil {
-			log.Printf("{\"error\":%q}", err.Error())
+			util.Errorf(r.Context(), "error DetailedOrderHandler: %v", err)
 			return
 		}
-		u := context.Get(r, "user")
-		page := PageDetailed{Order: order, IsAdmin: u.(model.User).IsAdmin}
+		u := context.Get(r, "user").(model.User)
+		page := PageDetailed{Order: order, Signature: signature, Transitions: model.AllowedTransitions(order, u), History: history, IsAdmin: u.IsAdmin}
 		if err := tmpl.ExecuteTemplate(w, "layout", page); err != nil {
 			log.Println(err.Error())
 			http.Error(w, http.StatusText(500), 500)
@@ -479,62 +738,52 @@ func CreateOrderHandler(config Config, m *model.Model) http.HandlerFunc {
 			order.DocType = r.FormValue("DocType")
 			order.KindOfDoc = r.FormValue("KindOfDoc")
 			order.DocLabel = r.FormValue("DocLabel")
-			if RegDate, err := time.Parse("2006-01-02", r.FormValue("RegDate")); err != nil {
-				log.Println("err: %s\n", err)
-			} else {
-				order.RegDate = RegDate
-			}
-			order.RegNumber = r.FormValue("RegNumber")
+			// Новый приказ создается проектом: номер и дата регистрации
+			// присваиваются после согласования и подписи
+			order.Status = model.StatusDraft
+			order.RegDate = time.Now()
 			order.Description = r.FormValue("Description")
 			order.Username = u.(model.User).Username
 
-			if fileOriginal, handlerOriginal, err := r.FormFile("FileOriginal"); err != nil {
-				log.Println("Ошибка загрузки Оригинала: ", err)
-			} else {
-				if pathfile, err := util.UploadFile(fileOriginal, handlerOriginal); err != nil {
-					log.Println("Ошибка загрузки Оригинала на сервер: ", err)
-					return
-				} else {
-					order.FileOriginal = pathfile
-				}
-
-				defer fileOriginal.Close()
-			}
-
-			if fileCopy, handlerCopy, err := r.FormFile("FileCopy"); err != nil {
-				log.Println("Ошибка загрузки Копии: ", err)
-			} else {
-				if pathfile, err := util.UploadFile(fileCopy, handlerCopy); err != nil {
-					log.Println("Ошибка загрузки Копии на сервер: ", err)
-					return
-				} else {
-					order.FileCopy = pathfile
-				}
-				defer fileCopy.Close()
-			}
-
 			if b := r.FormValue("Current"); b == "on" {
 				order.Current = true
 			} else {
 				order.Current = false
 			}
 			log.Println(order)
-			if err = m.CreateOrder(order); err != nil {
+			// Файлы, приказ, запись журнала и подпись сохраняются вместе:
+			// при ошибке загруженные файлы удаляются
+			err = m.Do(r.Context(), func(uow *model.UnitOfWork) error {
+				var err error
+				if order.FileOriginal, err = uploadFormFile(r, uow, "FileOriginal"); err != nil {
+					return err
+				}
+				if order.FileCopy, err = uploadFormFile(r, uow, "FileCopy"); err != nil {
+					return err
+				}
+				if order.ID, err = uow.CreateOrder(order); err != nil {
+					return err
+				}
+				return verifySignature(r, config, uow, order)
+			})
+			if err != nil {
+				util.Errorf(r.Context(), "error CreateOrderHandler: %v", err)
 				fmt.Fprintf(w, "err: %s\n", err)
+				return
 			}
 			http.Redirect(w, r, "/orders", 301)
 		}
-		hbtype, err := m.GetHBDocType()
+		hbtype, err := m.GetHBDocType(r.Context())
 		if err != nil {
 			fmt.Fprintf(w, "err: %s\n", err)
 			return
 		}
-		hbkind, err := m.GetHBKindOfDoc()
+		hbkind, err := m.GetHBKindOfDoc(r.Context())
 		if err != nil {
 			fmt.Fprintf(w, "err: %s\n", err)
 			return
 		}
-		hblabel, err := m.GetHBDocLabel()
+		hblabel, err := m.GetHBDocLabel(r.Context())
 		if err != nil {
 			fmt.Fprintf(w, "err: %s\n", err)
 			return
@@ -542,7 +791,7 @@ func CreateOrderHandler(config Config, m *model.Model) http.HandlerFunc {
 
 		tmpl, err := template.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "orders_create.html"))
 		if err != nil {
-			log.Printf("{\"error\":%q}", err.Error())
+			util.Errorf(r.Context(), "error CreateOrderHandler: %v", err)
 			return
 		}
 		pageCreateOrder := PageCreateOrder{HBDocType: hbtype, HBKindOfDoc: hbkind, HBDocLabel: hblabel, IsAdmin: u.(model.User).IsAdmin}
@@ -568,55 +817,37 @@ func EditOrderHandler(config Config, m *model.Model) http.HandlerFunc {
 		order := model.Order{}
 
 		if id != 0 {
-			order, err = m.GetOrder(id)
+			order, err = m.GetOrder(r.Context(), id)
 			if err != nil {
 				fmt.Fprintf(w, "err: %s\n", err)
 				return
 			}
 		}
+		if !model.CanEditOrder(order, context.Get(r, "user").(model.User)) {
+			http.Error(w, fmt.Sprintf("приказ в состоянии %q нельзя изменить", statusTitle(order.Status)), http.StatusForbidden)
+			return
+		}
 
 		if r.Method == "POST" {
 			err := r.ParseForm()
 			if err != nil {
 				log.Println(err)
 			}
-			order.DocType = r.FormValue("docType")
-			order.KindOfDoc = r.FormValue("kindOfDoc")
-			order.DocLabel = r.FormValue("docLabel")
+			order.DocType = r.FormValue("DocType")
+			order.KindOfDoc = r.FormValue("KindOfDoc")
+			order.DocLabel = r.FormValue("DocLabel")
 			//fmt.Println("RegDate: %v\n", r.FormValue("RegDate"))
-			if RegDate, err := time.Parse("2006-01-02", r.FormValue("RegDate")); err != nil {
-				fmt.Fprintf(w, "err: %s\n", err)
-			} else {
-				order.RegDate = RegDate
-			}
-			order.RegNumber = r.FormValue("RegNumber")
-			order.Description = r.FormValue("Description")
-			//order.Username = u.(model.User).Username
-
-			if fileOriginal, handlerOriginal, err := r.FormFile("FileOriginal"); err != nil {
-				log.Println("Ошибка загрузки Оригинала: ", err)
-			} else {
-				if pathfile, err := util.UploadFile(fileOriginal, handlerOriginal); err != nil {
-					log.Println("Ошибка загрузки Оригинала на сервер: ", err)
-					return
+			// Номер и дата регистрации есть только у зарегистрированного приказа
+			if order.Status == model.StatusRegistered {
+				if RegDate, err := time.Parse("2006-01-02", r.FormValue("RegDate")); err != nil {
+					fmt.Fprintf(w, "err: %s\n", err)
 				} else {
-					order.FileOriginal = pathfile
+					order.RegDate = RegDate
 				}
-
-				defer fileOriginal.Close()
-			}
-
-			if fileCopy, handlerCopy, err := r.FormFile("FileCopy"); err != nil {
-				log.Println("Ошибка загрузки Копии: ", err)
-			} else {
-				if pathfile, err := util.UploadFile(fileCopy, handlerCopy); err != nil {
-					log.Println("Ошибка загрузки Копии на сервер: ", err)
-					return
-				} else {
-					order.FileCopy = pathfile
-				}
-				defer fileCopy.Close()
+				order.RegNumber = r.FormValue("RegNumber")
 			}
+			order.Description = r.FormValue("Description")
+			//order.Username = u.(model.User).Username
 
 			if b := r.FormValue("Current"); b == "on" {
 				order.Current = true
@@ -624,8 +855,36 @@ func EditOrderHandler(config Config, m *model.Model) http.HandlerFunc {
 				order.Current = false
 			}
 			//log.Println(order)
-			if err = m.UpdateOrder(order); err != nil {
+			editor := context.Get(r, "user").(model.User).Username
+			err = m.Do(r.Context(), func(u *model.UnitOfWork) error {
+				// приказ мог уйти на согласование, пока открыта форма
+				if current, err := u.GetOrder(order.ID); err != nil {
+					return err
+				} else if current.Status != order.Status {
+					return fmt.Errorf("приказ уже в состоянии %q, изменения не сохранены", statusTitle(current.Status))
+				}
+				// новый файл заменяет сохраненный, если его загрузили
+				for field, target := range map[string]*string{"FileOriginal": &order.FileOriginal, "FileCopy": &order.FileCopy} {
+					pathfile, err := uploadFormFile(r, u, field)
+					if err != nil {
+						return err
+					}
+					if pathfile != "" {
+						*target = pathfile
+					}
+				}
+				if err := u.UpdateOrder(order); err != nil {
+					return err
+				}
+				if err := u.Audit(model.OrderTransition{OrderID: order.ID, From: order.Status, To: order.Status, Username: editor, Comment: model.AuditUpdated}); err != nil {
+					return err
+				}
+				return verifySignature(r, config, u, order)
+			})
+			if err != nil {
+				util.Errorf(r.Context(), "error EditOrderHandler: %v", err)
 				fmt.Fprintf(w, "err: %s\n", err)
+				return
 			}
 			http.Redirect(w, r, "/orders", 301)
 		}
@@ -634,17 +893,17 @@ func EditOrderHandler(config Config, m *model.Model) http.HandlerFunc {
 			// форматируем дату
 			"fdate": util.FormatDate,
 		}
-		hbtype, err := m.GetHBDocType()
+		hbtype, err := m.GetHBDocType(r.Context())
 		if err != nil {
 			fmt.Fprintf(w, "err: %s\n", err)
 			return
 		}
-		hbkind, err := m.GetHBKindOfDoc()
+		hbkind, err := m.GetHBKindOfDoc(r.Context())
 		if err != nil {
 			fmt.Fprintf(w, "err: %s\n", err)
 			return
 		}
-		hblabel, err := m.GetHBDocLabel()
+		hblabel, err := m.GetHBDocLabel(r.Context())
 		if err != nil {
 			fmt.Fprintf(w, "err: %s\n", err)
 			return
@@ -652,7 +911,7 @@ func EditOrderHandler(config Config, m *model.Model) http.HandlerFunc {
 		tmpl := template.New("orders").Funcs(funcMap)
 		tmpl, err = tmpl.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "orders_edit.html"))
 		if err != nil {
-			log.Printf("{\"error\":%q}", err.Error())
+			util.Errorf(r.Context(), "error EditOrderHandler: %v", err)
 			return
 		}
 		u := context.Get(r, "user")
@@ -671,13 +930,13 @@ func DeleteOrderHandler(config Config, m *model.Model) http.HandlerFunc {
 		id := int64(intVar(vars, "id"))
 
 		if id != 0 {
-			_, err := m.GetOrder(id)
+			_, err := m.GetOrder(r.Context(), id)
 			if err != nil {
 				fmt.Fprintf(w, "err: %s\n", err)
 				return
 			}
 		}
-		err = m.DeleteOrder(id)
+		err = m.DeleteOrder(r.Context(), id)
 		if err != nil {
 			fmt.Fprintf(w, "err: %s", err)
 			return
@@ -692,7 +951,7 @@ func ListUsersHandler(config Config, m *model.Model) http.HandlerFunc {
 			Users   []model.User
 			IsAdmin bool
 		}
-		users, err := m.GetUsers()
+		users, err := m.GetUsers(r.Context())
 		if err != nil {
 			log.Printf("err: %+v\n", err.Error())
 			return
@@ -701,11 +960,13 @@ func ListUsersHandler(config Config, m *model.Model) http.HandlerFunc {
 		funcMap := template.FuncMap{
 			// форматируем дату
 			"fdate": util.FormatDate,
+			// наименование роли
+			"role": func(role string) string { return model.RoleTitles[role] },
 		}
 		tmpl := template.New("users").Funcs(funcMap)
 		tmpl, err = tmpl.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "users.html"))
 		if err != nil {
-			log.Printf("{\"error\":%q}", err.Error())
+			util.Errorf(r.Context(), "error ListUsersHandler: %v", err)
 			return
 		}
 		u := context.Get(r, "user")
@@ -716,6 +977,12 @@ func ListUsersHandler(config Config, m *model.Model) http.HandlerFunc {
 		}
 	}
 }
+
+// наименование состояния согласования для шаблонов
+func statusTitle(status string) string {
+	return model.StatusTitles[status]
+}
+
 func intVar(vars map[string]string, k string) int64 {
 	var vv int64
 	if v, ok := vars[k]; ok {
@@ -729,6 +996,7 @@ func EditUserHandler(config Config, m *model.Model) http.HandlerFunc {
 		type PageEditUser struct {
 			User         model.User
 			Departaments []model.Departament
+			Roles        map[string]string
 			IsAdmin      bool
 		}
 		var err error
@@ -737,7 +1005,7 @@ func EditUserHandler(config Config, m *model.Model) http.HandlerFunc {
 		user := model.User{}
 
 		if id != 0 {
-			user, err = m.GetUser(id)
+			user, err = m.GetUser(r.Context(), id)
 			if err != nil {
 				fmt.Fprintf(w, "err: %s\n", err)
 				return
@@ -746,14 +1014,34 @@ func EditUserHandler(config Config, m *model.Model) http.HandlerFunc {
 
 		if r.Method == "POST" {
 			r.ParseForm()
-			user.Username = r.Form["username"][0]
-			user.Email = r.Form["email"][0]
+			user.Username = r.FormValue("username")
+			user.Email = r.FormValue("email")
+			user.Title = r.FormValue("Title")
+			user.Role = r.FormValue("Role")
 
-			err = m.UpdateUser(user)
+			err = m.UpdateUser(r.Context(), user)
 			if err != nil {
 				fmt.Fprintf(w, "err: %s\n", err)
+				return
+			}
+			if r.FormValue("ResetTOTP") == "on" && user.TOTPEnabled {
+				if err := m.ResetTOTP(r.Context(), user.ID); err != nil {
+					fmt.Fprintf(w, "err: %s\n", err)
+					return
+				}
+			}
+			// временный пароль всегда требует смены при входе, иначе — по флажку
+			if password := r.FormValue("Password"); password != "" {
+				err = m.ResetPassword(r.Context(), user.ID, password)
+			} else if mustChange := r.FormValue("MustChangePassword") == "on"; mustChange != user.MustChangePassword {
+				err = m.SetPasswordChangeRequired(r.Context(), user.ID, mustChange)
+			}
+			if err != nil {
+				fmt.Fprintf(w, "err: %s\n", err)
+				return
 			}
 			http.Redirect(w, r, "/users", 301)
+			return
 
 		}
 		// Передаем функцию в шаблон
@@ -761,17 +1049,17 @@ func EditUserHandler(config Config, m *model.Model) http.HandlerFunc {
 			// форматируем дату
 			"fdate": util.FormatDate,
 		}
-		departaments, err := m.GetDepartaments()
+		departaments, err := m.GetDepartaments(r.Context())
 		if err != nil {
 			fmt.Fprintf(w, "err: %s\n", err)
 			return
 		}
 		u := context.Get(r, "user")
-		pageEditUser := PageEditUser{User: user, Departaments: departaments, IsAdmin: u.(model.User).IsAdmin}
+		pageEditUser := PageEditUser{User: user, Departaments: departaments, Roles: model.RoleTitles, IsAdmin: u.(model.User).IsAdmin}
 		tmpl := template.New("orders").Funcs(funcMap)
 		tmpl, err = tmpl.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "users_edit.html"))
 		if err != nil {
-			log.Printf("{\"error\":%q}", err.Error())
+			util.Errorf(r.Context(), "error EditUserHandler: %v", err)
 			return
 		}
 		if err := tmpl.ExecuteTemplate(w, "layout", pageEditUser); err != nil {
@@ -788,13 +1076,13 @@ func DeleteUserHandler(config Config, m *model.Model) http.HandlerFunc {
 		id := int64(intVar(vars, "id"))
 
 		if id != 0 {
-			_, err := m.GetUser(id)
+			_, err := m.GetUser(r.Context(), id)
 			if err != nil {
 				fmt.Fprintf(w, "err: %s\n", err)
 				return
 			}
 		}
-		err = m.DeleteUser(id)
+		err = m.DeleteUser(r.Context(), id)
 		if err != nil {
 			fmt.Fprintf(w, "err: %s", err)
 			return
@@ -804,58 +1092,99 @@ func DeleteUserHandler(config Config, m *model.Model) http.HandlerFunc {
 	}
 }
 
-// Автозаполнение
-func Select2Handler(config Config, m *model.Model) http.HandlerFunc {
+// Автозаполнение для select2: GET /autocomplete/{source}?term=...&page=N,
+// ответ в формате {"results": [{"id", "text"}], "pagination": {"more"}}
+func AutocompleteHandler(config Config, m *model.Model) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-
-		decoder := json.NewDecoder(r.Body)
-		query := struct {
-			Term      string `json:"term"`
-			TypeQuery string `json:"_type"`
-		}{}
-
-		if err := decoder.Decode(&query); err != nil {
-			log.Println("ERROR: " + err.Error())
-			return
+		type result struct {
+			ID   string `json:"id"`
+			Text string `json:"text"`
+		}
+		type pagination struct {
+			More bool `json:"more"`
 		}
-		hbtype, err := m.Get2HBDocType(query.Term)
+		page, _ := strconv.Atoi(r.FormValue("page"))
+		found, err := m.Autocomplete(r.Context(), mux.Vars(r)["source"], r.FormValue("term"), page)
 		if err != nil {
-			fmt.Fprintf(w, "err: %s\n", err)
+			util.Errorf(r.Context(), "error AutocompleteHandler: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		//var data = map[int]string{1: "приказ", 2: "распоряжение", 3: "постановление"}
-		// создаем json и отдаем обратно клиенту AJAX
-		a, err := json.Marshal(hbtype)
-		if err != nil {
+		response := struct {
+			Results    []result   `json:"results"`
+			Pagination pagination `json:"pagination"`
+		}{Results: []result{}, Pagination: pagination{More: found.More}}
+		for _, item := range found.Items {
+			response.Results = append(response.Results, result{ID: item, Text: item})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(response); err != nil {
 			log.Println("ERROR: " + err.Error())
 		}
-
-		w.Write(a)
 	}
 }
 
-// Start is ...
-func Start(cfg Config, m *model.Model, listener net.Listener) {
-	router := mux.NewRouter()
+// Start готовит сессии и маршруты интерфейса.
+// Обслуживает запросы сервер демона, см. daemon.Run
+func Start(cfg Config, m *model.Model) http.Handler {
+	initSession(cfg)
+	linkLimit = cfg.LinkLimit
+	requestTimeout = time.Duration(cfg.RequestTimeout) * time.Second
+	longRequestTimeout = time.Duration(cfg.LongRequestTimeout) * time.Second
+	router = mux.NewRouter()
 
 	router.HandleFunc("/", Use(indexHandler(cfg, m), m, RequireLogin))
+	router.HandleFunc("/stats", Use(StatsHandler(cfg, m), m, RequireLogin))
 	router.HandleFunc("/login", LoginHandler(cfg, m))
+	router.HandleFunc("/login/totp", LoginTOTPHandler(cfg, m))
+	router.HandleFunc("/password/forgot", ForgotPasswordHandler(cfg, m))
+	router.HandleFunc("/password/reset", ResetPasswordHandler(cfg, m))
 	router.HandleFunc("/logout", Use(LogoutHandler(cfg), m, RequireLogin))
 
 	router.HandleFunc("/users", Use(ListUsersHandler(cfg, m), m, RequireLogin, requireAdmin))
 	router.HandleFunc("/users/edit/{id:[0-9]+}", Use(EditUserHandler(cfg, m), m, RequireLogin, requireAdmin))
 	router.HandleFunc("/users/edit/{id:[0-9]+}/delete", Use(DeleteUserHandler(cfg, m), m, RequireLogin, requireAdmin))
 
+	router.HandleFunc("/notifications", Use(NotificationsHandler(cfg, m), m, RequireLogin))
+	router.HandleFunc("/notifications/count", Use(CountNotificationsHandler(cfg, m), m, RequireLogin))
+	router.HandleFunc("/profile", Use(ProfileHandler(cfg, m), m, RequireLogin))
+	router.HandleFunc("/profile/totp", Use(TOTPHandler(cfg, m), m, RequireLogin))
+	router.HandleFunc("/preferences", Use(PreferencesHandler(cfg, m), m, RequireLogin))
+	router.HandleFunc("/subscriptions", Use(SubscriptionsHandler(cfg, m), m, RequireLogin))
+	router.HandleFunc("/subscriptions/{id:[0-9]+}/delete", Use(DeleteSubscriptionHandler(cfg, m), m, RequireLogin))
+
+	router.HandleFunc("/schedules", Use(ListSchedulesHandler(cfg, m), m, RequireLogin, requireAdmin))
+	router.HandleFunc("/schedules/{id:[0-9]+}/delete", Use(DeleteScheduleHandler(cfg, m), m, RequireLogin, requireAdmin))
+
+	router.HandleFunc("/webhooks", Use(WebhooksHandler(cfg, m), m, RequireLogin, requireAdmin))
+	router.HandleFunc("/webhooks/{id:[0-9]+}/delete", Use(DeleteWebhookHandler(cfg, m), m, RequireLogin, requireAdmin))
+	router.HandleFunc("/webhooks/deliveries", Use(WebhookDeliveriesHandler(cfg, m), m, RequireLogin, requireAdmin))
+	router.HandleFunc("/webhooks/deliveries/{id:[0-9]+}/retry", Use(RetryDeliveryHandler(cfg, m), m, RequireLogin, requireAdmin))
+
+	router.HandleFunc("/retention", Use(RetentionHandler(cfg, m), m, RequireLogin, requireAdmin))
+	router.HandleFunc("/handbooks", Use(HandbooksHandler(cfg, m), m, RequireLogin, requireAdmin))
+	router.HandleFunc("/handbooks/{handbook}", Use(HandbooksHandler(cfg, m), m, RequireLogin, requireAdmin))
+	router.HandleFunc("/departaments", Use(DepartamentsHandler(cfg, m), m, RequireLogin, requireAdmin))
+	router.HandleFunc("/departaments/edit/{id:[0-9]+}", Use(EditDepartamentHandler(cfg, m), m, RequireLogin, requireAdmin))
+	router.HandleFunc("/disposal", Use(ListDisposalActsHandler(cfg, m), m, RequireLogin))
+	router.HandleFunc("/disposal/{id:[0-9]+}", Use(DisposalActHandler(cfg, m), m, RequireLogin))
+
+	router.HandleFunc("/archive", Use(ArchiveHandler(cfg, m), m, RequireLogin, requireAdmin))
+	router.HandleFunc("/archive/export", Use(ExportArchiveHandler(cfg, m), m, RequireLogin, requireAdmin))
+
 	router.HandleFunc("/orders", Use(ListOrdersHandler(cfg, m), m, RequireLogin))
 	router.HandleFunc("/orders/{id:[0-9]+}", Use(ListOrdersHandler(cfg, m), m, RequireLogin))
 	router.HandleFunc("/orders/order/{id:[0-9]+}", Use(DetailedOrderHandler(cfg, m), m, RequireLogin))
+	router.HandleFunc("/orders/order/{id:[0-9]+}/transition", Use(TransitOrderHandler(cfg, m), m, RequireLogin))
+	router.HandleFunc("/orders/queue", Use(QueueOrdersHandler(cfg, m), m, RequireLogin))
 	router.HandleFunc("/orders/archive", Use(ListArchiveOrdersHandler(cfg, m), m, RequireLogin))
 	router.HandleFunc("/orders/archive/{id:[0-9]+}", Use(ListArchiveOrdersHandler(cfg, m), m, RequireLogin))
+	router.HandleFunc("/orders/import", Use(ImportOrdersHandler(cfg, m), m, RequireLogin, requireAdmin))
 	router.HandleFunc("/orders/create", Use(CreateOrderHandler(cfg, m), m, RequireLogin))
 	router.HandleFunc("/orders/edit/{id:[0-9]+}", Use(EditOrderHandler(cfg, m), m, RequireLogin))
 	router.HandleFunc("/orders/edit/{id:[0-9]+}/delete", Use(DeleteOrderHandler(cfg, m), m, RequireLogin, requireAdmin))
 
-	router.HandleFunc("/select2", Use(Select2Handler(cfg, m), m, RequireLogin))
+	router.HandleFunc("/autocomplete/{source}", Use(AutocompleteHandler(cfg, m), m, RequireLogin))
 
 	router.PathPrefix("/css/").Handler(
 		http.StripPrefix("/css/", http.FileServer(http.Dir("assets/css"))))
@@ -866,22 +1195,7 @@ func Start(cfg Config, m *model.Model, listener net.Listener) {
 	router.PathPrefix("/templates/").Handler(
 		http.StripPrefix("/templates/", http.FileServer(http.Dir("assets/templates"))))
 	router.PathPrefix("/orders/order/upload/").Handler(
-		http.StripPrefix("/orders/order/upload/", http.FileServer(http.Dir("./upload"))))
-
-	h := Use(router.ServeHTTP, m, Logger, ContextManager)
-
-	// Проверяем, доступен ли cert файл.
-	err := httpscerts.Check("cert.pem", "key.pem")
-	// Если он недоступен, то генерируем новый.
-	if err != nil {
-		err = httpscerts.Generate("cert.pem", "key.pem", "127.0.0.1:3000")
-		// http.Serve(autocert.NewListener("example.com"), nil)
-		if err != nil {
-			log.Fatal("Ошибка: Не можем сгенерировать https сертификат.")
-		}
-	}
-	// func ServeTLS(l net.Listener, handler Handler, certFile, keyFile string) error
-	go http.ServeTLS(listener, h, "cert.pem", "key.pem")
+		http.StripPrefix("/orders/order/upload/", http.FileServer(http.Dir(util.UploadDir))))
 
-	//go http.Serve(listener, h)
+	return Use(router.ServeHTTP, m, Logger, ContextManager, Timeout, RequestID)
 }
@@ -0,0 +1,147 @@
+package ui
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+
+	"../context"
+	"../model"
+	"../util"
+	"github.com/gorilla/mux"
+)
+
+// Вебхуки для внешних систем (бухгалтерия, кадры)
+func WebhooksHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type PageWebhooks struct {
+			Webhooks    []model.Webhook
+			HBKindOfDoc []model.HBKindOfDoc
+			Events      []model.EventType
+			IsAdmin     bool
+		}
+
+		if r.Method == "POST" {
+			err := r.ParseForm()
+			if err != nil {
+				log.Println(err)
+			}
+			webhook := model.Webhook{
+				Title:     r.FormValue("Title"),
+				URL:       r.FormValue("URL"),
+				Secret:    r.FormValue("Secret"),
+				Events:    strings.Join(r.Form["Events"], ","),
+				KindOfDoc: r.FormValue("KindOfDoc"),
+				Active:    r.FormValue("Active") == "on",
+			}
+			// Если ключ не задан, генерируем случайный
+			if webhook.Secret == "" {
+				b := make([]byte, 32)
+				if _, err := rand.Read(b); err != nil {
+					fmt.Fprintf(w, "err: %s\n", err)
+					return
+				}
+				webhook.Secret = hex.EncodeToString(b)
+			}
+			if err := m.CreateWebhook(r.Context(), webhook); err != nil {
+				fmt.Fprintf(w, "err: %s\n", err)
+				return
+			}
+			http.Redirect(w, r, "/webhooks", 301)
+			return
+		}
+
+		webhooks, err := m.GetWebhooks(r.Context())
+		if err != nil {
+			fmt.Fprintf(w, "err: %s\n", err)
+			return
+		}
+		hbkind, err := m.GetHBKindOfDoc(r.Context())
+		if err != nil {
+			fmt.Fprintf(w, "err: %s\n", err)
+			return
+		}
+		tmpl, err := template.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "webhooks.html"))
+		if err != nil {
+			util.Errorf(r.Context(), "error WebhooksHandler: %v", err)
+			return
+		}
+		u := context.Get(r, "user")
+		page := PageWebhooks{
+			Webhooks:    webhooks,
+			HBKindOfDoc: hbkind,
+			Events:      []model.EventType{model.OrderCreated, model.OrderUpdated, model.OrderCancelled, model.UserCreated},
+			IsAdmin:     u.(model.User).IsAdmin,
+		}
+		if err := tmpl.ExecuteTemplate(w, "layout", page); err != nil {
+			log.Println(err.Error())
+			http.Error(w, http.StatusText(500), 500)
+		}
+	}
+}
+
+func DeleteWebhookHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id := int64(intVar(vars, "id"))
+
+		if err := m.DeleteWebhook(r.Context(), id); err != nil {
+			fmt.Fprintf(w, "err: %s", err)
+			return
+		}
+		http.Redirect(w, r, "/webhooks", 301)
+	}
+}
+
+// Журнал доставок вебхуков, ?status=dead — очередь недоставленных
+func WebhookDeliveriesHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type PageDeliveries struct {
+			Deliveries []model.Delivery
+			Status     string
+			IsAdmin    bool
+		}
+		status := r.FormValue("status")
+		deliveries, err := m.GetDeliveries(r.Context(), status, 200)
+		if err != nil {
+			fmt.Fprintf(w, "err: %s\n", err)
+			return
+		}
+		// Передаем функцию в шаблон
+		funcMap := template.FuncMap{
+			// форматируем дату
+			"fdate": util.FormatDate,
+		}
+		tmpl := template.New("deliveries").Funcs(funcMap)
+		tmpl, err = tmpl.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "webhook_deliveries.html"))
+		if err != nil {
+			util.Errorf(r.Context(), "error WebhookDeliveriesHandler: %v", err)
+			return
+		}
+		u := context.Get(r, "user")
+		page := PageDeliveries{Deliveries: deliveries, Status: status, IsAdmin: u.(model.User).IsAdmin}
+		if err := tmpl.ExecuteTemplate(w, "layout", page); err != nil {
+			log.Println(err.Error())
+			http.Error(w, http.StatusText(500), 500)
+		}
+	}
+}
+
+// Повторная отправка недоставленного события
+func RetryDeliveryHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id := int64(intVar(vars, "id"))
+
+		if err := m.RetryDelivery(r.Context(), id); err != nil {
+			fmt.Fprintf(w, "err: %s", err)
+			return
+		}
+		http.Redirect(w, r, "/webhooks/deliveries?status="+model.DeliveryDead, 301)
+	}
+}
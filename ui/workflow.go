@@ -0,0 +1,70 @@
+package ui
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path"
+
+	"../context"
+	"../model"
+	"../util"
+	"github.com/gorilla/mux"
+)
+
+// Переход приказа в следующее состояние согласования с комментарием
+func TransitOrderHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		id := int64(intVar(vars, "id"))
+		if r.Method != "POST" {
+			http.Redirect(w, r, fmt.Sprintf("/orders/order/%d", id), 302)
+			return
+		}
+		err := r.ParseForm()
+		if err != nil {
+			log.Println(err)
+		}
+		u := context.Get(r, "user").(model.User)
+		if err := m.TransitOrder(r.Context(), id, r.FormValue("To"), u, r.FormValue("Comment")); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/orders/order/%d", id), 301)
+	}
+}
+
+// Приказы, ожидающие действия текущего пользователя
+func QueueOrdersHandler(config Config, m *model.Model) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		type PageQueue struct {
+			Orders  []model.Order
+			IsAdmin bool
+		}
+		u := context.Get(r, "user").(model.User)
+		orders, err := m.GetAwaitingOrders(r.Context(), u)
+		if err != nil {
+			fmt.Fprintf(w, "err: %s\n", err)
+			return
+		}
+		// Передаем функцию в шаблон
+		funcMap := template.FuncMap{
+			// форматируем дату
+			"fdate": util.FormatDate,
+			// наименование состояния согласования
+			"status": statusTitle,
+		}
+		tmpl := template.New("queue").Funcs(funcMap)
+		tmpl, err = tmpl.ParseFiles(path.Join("assets/templates", "layout.html"), path.Join("assets/templates", "orders_queue.html"))
+		if err != nil {
+			util.Errorf(r.Context(), "error QueueOrdersHandler: %v", err)
+			return
+		}
+		page := PageQueue{Orders: orders, IsAdmin: u.IsAdmin}
+		if err := tmpl.ExecuteTemplate(w, "layout", page); err != nil {
+			log.Println(err.Error())
+			http.Error(w, http.StatusText(500), 500)
+		}
+	}
+}
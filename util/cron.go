@@ -0,0 +1,121 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSpec — разобранное расписание в формате cron: "минута час день месяц день_недели"
+type CronSpec struct {
+	minute, hour, dom, month, dow map[int]bool
+	// если заданы и день месяца, и день недели, достаточно совпадения одного из них
+	domAny, dowAny bool
+}
+
+type cronField struct {
+	min, max int
+}
+
+var cronFields = []cronField{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+
+// ParseCron разбирает строку расписания. Поддерживаются "*", списки "1,15",
+// диапазоны "1-5" и шаги "*/10"
+func ParseCron(spec string) (*CronSpec, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("cron: ожидается 5 полей, получено %d: %q", len(parts), spec)
+	}
+	sets := make([]map[int]bool, len(parts))
+	for i, part := range parts {
+		set, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron: поле %d %q: %v", i+1, part, err)
+		}
+		sets[i] = set
+	}
+	return &CronSpec{minute: sets[0], hour: sets[1], dom: sets[2], month: sets[3], dow: sets[4],
+		domAny: parts[2] == "*", dowAny: parts[4] == "*"}, nil
+}
+
+func parseCronField(field string, f cronField) (map[int]bool, error) {
+	set := make(map[int]bool)
+	for _, item := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("неверный шаг %q", item[i+1:])
+			}
+			step = n
+			item = item[:i]
+		}
+		lo, hi := f.min, f.max
+		if item != "*" {
+			bounds := strings.SplitN(item, "-", 2)
+			n, err := strconv.Atoi(bounds[0])
+			if err != nil {
+				return nil, fmt.Errorf("неверное значение %q", bounds[0])
+			}
+			lo, hi = n, n
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("неверное значение %q", bounds[1])
+				}
+			} else if step > 1 {
+				hi = f.max
+			}
+		}
+		// воскресенье допускается и как 7
+		if f.max == 6 && hi == 7 {
+			set[0] = true
+			if lo == 7 {
+				continue
+			}
+			hi = 6
+		}
+		if lo < f.min || hi > f.max || lo > hi {
+			return nil, fmt.Errorf("значение вне диапазона %d-%d", f.min, f.max)
+		}
+		for v := lo; v <= hi; v += step {
+			set[v] = true
+		}
+	}
+	return set, nil
+}
+
+// Next возвращает ближайшее время срабатывания строго после t
+func (c *CronSpec) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// расписание повторяется не реже, чем раз в несколько лет
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !c.month[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.hour[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.minute[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (c *CronSpec) matchDay(t time.Time) bool {
+	dom, dow := c.dom[t.Day()], c.dow[int(t.Weekday())]
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,160 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Журнал в формате JSON, одна запись на строку:
+//
+//	{"time":"...","level":"error","msg":"error GetOrder: ...","request_id":"...","user":"ivanov"}
+//
+// Поля запроса (request_id, user, route) хранятся в context.Context и попадают
+// во все записи, сделанные с этим контекстом, в том числе из методов pgDb
+
+// Уровни журнала
+const (
+	LevelDebug = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// Fields — дополнительные поля записи журнала
+type Fields map[string]interface{}
+
+var (
+	logMu    sync.Mutex
+	logOut   = os.Stderr
+	logLevel = LevelInfo
+)
+
+// ParseLogLevel возвращает уровень журнала по имени: debug, info, warn, error
+func ParseLogLevel(name string) (int, error) {
+	for level, n := range levelNames {
+		if n == name {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", name)
+}
+
+// SetupLog включает журнал JSON с уровнем level. Записи пакета log
+// (log.Printf) тоже выводятся в JSON: уровень error, если сообщение начинается с "error"
+func SetupLog(level string) error {
+	l, err := ParseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	logMu.Lock()
+	logLevel = l
+	logMu.Unlock()
+	log.SetFlags(0)
+	log.SetOutput(stdLogWriter{})
+	return nil
+}
+
+type logFieldsKey struct{}
+
+// WithLogFields возвращает контекст, все записи журнала с которым содержат поля fields
+func WithLogFields(ctx context.Context, fields Fields) context.Context {
+	merged := Fields{}
+	for k, v := range logFields(ctx) {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, logFieldsKey{}, merged)
+}
+
+func logFields(ctx context.Context) Fields {
+	if ctx == nil {
+		return nil
+	}
+	fields, _ := ctx.Value(logFieldsKey{}).(Fields)
+	return fields
+}
+
+// NewRequestID создает случайный идентификатор запроса
+func NewRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// RequestID возвращает идентификатор запроса из контекста, пусто — вне запроса
+func RequestID(ctx context.Context) string {
+	id, _ := logFields(ctx)["request_id"].(string)
+	return id
+}
+
+// Log пишет запись журнала с полями контекста и fields
+func Log(ctx context.Context, level int, msg string, fields Fields) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	if level < logLevel {
+		return
+	}
+	entry := map[string]interface{}{}
+	for k, v := range logFields(ctx) {
+		entry[k] = v
+	}
+	for k, v := range fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		entry[k] = v
+	}
+	entry["time"] = time.Now().Format(time.RFC3339Nano)
+	entry["level"] = levelNames[level]
+	entry["msg"] = strings.TrimRight(msg, "\n")
+	data, err := json.Marshal(entry)
+	if err != nil {
+		data, _ = json.Marshal(map[string]string{"level": "error", "msg": msg, "log_error": err.Error()})
+	}
+	logOut.Write(append(data, '\n'))
+}
+
+func Debugf(ctx context.Context, format string, args ...interface{}) {
+	Log(ctx, LevelDebug, fmt.Sprintf(format, args...), nil)
+}
+
+func Infof(ctx context.Context, format string, args ...interface{}) {
+	Log(ctx, LevelInfo, fmt.Sprintf(format, args...), nil)
+}
+
+func Warnf(ctx context.Context, format string, args ...interface{}) {
+	Log(ctx, LevelWarn, fmt.Sprintf(format, args...), nil)
+}
+
+func Errorf(ctx context.Context, format string, args ...interface{}) {
+	Log(ctx, LevelError, fmt.Sprintf(format, args...), nil)
+}
+
+// stdLogWriter переводит строки пакета log в записи JSON без контекста
+type stdLogWriter struct{}
+
+func (stdLogWriter) Write(p []byte) (int, error) {
+	msg := string(bytes.TrimRight(p, "\n"))
+	level := LevelInfo
+	lower := strings.ToLower(msg)
+	if strings.HasPrefix(lower, "error") || strings.Contains(lower, " err:") || strings.HasPrefix(lower, `{"error"`) {
+		level = LevelError
+	}
+	Log(context.Background(), level, msg, nil)
+	return len(p), nil
+}
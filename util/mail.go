@@ -0,0 +1,122 @@
+package util
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// MailConfig — параметры SMTP сервера
+type MailConfig struct {
+	Addr     string `toml:"addr"` // host:port
+	From     string `toml:"from"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+}
+
+// Attachment — вложение письма
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// SendMail отправляет письмо с HTML телом и вложениями
+func SendMail(cfg MailConfig, to []string, subject, htmlBody string, attachments ...Attachment) error {
+	if cfg.Addr == "" {
+		return fmt.Errorf("SendMail: не задан адрес SMTP сервера")
+	}
+	msg, err := buildMessage(cfg.From, to, subject, htmlBody, attachments)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if cfg.Username != "" {
+		host, _, err := net.SplitHostPort(cfg.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", cfg.Username, cfg.Password, host)
+	}
+	return smtp.SendMail(cfg.Addr, auth, cfg.From, to, msg)
+}
+
+// SendMailRetry повторяет отправку attempts раз, удваивая паузу между попытками.
+// Отмена ctx прерывает ожидание очередной попытки
+func SendMailRetry(ctx context.Context, cfg MailConfig, attempts int, delay time.Duration, to []string, subject, htmlBody string, attachments ...Attachment) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = SendMail(cfg, to, subject, htmlBody, attachments...); err == nil {
+			return nil
+		}
+		if i < attempts-1 {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+	}
+	return err
+}
+
+func buildMessage(from string, to []string, subject, htmlBody string, attachments []Attachment) ([]byte, error) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", w.Boundary())
+
+	part, err := w.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/html; charset=utf-8"},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	writeBase64(part, []byte(htmlBody))
+
+	for _, a := range attachments {
+		contentType := a.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {contentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})},
+		})
+		if err != nil {
+			return nil, err
+		}
+		writeBase64(part, a.Data)
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// writeBase64 пишет данные в base64 строками по 76 символов
+func writeBase64(w io.Writer, data []byte) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		w.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	w.Write([]byte(encoded + "\r\n"))
+}
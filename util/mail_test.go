@@ -0,0 +1,88 @@
+package util
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"./smtptest"
+)
+
+func newMailServer(t *testing.T) (*smtptest.Server, MailConfig) {
+	t.Helper()
+	srv, err := smtptest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	return srv, MailConfig{Addr: srv.Addr, From: "orders@example.org"}
+}
+
+func TestSendMail(t *testing.T) {
+	srv, cfg := newMailServer(t)
+	err := SendMail(cfg, []string{"head@example.org", "deputy@example.org"}, "Отчет", "<p>тело</p>",
+		Attachment{Filename: "orders.csv", ContentType: "text/csv", Data: []byte("a;b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := srv.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("получено писем: %d, ожидалось 1", len(messages))
+	}
+	msg := messages[0]
+	if msg.From != cfg.From || strings.Join(msg.To, ",") != "head@example.org,deputy@example.org" {
+		t.Errorf("конверт: from %q, to %v", msg.From, msg.To)
+	}
+	for _, want := range []string{"Subject: =?utf-8?b?", `filename=orders.csv`, "Content-Type: text/html; charset=utf-8"} {
+		if !strings.Contains(msg.Data, want) {
+			t.Errorf("в письме нет %q:\n%s", want, msg.Data)
+		}
+	}
+}
+
+func TestSendMailNoServer(t *testing.T) {
+	if err := SendMail(MailConfig{}, []string{"a@example.org"}, "s", "b"); err == nil {
+		t.Error("без адреса сервера ожидалась ошибка")
+	}
+}
+
+func TestSendMailRetry(t *testing.T) {
+	srv, cfg := newMailServer(t)
+	srv.Fail(2)
+	err := SendMailRetry(context.Background(), cfg, 3, time.Millisecond, []string{"a@example.org"}, "s", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(srv.Messages()); n != 1 {
+		t.Errorf("получено писем: %d, ожидалось 1", n)
+	}
+}
+
+func TestSendMailRetryGivesUp(t *testing.T) {
+	srv, cfg := newMailServer(t)
+	srv.Fail(3)
+	if err := SendMailRetry(context.Background(), cfg, 2, time.Millisecond, []string{"a@example.org"}, "s", "b"); err == nil {
+		t.Error("ожидалась ошибка после исчерпания попыток")
+	}
+	if n := len(srv.Messages()); n != 0 {
+		t.Errorf("получено писем: %d, ожидалось 0", n)
+	}
+}
+
+func TestSendMailRetryCancel(t *testing.T) {
+	srv, cfg := newMailServer(t)
+	srv.Fail(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	if err := SendMailRetry(ctx, cfg, 3, time.Hour, []string{"a@example.org"}, "s", "b"); err == nil {
+		t.Error("ожидалась ошибка")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("отмена не прервала ожидание повтора: %s", d)
+	}
+}
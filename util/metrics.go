@@ -0,0 +1,250 @@
+package util
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Метрики в текстовом формате Prometheus (version 0.0.4): счетчики, показатели и гистограммы
+// с метками. Значения показателей, которые дорого держать актуальными (статистика пула
+// соединений, количество приказов), заполняются функциями OnCollect перед каждой выгрузкой
+
+// MetricsContentType — Content-Type ответа /metrics
+const MetricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets — границы гистограмм длительности по умолчанию, секунды
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics — реестр метрик программы
+var Metrics = NewRegistry()
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// Registry — набор метрик с общей выгрузкой
+type Registry struct {
+	mu       sync.Mutex
+	metrics  []metric
+	names    map[string]bool
+	collects []func()
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+func (reg *Registry) add(name string, m metric) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.names[name] {
+		panic("util: duplicate metric " + name)
+	}
+	reg.names[name] = true
+	reg.metrics = append(reg.metrics, m)
+}
+
+// OnCollect добавляет функцию, обновляющую показатели перед выгрузкой
+func (reg *Registry) OnCollect(fn func()) {
+	reg.mu.Lock()
+	reg.collects = append(reg.collects, fn)
+	reg.mu.Unlock()
+}
+
+// Export выгружает все метрики в текстовом формате
+func (reg *Registry) Export(w io.Writer) error {
+	reg.mu.Lock()
+	collects := append([]func(){}, reg.collects...)
+	metrics := append([]metric{}, reg.metrics...)
+	reg.mu.Unlock()
+	for _, fn := range collects {
+		fn()
+	}
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// vec — значения одной метрики по наборам значений меток
+type vec struct {
+	name, help, kind string
+	labels           []string
+
+	mu     sync.Mutex
+	series map[string][]string // ключ → значения меток
+}
+
+func (v *vec) key(values []string) string {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("util: metric %s expects %d labels, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	if _, ok := v.series[key]; !ok {
+		v.series[key] = append([]string{}, values...)
+	}
+	return key
+}
+
+// sortedKeys возвращает ключи в порядке значений меток, чтобы выгрузка была стабильной
+func (v *vec) sortedKeys() []string {
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (v *vec) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, v.kind)
+}
+
+// labelString собирает метки в виде {a="1",b="2"} с дополнительной меткой extra (le для гистограмм)
+func (v *vec) labelString(values []string, extra ...string) string {
+	pairs := []string{}
+	for i, label := range v.labels {
+		pairs = append(pairs, label+`="`+escapeLabel(values[i])+`"`)
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+escapeLabel(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Value возвращает значение счетчика или показателя
+type Value struct {
+	vec
+	values map[string]float64
+}
+
+// NewCounter создает монотонно растущий счетчик
+func (reg *Registry) NewCounter(name, help string, labels ...string) *Value {
+	v := &Value{vec: vec{name: name, help: help, kind: "counter", labels: labels, series: map[string][]string{}}, values: map[string]float64{}}
+	reg.add(name, v)
+	return v
+}
+
+// NewGauge создает показатель, который может расти и уменьшаться
+func (reg *Registry) NewGauge(name, help string, labels ...string) *Value {
+	v := &Value{vec: vec{name: name, help: help, kind: "gauge", labels: labels, series: map[string][]string{}}, values: map[string]float64{}}
+	reg.add(name, v)
+	return v
+}
+
+func (v *Value) Inc(labels ...string) {
+	v.Add(1, labels...)
+}
+
+func (v *Value) Add(delta float64, labels ...string) {
+	v.mu.Lock()
+	v.values[v.key(labels)] += delta
+	v.mu.Unlock()
+}
+
+// Set задает значение показателя
+func (v *Value) Set(value float64, labels ...string) {
+	v.mu.Lock()
+	v.values[v.key(labels)] = value
+	v.mu.Unlock()
+}
+
+// Reset удаляет все наборы меток, например перед заполнением показателя заново
+func (v *Value) Reset() {
+	v.mu.Lock()
+	v.series = map[string][]string{}
+	v.values = map[string]float64{}
+	v.mu.Unlock()
+}
+
+func (v *Value) write(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.header(w)
+	for _, key := range v.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", v.name, v.labelString(v.series[key]), formatFloat(v.values[key]))
+	}
+}
+
+// Histogram — распределение значений по интервалам
+type Histogram struct {
+	vec
+	buckets []float64
+	counts  map[string][]uint64 // накопительно по границам buckets
+	sums    map[string]float64
+	totals  map[string]uint64
+}
+
+// NewHistogram создает гистограмму с границами buckets по возрастанию
+func (reg *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{
+		vec:     vec{name: name, help: help, kind: "histogram", labels: labels, series: map[string][]string{}},
+		buckets: buckets,
+		counts:  map[string][]uint64{},
+		sums:    map[string]float64{},
+		totals:  map[string]uint64{},
+	}
+	reg.add(name, h)
+	return h
+}
+
+func (h *Histogram) Observe(value float64, labels ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := h.key(labels)
+	counts, ok := h.counts[key]
+	if !ok {
+		counts = make([]uint64, len(h.buckets))
+		h.counts[key] = counts
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			counts[i]++
+		}
+	}
+	h.sums[key] += value
+	h.totals[key]++
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w)
+	for _, key := range h.sortedKeys() {
+		values := h.series[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(values, "le", formatFloat(bound)), h.counts[key][i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(values, "le", "+Inf"), h.totals[key])
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelString(values), formatFloat(h.sums[key]))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelString(values), h.totals[key])
+	}
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
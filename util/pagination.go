@@ -1,105 +1,102 @@
 package util
 
 import (
-	"math"
-	"reflect"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
 )
 
 type PaginationPage struct {
-	PageNum, Ofset int
-	Active         string
+	PageNum int
+	Active  string
 }
 
-func ArrayChunk(s []int, size int) [][]int {
-	if size < 1 {
-		panic("size: cannot be less than 1")
-	}
-	length := len(s)
-	chunks := int(math.Ceil(float64(length) / float64(size)))
-	var n [][]int
-	for i, end := 0, 0; chunks > 0; chunks-- {
-		end = (i + 1) * size
-		if end > length {
-			end = length
-		}
-		n = append(n, s[i*size:end])
-		i++
-	}
-	return n
+// Cursor — позиция в отсортированном списке приказов: значение столбца сортировки
+// и идентификатор граничной строки. Страница строится от последней (или первой, если Before)
+// строки соседней страницы, поэтому не зависит от количества предыдущих строк и от соседних запросов
+type Cursor struct {
+	Sort   string // Сортировка, для которой построен курсор
+	Key    string // Значение столбца сортировки граничной строки
+	ID     int64  // Идентификатор граничной строки
+	Page   int    // Номер страницы, на которую ведет курсор, начиная с 1
+	Before bool   // Страница перед граничной строкой (назад), иначе после нее
 }
 
-func in_array(val interface{}, array interface{}) (exists bool, index int) {
-	exists = false
-	index = -1
-
-	switch reflect.TypeOf(array).Kind() {
-	case reflect.Slice:
-		s := reflect.ValueOf(array)
-
-		for i := 0; i < s.Len(); i++ {
-			if reflect.DeepEqual(val, s.Index(i).Interface()) == true {
-				index = i
-				exists = true
-				return
-			}
-		}
-	}
-
-	return
+// IsZero сообщает, что курсор не задан
+func (c Cursor) IsZero() bool {
+	return c.ID == 0
 }
 
-// pagesList - массив с чанками
-// needPage - Здесь это наш GET - параметр (START)
-// Вернёт int - индекс нужного чанка:
-func searchPage(pagesList [][]int, needPage int) int {
-	for chunk, pages := range pagesList {
-		if ok, _ := in_array(needPage, pages); ok {
-			return chunk
-		}
+// Token возвращает представление курсора для URL
+func (c Cursor) Token() string {
+	if c.IsZero() {
+		return ""
 	}
-	return 0
+	dir := "a"
+	if c.Before {
+		dir = "b"
+	}
+	s := fmt.Sprintf("%d|%s|%s|%d|%s", c.Page, dir, c.Sort, c.ID, c.Key)
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
 }
 
-func Pagination(limit, all, linkLimit, start int) []PaginationPage {
-
-	pages := math.Ceil(float64(all) / float64(limit)) // кол-во страниц
-	var pagesArr []int
-
-	// Заполняем массив: ключ - это номер страницы, значение - это смещение для БД.
-	// Нумерация здесь нужна с единицы, а смещение с шагом = кол-ву материалов на странице.
-	for i := 0; i < int(pages); i++ {
-		pagesArr = append(pagesArr, i*int(limit))
+// ParseCursor разбирает курсор из URL; пустая строка — начало списка
+func ParseCursor(token string) (Cursor, error) {
+	c := Cursor{}
+	if token == "" {
+		return c, nil
 	}
-	// Теперь что бы на странице отображать нужное кол-во ссылок
-	// дробим массив на чанки:
-	allPages := ArrayChunk(pagesArr, linkLimit)
-
-	//fmt.Printf("%#v\n", allPages)
-	// получаем от клиента текущую страницу и передаем в поиск текущего блока ссылок
-	needChunk := searchPage(allPages, start)
-	//fmt.Printf("needChunk %#v\n", needChunk)
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, fmt.Errorf("неверный курсор: %v", err)
+	}
+	// значение столбца последним: в нем может встретиться разделитель
+	parts := strings.SplitN(string(data), "|", 5)
+	if len(parts) != 5 || (parts[1] != "a" && parts[1] != "b") {
+		return c, fmt.Errorf("неверный курсор")
+	}
+	if c.Page, err = strconv.Atoi(parts[0]); err != nil || c.Page < 1 {
+		return c, fmt.Errorf("неверный курсор")
+	}
+	if c.ID, err = strconv.ParseInt(parts[3], 10, 64); err != nil || c.ID < 1 {
+		return c, fmt.Errorf("неверный курсор")
+	}
+	c.Before = parts[1] == "b"
+	c.Sort = parts[2]
+	c.Key = parts[4]
+	return c, nil
+}
 
+// Pagination возвращает номера страниц в окне из linkLimit ссылок вокруг текущей страницы page (с 1).
+// Вычисляется за O(linkLimit) независимо от общего количества строк all
+func Pagination(limit, all, linkLimit, page int) []PaginationPage {
 	paginationPages := []PaginationPage{}
-	// Собственно выводим ссылки из нужного чанка
-	if len(allPages) > 0 {
-		for pageNum, ofset := range allPages[needChunk] {
-			paginationPage := PaginationPage{}
-
-			// Делаем текущую страницу не активной (т.е. не ссылкой):
-			if ofset == start {
-				paginationPage.PageNum = ((pageNum + 1) + (linkLimit * needChunk))
-				paginationPage.Ofset = ofset
-				paginationPage.Active = "disabled"
-				paginationPages = append(paginationPages, paginationPage)
-				continue
-			}
-			paginationPage.PageNum = ((pageNum + 1) + (linkLimit * needChunk))
-			paginationPage.Ofset = ofset
-			paginationPage.Active = ""
-			paginationPages = append(paginationPages, paginationPage)
-
-		}
+	if limit < 1 || linkLimit < 1 || all <= 0 {
 		return paginationPages
 	}
+	pages := (all + limit - 1) / limit // кол-во страниц
+	if page < 1 {
+		page = 1
+	}
+	if page > pages {
+		page = pages
+	}
+	// текущая страница по возможности в середине окна
+	first := page - linkLimit/2
+	if first+linkLimit-1 > pages {
+		first = pages - linkLimit + 1
+	}
+	if first < 1 {
+		first = 1
+	}
+	for num := first; num < first+linkLimit && num <= pages; num++ {
+		paginationPage := PaginationPage{PageNum: num}
+		// Делаем текущую страницу не активной (т.е. не ссылкой):
+		if num == page {
+			paginationPage.Active = "disabled"
+		}
+		paginationPages = append(paginationPages, paginationPage)
+	}
 	return paginationPages
 }
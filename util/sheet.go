@@ -0,0 +1,232 @@
+package util
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ReadSheet читает первую таблицу из CSV или ODS файла в виде строк с ячейками.
+// Формат определяется по расширению имени файла
+func ReadSheet(name string, r io.Reader) ([][]string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv", ".txt":
+		return readCSV(data)
+	case ".ods":
+		return readODS(data)
+	}
+	return nil, fmt.Errorf("неподдерживаемый формат файла %q, ожидается CSV или ODS", name)
+}
+
+// readCSV читает CSV с разделителем ";" (выгрузка из табличных редакторов) или ","
+func readCSV(data []byte) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	line := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		line = data[:i]
+	}
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	if bytes.Count(line, []byte(";")) > bytes.Count(line, []byte(",")) {
+		r.Comma = ';'
+	}
+	return r.ReadAll()
+}
+
+// максимальное количество повторов пустых строк и ячеек, которые разворачиваются при чтении ODS
+const odsMaxRepeat = 1000
+
+// readODS читает content.xml документа OpenDocument Spreadsheet
+func readODS(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	var content *zip.File
+	for _, f := range zr.File {
+		if f.Name == "content.xml" {
+			content = f
+		}
+	}
+	if content == nil {
+		return nil, fmt.Errorf("в файле ODS нет content.xml")
+	}
+	rc, err := content.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	var (
+		rows       [][]string
+		row        []string
+		cell       strings.Builder
+		cellValue  string
+		cellRepeat int
+		rowRepeat  int
+		inCell     bool
+		paragraphs int
+	)
+	d := xml.NewDecoder(rc)
+read:
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "table-row":
+				row = nil
+				rowRepeat = odsRepeat(t, "number-rows-repeated")
+			case "table-cell", "covered-table-cell":
+				inCell = true
+				paragraphs = 0
+				cell.Reset()
+				cellValue = ""
+				cellRepeat = odsRepeat(t, "number-columns-repeated")
+				for _, a := range t.Attr {
+					if a.Name.Local == "date-value" && len(a.Value) >= 10 {
+						cellValue = a.Value[:10]
+					}
+				}
+			case "p":
+				if inCell && paragraphs > 0 {
+					cell.WriteString("\n")
+				}
+				paragraphs++
+			case "s":
+				// сжатые пробелы
+				if inCell {
+					cell.WriteString(strings.Repeat(" ", odsRepeat(t, "c")))
+				}
+			}
+		case xml.CharData:
+			if inCell {
+				cell.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "table-cell", "covered-table-cell":
+				inCell = false
+				value := cellValue
+				if value == "" {
+					value = cell.String()
+				}
+				if value == "" && cellRepeat > odsMaxRepeat {
+					cellRepeat = 1
+				}
+				for i := 0; i < cellRepeat; i++ {
+					row = append(row, value)
+				}
+			case "table-row":
+				row = trimRow(row)
+				if len(row) == 0 {
+					// пустые строки оставляем, чтобы номера строк в отчете совпадали с таблицей
+					if rowRepeat > odsMaxRepeat {
+						continue
+					}
+				}
+				for i := 0; i < rowRepeat; i++ {
+					rows = append(rows, row)
+				}
+			case "table":
+				// читаем только первый лист
+				break read
+			}
+		}
+	}
+	// хвостовые пустые строки не нужны
+	for len(rows) > 0 && len(rows[len(rows)-1]) == 0 {
+		rows = rows[:len(rows)-1]
+	}
+	return rows, nil
+}
+
+func odsRepeat(t xml.StartElement, attr string) int {
+	for _, a := range t.Attr {
+		if a.Name.Local == attr {
+			if n, err := strconv.Atoi(a.Value); err == nil && n > 0 {
+				return n
+			}
+		}
+	}
+	return 1
+}
+
+// trimRow отбрасывает пустые ячейки в конце строки
+func trimRow(row []string) []string {
+	for len(row) > 0 && strings.TrimSpace(row[len(row)-1]) == "" {
+		row = row[:len(row)-1]
+	}
+	return row
+}
+
+const odsMimetype = "application/vnd.oasis.opendocument.spreadsheet"
+
+const odsManifest = `<?xml version="1.0" encoding="UTF-8"?>
+<manifest:manifest xmlns:manifest="urn:oasis:names:tc:opendocument:xmlns:manifest:1.0" manifest:version="1.2">
+ <manifest:file-entry manifest:full-path="/" manifest:media-type="` + odsMimetype + `"/>
+ <manifest:file-entry manifest:full-path="content.xml" manifest:media-type="text/xml"/>
+</manifest:manifest>
+`
+
+// WriteODS записывает строки одним листом sheet в документ OpenDocument Spreadsheet.
+// Все ячейки текстовые
+func WriteODS(sheet string, rows [][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	// mimetype должен идти первым и без сжатия
+	w, err := zw.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return nil, err
+	}
+	io.WriteString(w, odsMimetype)
+	if w, err = zw.Create("META-INF/manifest.xml"); err != nil {
+		return nil, err
+	}
+	io.WriteString(w, odsManifest)
+	if w, err = zw.Create("content.xml"); err != nil {
+		return nil, err
+	}
+	io.WriteString(w, `<?xml version="1.0" encoding="UTF-8"?>
+<office:document-content xmlns:office="urn:oasis:names:tc:opendocument:xmlns:office:1.0" xmlns:table="urn:oasis:names:tc:opendocument:xmlns:table:1.0" xmlns:text="urn:oasis:names:tc:opendocument:xmlns:text:1.0" office:version="1.2"><office:body><office:spreadsheet>`)
+	fmt.Fprintf(w, `<table:table table:name="%s">`, xmlEscape(sheet))
+	for _, row := range rows {
+		io.WriteString(w, "<table:table-row>")
+		for _, cell := range row {
+			io.WriteString(w, `<table:table-cell office:value-type="string">`)
+			for _, line := range strings.Split(cell, "\n") {
+				fmt.Fprintf(w, "<text:p>%s</text:p>", xmlEscape(line))
+			}
+			io.WriteString(w, "</table:table-cell>")
+		}
+		io.WriteString(w, "</table:table-row>")
+	}
+	io.WriteString(w, `</table:table></office:spreadsheet></office:body></office:document-content>`)
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
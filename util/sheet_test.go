@@ -0,0 +1,26 @@
+package util
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestWriteODS(t *testing.T) {
+	rows := [][]string{
+		{"Статус", "Описание"},
+		{"Новый", "О порядке <работы> & отчетах"},
+		{"Утратил силу", "первая строка\nвторая строка"},
+	}
+	data, err := WriteODS("Приказы", rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadSheet("orders.ods", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, rows) {
+		t.Errorf("прочитано %q, ожидалось %q", got, rows)
+	}
+}
@@ -0,0 +1,86 @@
+package util
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.mozilla.org/pkcs7"
+)
+
+// SignatureInfo — сведения о подписанте из CMS/PKCS#7 подписи
+type SignatureInfo struct {
+	Subject     string    // Владелец сертификата
+	Serial      string    // Серийный номер сертификата
+	SigningTime time.Time // Время подписи (атрибут signingTime)
+}
+
+// LoadCertPool загружает доверенные корневые сертификаты из PEM файла
+// либо из всех *.pem, *.crt, *.cer файлов каталога
+func LoadCertPool(path string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	files := []string{path}
+	if info.IsDir() {
+		files = nil
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			switch strings.ToLower(filepath.Ext(e.Name())) {
+			case ".pem", ".crt", ".cer":
+				files = append(files, filepath.Join(path, e.Name()))
+			}
+		}
+	}
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("LoadCertPool: в файле %s нет сертификатов", f)
+		}
+	}
+	return pool, nil
+}
+
+// VerifyDetachedSignature проверяет отсоединенную подпись sig над content и цепочку
+// сертификата подписанта до доверенных корней. Сведения о подписанте возвращаются,
+// даже если проверка не прошла
+func VerifyDetachedSignature(content, sig []byte, roots *x509.CertPool) (SignatureInfo, error) {
+	info := SignatureInfo{}
+	// Подпись может быть как в DER, так и в PEM
+	if block, _ := pem.Decode(sig); block != nil {
+		sig = block.Bytes
+	}
+	p7, err := pkcs7.Parse(sig)
+	if err != nil {
+		return info, fmt.Errorf("не удалось разобрать подпись: %v", err)
+	}
+	if signer := p7.GetOnlySigner(); signer != nil {
+		info.Subject = signer.Subject.String()
+		info.Serial = fmt.Sprintf("%X", signer.SerialNumber)
+	}
+	var signingTime time.Time
+	if err := p7.UnmarshalSignedAttribute(pkcs7.OIDAttributeSigningTime, &signingTime); err == nil {
+		info.SigningTime = signingTime
+	}
+	if roots == nil {
+		return info, fmt.Errorf("не настроены доверенные сертификаты")
+	}
+	p7.Content = content
+	if err := p7.VerifyWithChain(roots); err != nil {
+		return info, err
+	}
+	return info, nil
+}
@@ -2,8 +2,10 @@ package util
 
 import (
 	"bytes"
+	crand "crypto/rand"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"math/rand"
 	"mime/multipart"
@@ -28,22 +30,6 @@ func FormatDate(t time.Time, format string) string {
 	return t.Format(format) // Аналогично: YYYY-MM-DD
 }
 
-// Генерация начала и конец дат всех месяцев в текущем году
-func DateStatGenerate() []StatMonth {
-	sms := []StatMonth{}
-	currentLocation := time.Now()
-	for month := 1; month < 13; month++ {
-
-		firstOfMonth := time.Date(currentLocation.Year(), time.Month(month), 1, 0, 0, 0, 0, currentLocation.Location())
-		lastOfMonth := firstOfMonth.AddDate(0, 1, -1)
-		sm := StatMonth{firstOfMonth, lastOfMonth}
-		sms = append(sms, sm)
-		//fmt.Println(firstOfMonth.Format("2006-01-02"))
-		//fmt.Println(lastOfMonth.Format("2006-01-02"))
-	}
-	return sms
-}
-
 // Генерация начала и конец дат всех месяцев в текущем году
 func DateYearGenerate() StatMonth {
 	sm := StatMonth{}
@@ -54,6 +40,14 @@ func DateYearGenerate() StatMonth {
 	return sm
 }
 
+// Генерация начала и конца дат указанного года
+func DateYearRange(year int) StatMonth {
+	currentLocation := time.Now()
+	firstOfYear := time.Date(year, 1, 1, 0, 0, 0, 0, currentLocation.Location())
+	lastOfYear := time.Date(year, 12, 31, 0, 0, 0, 0, currentLocation.Location())
+	return StatMonth{firstOfYear, lastOfYear}
+}
+
 // Случайное значение даты
 func RanDate() time.Time {
 	min := time.Date(2019, 1, 0, 0, 0, 0, 0, time.UTC).Unix()
@@ -69,27 +63,75 @@ func RandString(array []string) string {
 	return array[rand.Intn(len(array))]
 }
 
-func UploadFile(src multipart.File, handler *multipart.FileHeader) (string, error) {
+// UploadDir — каталог загруженных файлов приказов
+var UploadDir = "./upload"
+
+var (
+	uploadBytes = Metrics.NewCounter("dborders_upload_bytes_total",
+		"Bytes of order files written to the upload dir.")
+	uploadsTotal = Metrics.NewCounter("dborders_uploads_total",
+		"Order file uploads by result.", "result")
+)
+
+// UploadFile сохраняет загруженный файл во временный файл каталога загрузок на сегодня.
+// Возвращает путь временного файла и уникальный путь, на который его переместит MoveUpload:
+// файл с тем же именем, загруженный к другому приказу, не перезаписывается
+func UploadFile(src multipart.File, handler *multipart.FileHeader) (string, string, error) {
 	t := time.Now()
-	path := fmt.Sprintf("./upload/%d-%02d-%02d", t.Year(), t.Month(), t.Day())
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		os.Mkdir(path, 0666)
+	dir := fmt.Sprintf("%s/%d-%02d-%02d", UploadDir, t.Year(), t.Month(), t.Day())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		uploadsTotal.Inc("failure")
+		log.Println("UploadFile err: ", err)
+		return "", "", err
+	}
+	key := make([]byte, 8)
+	if _, err := crand.Read(key); err != nil {
+		uploadsTotal.Inc("failure")
+		return "", "", err
+	}
+	path := fmt.Sprintf("%s/%x/%s", dir, key, filepath.Base(handler.Filename))
+
+	dst, err := ioutil.TempFile(dir, ".upload-")
+	if err != nil {
+		uploadsTotal.Inc("failure")
+		log.Println("UploadFile err: ", err)
+		return "", path, err
+	}
+	n, err := io.Copy(dst, src)
+	uploadBytes.Add(float64(n))
+	if cerr := dst.Close(); err == nil {
+		err = cerr
 	}
-	dst, err := os.Create(filepath.Join(path, handler.Filename))
-	path = fmt.Sprintf("%+v/%+v", path, handler.Filename)
 	if err != nil {
+		uploadsTotal.Inc("failure")
 		log.Println("UploadFile err: ", err)
-		return path, err
+		os.Remove(dst.Name())
+		return "", path, err
+	}
+	uploadsTotal.Inc("success")
+	return dst.Name(), path, nil
+}
+
+// MoveUpload перемещает временный файл на путь, выданный UploadFile. Каталог пути
+// создается заново, так что занятый путь — ошибка, а не перезапись
+func MoveUpload(tmp, path string) error {
+	if err := os.Mkdir(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(filepath.Dir(path))
+		return err
+	}
+	return nil
+}
+
+// RemoveUpload удаляет перемещенный MoveUpload файл вместе с его каталогом, если тот опустел
+func RemoveUpload(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
 	}
-	defer dst.Close()
-	io.Copy(dst, src)
-	/*
-		fmt.Printf("Путь к файлу: %+v\n", path)
-		fmt.Printf("Загружен файл: %+v\n", handler.Filename)
-		fmt.Printf("Размер файла: %+v\n", handler.Size)
-		fmt.Printf("MIME Header: %+v\n", handler.Header)
-	*/
-	return path, err
+	os.Remove(filepath.Dir(path))
+	return nil
 }
 
 func ReplicatorParenthesis(number int) string {